@@ -0,0 +1,163 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	incCommon "github.com/incognitochain/go-incognito-sdk-v2/common"
+	"github.com/obsidianwallet/obsidian-wallet-node/pdexservice"
+	"github.com/obsidianwallet/obsidian-wallet-node/walletmanager"
+)
+
+// Amount is an amount in a request body, either a JSON number of raw units
+// or a JSON string of tokens such as "1.25" read with the token decimals.
+type Amount struct {
+	raw       uint64
+	formatted string
+}
+
+func (amount *Amount) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var formatted string
+		if err := json.Unmarshal(data, &formatted); err != nil {
+			return err
+		}
+		if formatted == "" {
+			return errors.New("amount string is empty")
+		}
+		amount.raw, amount.formatted = 0, formatted
+		return nil
+	}
+	// a JSON number must be an exact integer, 1.5 or 1e9 are refused
+	raw, err := strconv.ParseUint(string(data), 10, 64)
+	if err != nil {
+		return fmt.Errorf("amount %s must be an integer of raw units or a decimal string", data)
+	}
+	amount.raw, amount.formatted = raw, ""
+	return nil
+}
+
+// resolveAmount returns amount in raw units of tokenID, PRV when empty,
+// responding with an error when it cannot be parsed.
+func (api *APIService) resolveAmount(c *gin.Context, amount Amount, tokenID string) (uint64, bool) {
+	if amount.formatted == "" {
+		return amount.raw, true
+	}
+	if tokenID == "" {
+		tokenID = incCommon.PRVIDStr
+	}
+	raw, err := api.tokens.ParseAmount(tokenID, amount.formatted)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return 0, false
+	}
+	return raw, true
+}
+
+// formatAmount returns amount of tokenID in tokens, empty when the token
+// decimals are unknown.
+func (api *APIService) formatAmount(tokenID string, amount uint64) string {
+	if tokenID == "" {
+		tokenID = incCommon.PRVIDStr
+	}
+	formatted, _ := api.tokens.FormatAmount(tokenID, amount)
+	return formatted
+}
+
+func (api *APIService) buildHistoryEntryInfo(entry walletmanager.HistoryEntry) HistoryEntryInfo {
+	info := HistoryEntryInfo{HistoryEntry: entry}
+	if !entry.AmountHidden {
+		info.AmountFormatted = api.formatAmount(entry.TokenID, entry.Amount)
+	}
+	if entry.Fee > 0 {
+		info.FeeFormatted = api.formatAmount("", entry.Fee)
+	}
+	return info
+}
+
+func (api *APIService) buildTradeEstimateInfo(estimate *pdexservice.TradeEstimate) TradeEstimateInfo {
+	info := TradeEstimateInfo{
+		TradeEstimate:           estimate,
+		SellAmountFormatted:     api.formatAmount(estimate.TokenToSell, estimate.SellAmount),
+		ExpectedAmountFormatted: api.formatAmount(estimate.TokenToBuy, estimate.ExpectedAmount),
+		FeeInSellTokenFormatted: api.formatAmount(estimate.TokenToSell, estimate.FeeInSellToken),
+	}
+	if estimate.FeeInPRV > 0 {
+		info.FeeInPRVFormatted = api.formatAmount("", estimate.FeeInPRV)
+	}
+	return info
+}
+
+// formatAmounts formats the amounts of a map keyed by token ID, leaving out
+// the tokens with unknown decimals.
+func (api *APIService) formatAmounts(amounts map[string]uint64) map[string]string {
+	result := make(map[string]string)
+	for tokenID, amount := range amounts {
+		if formatted := api.formatAmount(tokenID, amount); formatted != "" {
+			result[tokenID] = formatted
+		}
+	}
+	return result
+}
+
+func (api *APIService) buildPositionsInfo(positions *pdexservice.LiquidityPositions) LiquidityPositionsInfo {
+	info := LiquidityPositionsInfo{NftIDs: positions.NftIDs, Positions: []PositionInfo{}}
+	for _, position := range positions.Positions {
+		info.Positions = append(info.Positions, PositionInfo{
+			Position:              position,
+			Token0AmountFormatted: api.formatAmount(position.Token0ID, position.Token0Amount),
+			Token1AmountFormatted: api.formatAmount(position.Token1ID, position.Token1Amount),
+			FeesFormatted:         api.formatAmounts(position.Fees),
+		})
+	}
+	return info
+}
+
+func (api *APIService) buildContributionInfo(contribution pdexservice.Contribution) ContributionInfo {
+	info := ContributionInfo{
+		Contribution:          contribution,
+		Token0AmountFormatted: api.formatAmount(contribution.Token0ID, contribution.Token0Amount),
+		Token1AmountFormatted: api.formatAmount(contribution.Token1ID, contribution.Token1Amount),
+	}
+	if status := contribution.Status; status != nil {
+		info.Status = &ContributionStatusInfo{
+			ContributionStatus:               *status,
+			Token0ContributedAmountFormatted: api.formatAmount(status.Token0ID, status.Token0ContributedAmount),
+			Token0ReturnedAmountFormatted:    api.formatAmount(status.Token0ID, status.Token0ReturnedAmount),
+			Token1ContributedAmountFormatted: api.formatAmount(status.Token1ID, status.Token1ContributedAmount),
+			Token1ReturnedAmountFormatted:    api.formatAmount(status.Token1ID, status.Token1ReturnedAmount),
+		}
+	}
+	return info
+}
+
+func (api *APIService) buildOrderInfo(order pdexservice.AccountOrder) OrderInfo {
+	return OrderInfo{
+		AccountOrder:                 order,
+		SellAmountFormatted:          api.formatAmount(order.TokenToSell, order.SellAmount),
+		MinAcceptableAmountFormatted: api.formatAmount(order.TokenToBuy, order.MinAcceptableAmount),
+		SoldAmountFormatted:          api.formatAmount(order.TokenToSell, order.SoldAmount),
+		BoughtAmountFormatted:        api.formatAmount(order.TokenToBuy, order.BoughtAmount),
+		WithdrawableFormatted:        api.formatAmounts(order.Withdrawable),
+	}
+}
+
+func (api *APIService) buildStakingPositionsInfo(positions *pdexservice.StakingPositions) StakingPositionsInfo {
+	info := StakingPositionsInfo{BeaconHeight: positions.BeaconHeight, Positions: []StakingPositionInfo{}}
+	for _, position := range positions.Positions {
+		info.Positions = append(info.Positions, StakingPositionInfo{
+			StakingPosition:      position,
+			AmountFormatted:      api.formatAmount(position.TokenID, position.Amount),
+			TotalStakedFormatted: api.formatAmount(position.TokenID, position.TotalStaked),
+			RewardsFormatted:     api.formatAmounts(position.Rewards),
+		})
+	}
+	return info
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAmountUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		data          string
+		wantRaw       uint64
+		wantFormatted string
+		wantErr       bool
+	}{
+		{`0`, 0, "", false},
+		{`1000000000`, 1000000000, "", false},
+		{`18446744073709551615`, 18446744073709551615, "", false},
+		{`"1.25"`, 0, "1.25", false},
+		{`"abc"`, 0, "abc", false},
+		{`18446744073709551616`, 0, "", true},
+		{`1.5`, 0, "", true},
+		{`1e9`, 0, "", true},
+		{`-1`, 0, "", true},
+		{`""`, 0, "", true},
+		{`true`, 0, "", true},
+	}
+	for _, tt := range tests {
+		var amount Amount
+		err := json.Unmarshal([]byte(tt.data), &amount)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("unmarshal %s error = %v, wantErr %v", tt.data, err, tt.wantErr)
+			continue
+		}
+		if amount.raw != tt.wantRaw || amount.formatted != tt.wantFormatted {
+			t.Errorf("unmarshal %s = {%v %q}, want {%v %q}", tt.data, amount.raw, amount.formatted, tt.wantRaw, tt.wantFormatted)
+		}
+	}
+}
+
+func TestAmountUnmarshalNull(t *testing.T) {
+	var request struct {
+		Amount Amount
+	}
+	if err := json.Unmarshal([]byte(`{"Amount": null}`), &request); err != nil {
+		t.Fatalf("unmarshal null failed: %v", err)
+	}
+	if request.Amount.raw != 0 || request.Amount.formatted != "" {
+		t.Errorf("null amount = {%v %q}, want zero", request.Amount.raw, request.Amount.formatted)
+	}
+}
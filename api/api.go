@@ -1,19 +1,33 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
+	"github.com/obsidianwallet/obsidian-wallet-node/common"
+	"github.com/obsidianwallet/obsidian-wallet-node/pdexservice"
+	"github.com/obsidianwallet/obsidian-wallet-node/tokenregistry"
 	"github.com/obsidianwallet/obsidian-wallet-node/walletmanager"
 )
 
-func InitAPIService(address string, wlm *walletmanager.WalletManager, networkController NetworkController) (*APIService, error) {
+func InitAPIService(address string, wlm *walletmanager.WalletManager, pdex *pdexservice.PDexService, tokens *tokenregistry.TokenRegistry, networkController NetworkController) (*APIService, error) {
 	api := &APIService{
 		address: address,
 		wlm:     wlm,
+		pdex:    pdex,
+		tokens:  tokens,
+
+		networkController: networkController,
+		closing:           make(chan struct{}),
 	}
 	return api, nil
 }
@@ -22,7 +36,8 @@ func (api *APIService) Serve() error {
 	log.Println("initiating api-service...")
 
 	r := gin.Default()
-	r.Use(gzip.Gzip(gzip.DefaultCompression))
+	// the event stream must be flushed as it goes, not compressed
+	r.Use(gzip.Gzip(gzip.DefaultCompression, gzip.WithExcludedPaths([]string{"/v1/events"})))
 
 	r.Use(cors.New(cors.Config{
 		AllowAllOrigins: true,
@@ -33,7 +48,19 @@ func (api *APIService) Serve() error {
 
 	apiv1 := r.Group("/v1")
 
+	apiv1.GET("/events", api.StreamEvents)
+	apiv1.GET("/health", api.Health)
+
 	apiv1.GET("/tokenlist", api.GetTokenList)
+	apiv1.GET("/tokenlist/get", api.GetToken)
+	apiv1.POST("/tokenlist/refresh", api.RefreshTokenList)
+
+	network := apiv1.Group("/network")
+	network.GET("/list", api.ListNetworks)
+	network.GET("/current", api.GetCurrentNetwork)
+	network.POST("/add", api.AddNetwork)
+	network.GET("/remove", api.RemoveNetwork)
+	network.POST("/switch", api.SwitchToNetwork)
 
 	wl := apiv1.Group("/wallet")
 	wl.GET("/list_accounts", api.ListAccounts)
@@ -42,44 +69,790 @@ func (api *APIService) Serve() error {
 	wl.GET("/delete_account", api.DeleteAccount)
 	wl.GET("/get_account", api.GetAccount)
 	wl.POST("/watch_token", api.WatchToken)
+	wl.POST("/send", api.Send)
+	wl.GET("/history", api.GetHistory)
+	wl.GET("/status", api.WalletStatus)
+	wl.POST("/encrypt", api.EncryptWallet)
+	wl.POST("/unlock", api.UnlockWallet)
+	wl.POST("/lock", api.LockWallet)
+	wl.POST("/create_from_mnemonic", api.CreateFromMnemonic)
+	wl.POST("/derive_next", api.DeriveNextAccount)
+
+	coinsync := apiv1.Group("/sync")
+	coinsync.GET("/status", api.SyncStatus)
+
+	contacts := apiv1.Group("/contacts")
+	contacts.GET("/list", api.ListContacts)
+	contacts.GET("/get", api.GetContact)
+	contacts.POST("/add", api.AddContact)
+	contacts.POST("/update", api.UpdateContact)
+	contacts.GET("/delete", api.DeleteContact)
 
 	pdex := apiv1.Group("/pdex")
 	pdex.GET("/listpools", api.ListPools)
 	pdex.GET("/listpairs", api.ListPairs)
+	pdex.GET("/estimate", api.EstimateTrade)
+	pdex.POST("/trade", api.Trade)
+
+	liquidity := pdex.Group("/liquidity")
+	liquidity.GET("/positions", api.ListPositions)
+	liquidity.GET("/contributions", api.ListContributions)
+	liquidity.POST("/mintnft", api.MintNFT)
+	liquidity.POST("/contribute", api.Contribute)
+	liquidity.POST("/withdraw", api.WithdrawLiquidity)
+	liquidity.POST("/claimfee", api.ClaimLPFees)
+
+	orders := pdex.Group("/orders")
+	orders.GET("/list", api.ListOrders)
+	orders.POST("/place", api.PlaceOrder)
+	orders.POST("/cancel", api.CancelOrder)
+	orders.POST("/withdraw", api.WithdrawOrder)
 
-	return r.Run(api.address)
+	staking := pdex.Group("/staking")
+	staking.GET("/pools", api.ListStakingPools)
+	staking.GET("/positions", api.ListStakingPositions)
+	staking.POST("/stake", api.Stake)
+	staking.POST("/unstake", api.Unstake)
+	staking.POST("/claimreward", api.ClaimStakingRewards)
+
+	portfolio := apiv1.Group("/portfolio")
+	portfolio.GET("/value", api.GetPortfolio)
+	portfolio.GET("/history", api.GetPortfolioHistory)
+
+	server := &http.Server{Addr: api.address, Handler: r}
+	api.serverLock.Lock()
+	select {
+	case <-api.closing:
+		api.serverLock.Unlock()
+		return nil
+	default:
+	}
+	api.server = server
+	api.serverLock.Unlock()
+	err := server.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting requests and waits for the ones in progress
+// until ctx is done.
+func (api *APIService) Shutdown(ctx context.Context) error {
+	api.serverLock.Lock()
+	close(api.closing)
+	server := api.server
+	api.serverLock.Unlock()
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
 }
 
 func (api *APIService) GetTokenList(c *gin.Context) {
+	page, limit, err := parsePagination(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	verifiedOnly := false
+	if verified := c.Query("verified"); verified != "" {
+		verifiedOnly, err = strconv.ParseBool(verified)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, fmt.Errorf("invalid verified: %v", err))
+			return
+		}
+	}
+	respondOK(c, api.tokens.ListTokens(tokenregistry.TokenFilter{
+		Query:        c.Query("query"),
+		VerifiedOnly: verifiedOnly,
+		Network:      c.Query("network"),
+		Offset:       (page - 1) * limit,
+		Limit:        limit,
+	}))
+}
 
+func (api *APIService) GetToken(c *gin.Context) {
+	token, err := api.tokens.GetToken(c.Query("tokenid"))
+	if err != nil {
+		respondError(c, http.StatusNotFound, err)
+		return
+	}
+	respondOK(c, token)
 }
 
-func (api *APIService) ListAccounts(c *gin.Context) {
+func (api *APIService) RefreshTokenList(c *gin.Context) {
+	if err := api.tokens.Refresh(); err != nil {
+		respondError(c, http.StatusBadGateway, err)
+		return
+	}
+	respondOK(c, true)
+}
 
+func (api *APIService) ListNetworks(c *gin.Context) {
+	networks := api.networkController.GetNetworkList()
+	sort.Slice(networks, func(i, j int) bool {
+		return networks[i].Name < networks[j].Name
+	})
+	if networks == nil {
+		networks = []common.NetworkID{}
+	}
+	respondOK(c, networks)
 }
 
-func (api *APIService) CreateAccount(c *gin.Context) {
+func (api *APIService) GetCurrentNetwork(c *gin.Context) {
+	respondOK(c, CurrentNetworkInfo{
+		Network: api.networkController.GetCurrentNetwork(),
+		RPC:     api.networkController.GetCurrentRPC(),
+		Switch:  api.networkController.GetSwitchStatus(),
+	})
+}
 
+// AddNetwork saves a network after checking one of its RPCs is usable, so
+// it can take up to the RPC check timeout.
+func (api *APIService) AddNetwork(c *gin.Context) {
+	var req AddNetworkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	networkID := common.NetworkID{
+		Name:        req.Name,
+		RPCs:        req.RPCs,
+		ServiceURLs: req.ServiceURLs,
+	}
+	if err := api.networkController.AddNetwork(networkID); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	respondOK(c, networkID)
 }
 
-func (api *APIService) UpdateAccount(c *gin.Context) {
+func (api *APIService) RemoveNetwork(c *gin.Context) {
+	network := c.Query("network")
+	if network == "" {
+		respondError(c, http.StatusBadRequest, errors.New("network is required"))
+		return
+	}
+	if err := api.networkController.RemoveNetwork(network); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	respondOK(c, true)
+}
 
+// SwitchToNetwork starts the switch and returns at once, its progress is
+// reported by GetCurrentNetwork and the network_switch events.
+func (api *APIService) SwitchToNetwork(c *gin.Context) {
+	var req SwitchNetworkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	status, err := api.networkController.SwitchNetwork(req.Network)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"result": status})
 }
 
-func (api *APIService) DeleteAccount(c *gin.Context) {
+// Health reports the background workers, with status 503 when one of them
+// is failing.
+func (api *APIService) Health(c *gin.Context) {
+	info := HealthInfo{Healthy: true, Workers: api.wlm.GetWorkersHealth()}
+	for _, worker := range info.Workers {
+		if !worker.Healthy {
+			info.Healthy = false
+		}
+	}
+	if !info.Healthy {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"result": info})
+		return
+	}
+	respondOK(c, info)
+}
 
+func (api *APIService) SyncStatus(c *gin.Context) {
+	respondOK(c, api.wlm.GetSyncStatus())
 }
 
-func (api *APIService) GetAccount(c *gin.Context) {
+func (api *APIService) ListAccounts(c *gin.Context) {
+	accounts, err := api.wlm.ListAccounts()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	result := []AccountInfo{}
+	for pubkey, account := range accounts {
+		result = append(result, buildAccountInfo(pubkey, account))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	respondOK(c, result)
+}
 
+func (api *APIService) CreateAccount(c *gin.Context) {
+	var req CreateAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	account := walletmanager.Account{
+		Name:           req.Name,
+		Note:           req.Note,
+		Type:           req.Type,
+		PrivateKey:     req.PrivateKey,
+		PaymentAddress: req.PaymentAddress,
+		OTAKey:         req.OTAKey,
+		ViewKey:        req.ViewKey,
+	}
+	pubkey, err := api.wlm.AddNewAccount(account)
+	if err != nil {
+		respondError(c, accountErrorStatus(err), err)
+		return
+	}
+	acc := api.wlm.GetAccountInstance(pubkey)
+	if acc == nil {
+		// deleted concurrently
+		respondError(c, http.StatusNotFound, walletmanager.ErrAccountNotFound)
+		return
+	}
+	respondOK(c, buildAccountInfo(pubkey, acc.GetAccount()))
 }
 
-func (api *APIService) ListPools(c *gin.Context) {
+func (api *APIService) UpdateAccount(c *gin.Context) {
+	var req UpdateAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	account, err := api.wlm.UpdateAccount(req.Pubkey, req.Name, req.Note)
+	if err != nil {
+		respondError(c, accountErrorStatus(err), err)
+		return
+	}
+	respondOK(c, buildAccountInfo(req.Pubkey, account))
+}
 
+func (api *APIService) DeleteAccount(c *gin.Context) {
+	account := c.Query("account")
+	if account == "" {
+		respondError(c, http.StatusBadRequest, errors.New("account is required"))
+		return
+	}
+	if err := api.wlm.DeleteAccount(account); err != nil {
+		respondError(c, accountErrorStatus(err), err)
+		return
+	}
+	respondOK(c, "ok")
+}
+
+func (api *APIService) GetAccount(c *gin.Context) {
+	account := c.Query("account")
+	acc := api.wlm.GetAccountInstance(account)
+	if acc == nil {
+		respondError(c, http.StatusNotFound, walletmanager.ErrAccountNotFound)
+		return
+	}
+	accountData := acc.GetAccount()
+	result := AccountDetail{
+		AccountInfo:        buildAccountInfo(account, accountData),
+		Balances:           acc.GetBalances(),
+		UnverifiedBalances: acc.GetUnverifiedBalances(),
+		AmountsHidden:      accountData.Type == walletmanager.WatchOnly && accountData.ViewKey == "",
+	}
+	result.BalancesFormatted = api.formatAmounts(result.Balances)
+	result.UnverifiedBalancesFormatted = api.formatAmounts(result.UnverifiedBalances)
+	respondOK(c, result)
+}
+
+func (api *APIService) ListPools(c *gin.Context) {
+	pools, err := api.pdex.ListPools(buildPoolFilter(c))
+	if err != nil {
+		respondError(c, pdexErrorStatus(err), err)
+		return
+	}
+	respondOK(c, pools)
 }
 
 func (api *APIService) ListPairs(c *gin.Context) {
+	pairs, err := api.pdex.ListPairs(buildPoolFilter(c))
+	if err != nil {
+		respondError(c, pdexErrorStatus(err), err)
+		return
+	}
+	respondOK(c, pairs)
+}
 
+func (api *APIService) EstimateTrade(c *gin.Context) {
+	tokenToSell := c.Query("selltoken")
+	tokenToBuy := c.Query("buytoken")
+	if tokenToSell == "" || tokenToBuy == "" {
+		respondError(c, http.StatusBadRequest, errors.New("selltoken and buytoken are required"))
+		return
+	}
+	// amount is in raw units, formattedamount in tokens
+	var amount uint64
+	var err error
+	if formatted := c.Query("formattedamount"); formatted != "" {
+		amount, err = api.tokens.ParseAmount(tokenToSell, formatted)
+	} else {
+		amount, err = strconv.ParseUint(c.Query("amount"), 10, 64)
+	}
+	if err != nil {
+		respondError(c, http.StatusBadRequest, fmt.Errorf("invalid amount: %v", err))
+		return
+	}
+	estimate, err := api.pdex.EstimateTrade(tokenToSell, tokenToBuy, amount)
+	if err != nil {
+		respondError(c, pdexErrorStatus(err), err)
+		return
+	}
+	respondOK(c, api.buildTradeEstimateInfo(estimate))
+}
+
+func (api *APIService) Trade(c *gin.Context) {
+	var req TradeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	accRT := api.wlm.GetAccountInstance(req.Account)
+	if accRT == nil {
+		respondError(c, http.StatusNotFound, walletmanager.ErrAccountNotFound)
+		return
+	}
+	sellAmount, ok := api.resolveAmount(c, req.SellAmount, req.TokenToSell)
+	if !ok {
+		return
+	}
+	minAcceptableAmount, ok := api.resolveAmount(c, req.MinAcceptableAmount, req.TokenToBuy)
+	if !ok {
+		return
+	}
+	fee, ok := api.resolveAmount(c, req.Fee, "")
+	if !ok {
+		return
+	}
+	result, err := api.pdex.Trade(accRT, pdexservice.TradeParam{
+		TokenToSell:         req.TokenToSell,
+		TokenToBuy:          req.TokenToBuy,
+		SellAmount:          sellAmount,
+		MinAcceptableAmount: minAcceptableAmount,
+		FeeToken:            req.FeeToken,
+		TxFee:               fee,
+	})
+	if err != nil {
+		respondError(c, pdexErrorStatus(err), err)
+		return
+	}
+	respondOK(c, TradeResultInfo{
+		TxHash:              result.TxHash,
+		TradingFee:          result.TradingFee,
+		TradingFeeFormatted: api.formatAmount(result.FeeToken, result.TradingFee),
+		FeeToken:            result.FeeToken,
+		Estimate:            api.buildTradeEstimateInfo(result.Estimate),
+	})
+}
+
+func (api *APIService) ListPositions(c *gin.Context) {
+	accRT := api.getAccountInstance(c, c.Query("account"))
+	if accRT == nil {
+		return
+	}
+	positions, err := api.pdex.ListPositions(accRT)
+	if err != nil {
+		respondError(c, pdexErrorStatus(err), err)
+		return
+	}
+	respondOK(c, api.buildPositionsInfo(positions))
+}
+
+func (api *APIService) ListContributions(c *gin.Context) {
+	accRT := api.getAccountInstance(c, c.Query("account"))
+	if accRT == nil {
+		return
+	}
+	contributions, err := api.pdex.ListContributions(accRT)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	result := []ContributionInfo{}
+	for _, contribution := range contributions {
+		result = append(result, api.buildContributionInfo(contribution))
+	}
+	respondOK(c, result)
+}
+
+func (api *APIService) MintNFT(c *gin.Context) {
+	var req MintNFTRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	accRT := api.getAccountInstance(c, req.Account)
+	if accRT == nil {
+		return
+	}
+	fee, ok := api.resolveAmount(c, req.Fee, "")
+	if !ok {
+		return
+	}
+	txHash, err := api.pdex.MintNFT(accRT, fee)
+	if err != nil {
+		respondError(c, pdexErrorStatus(err), err)
+		return
+	}
+	respondOK(c, SendResult{TxHash: txHash})
+}
+
+func (api *APIService) Contribute(c *gin.Context) {
+	var req ContributeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	accRT := api.getAccountInstance(c, req.Account)
+	if accRT == nil {
+		return
+	}
+	// the amounts are read with the decimals of the pool tokens
+	token0ID, token1ID := req.Token0ID, req.Token1ID
+	if req.PoolID != "" {
+		pool, err := api.pdex.GetPool(req.PoolID)
+		if err != nil {
+			respondError(c, pdexErrorStatus(err), err)
+			return
+		}
+		token0ID, token1ID = pool.Token0ID, pool.Token1ID
+	}
+	token0Amount, ok := api.resolveAmount(c, req.Token0Amount, token0ID)
+	if !ok {
+		return
+	}
+	token1Amount, ok := api.resolveAmount(c, req.Token1Amount, token1ID)
+	if !ok {
+		return
+	}
+	fee, ok := api.resolveAmount(c, req.Fee, "")
+	if !ok {
+		return
+	}
+	contribution, err := api.pdex.Contribute(accRT, pdexservice.ContributeParam{
+		PoolID:       req.PoolID,
+		Token0ID:     req.Token0ID,
+		Token1ID:     req.Token1ID,
+		Token0Amount: token0Amount,
+		Token1Amount: token1Amount,
+		Amplifier:    req.Amplifier,
+		NftID:        req.NftID,
+		TxFee:        fee,
+	})
+	if err != nil {
+		respondError(c, pdexErrorStatus(err), err)
+		return
+	}
+	respondOK(c, contribution)
+}
+
+func (api *APIService) WithdrawLiquidity(c *gin.Context) {
+	var req WithdrawLiquidityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	accRT := api.getAccountInstance(c, req.Account)
+	if accRT == nil {
+		return
+	}
+	fee, ok := api.resolveAmount(c, req.Fee, "")
+	if !ok {
+		return
+	}
+	txHash, err := api.pdex.WithdrawLiquidity(accRT, req.PoolID, req.NftID, req.ShareAmount, fee)
+	if err != nil {
+		respondError(c, pdexErrorStatus(err), err)
+		return
+	}
+	respondOK(c, SendResult{TxHash: txHash})
+}
+
+func (api *APIService) ClaimLPFees(c *gin.Context) {
+	var req ClaimLPFeesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	accRT := api.getAccountInstance(c, req.Account)
+	if accRT == nil {
+		return
+	}
+	fee, ok := api.resolveAmount(c, req.Fee, "")
+	if !ok {
+		return
+	}
+	txHash, err := api.pdex.ClaimLPFees(accRT, req.PoolID, req.NftID, fee)
+	if err != nil {
+		respondError(c, pdexErrorStatus(err), err)
+		return
+	}
+	respondOK(c, SendResult{TxHash: txHash})
+}
+
+func (api *APIService) ListOrders(c *gin.Context) {
+	accRT := api.getAccountInstance(c, c.Query("account"))
+	if accRT == nil {
+		return
+	}
+	orders, err := api.pdex.ListOrders(accRT)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	result := []OrderInfo{}
+	for _, order := range orders {
+		result = append(result, api.buildOrderInfo(order))
+	}
+	respondOK(c, result)
+}
+
+func (api *APIService) PlaceOrder(c *gin.Context) {
+	var req PlaceOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	accRT := api.getAccountInstance(c, req.Account)
+	if accRT == nil {
+		return
+	}
+	pool, err := api.pdex.GetPool(req.PoolID)
+	if err != nil {
+		respondError(c, pdexErrorStatus(err), err)
+		return
+	}
+	tokenToBuy := pool.Token0ID
+	if req.TokenToSell == pool.Token0ID {
+		tokenToBuy = pool.Token1ID
+	}
+	sellAmount, ok := api.resolveAmount(c, req.SellAmount, req.TokenToSell)
+	if !ok {
+		return
+	}
+	minAcceptableAmount, ok := api.resolveAmount(c, req.MinAcceptableAmount, tokenToBuy)
+	if !ok {
+		return
+	}
+	fee, ok := api.resolveAmount(c, req.Fee, "")
+	if !ok {
+		return
+	}
+	order, err := api.pdex.PlaceOrder(accRT, pdexservice.PlaceOrderParam{
+		PoolID:              req.PoolID,
+		TokenToSell:         req.TokenToSell,
+		SellAmount:          sellAmount,
+		MinAcceptableAmount: minAcceptableAmount,
+		NftID:               req.NftID,
+		TxFee:               fee,
+	})
+	if err != nil {
+		respondError(c, pdexErrorStatus(err), err)
+		return
+	}
+	respondOK(c, order)
+}
+
+func (api *APIService) CancelOrder(c *gin.Context) {
+	var req CancelOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	accRT := api.getAccountInstance(c, req.Account)
+	if accRT == nil {
+		return
+	}
+	fee, ok := api.resolveAmount(c, req.Fee, "")
+	if !ok {
+		return
+	}
+	txHash, err := api.pdex.CancelOrder(accRT, req.OrderID, fee)
+	if err != nil {
+		respondError(c, pdexErrorStatus(err), err)
+		return
+	}
+	respondOK(c, SendResult{TxHash: txHash})
+}
+
+func (api *APIService) WithdrawOrder(c *gin.Context) {
+	var req WithdrawOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	accRT := api.getAccountInstance(c, req.Account)
+	if accRT == nil {
+		return
+	}
+	amount, ok := api.resolveAmount(c, req.Amount, req.TokenID)
+	if !ok {
+		return
+	}
+	fee, ok := api.resolveAmount(c, req.Fee, "")
+	if !ok {
+		return
+	}
+	txHash, err := api.pdex.WithdrawOrder(accRT, req.OrderID, req.TokenID, amount, fee)
+	if err != nil {
+		respondError(c, pdexErrorStatus(err), err)
+		return
+	}
+	respondOK(c, SendResult{TxHash: txHash})
+}
+
+func (api *APIService) ListStakingPools(c *gin.Context) {
+	pools, err := api.pdex.ListStakingPools()
+	if err != nil {
+		respondError(c, pdexErrorStatus(err), err)
+		return
+	}
+	result := []StakingPoolDetail{}
+	for _, pool := range pools {
+		result = append(result, StakingPoolDetail{
+			StakingPoolInfo:    pool,
+			LiquidityFormatted: api.formatAmount(pool.TokenID, pool.Liquidity),
+		})
+	}
+	respondOK(c, result)
+}
+
+func (api *APIService) ListStakingPositions(c *gin.Context) {
+	accRT := api.getAccountInstance(c, c.Query("account"))
+	if accRT == nil {
+		return
+	}
+	positions, err := api.pdex.ListStakingPositions(accRT)
+	if err != nil {
+		respondError(c, pdexErrorStatus(err), err)
+		return
+	}
+	respondOK(c, api.buildStakingPositionsInfo(positions))
+}
+
+func (api *APIService) Stake(c *gin.Context) {
+	var req StakeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	accRT := api.getAccountInstance(c, req.Account)
+	if accRT == nil {
+		return
+	}
+	amount, ok := api.resolveAmount(c, req.Amount, req.TokenID)
+	if !ok {
+		return
+	}
+	fee, ok := api.resolveAmount(c, req.Fee, "")
+	if !ok {
+		return
+	}
+	txHash, err := api.pdex.Stake(accRT, pdexservice.StakeParam{
+		TokenID: req.TokenID,
+		Amount:  amount,
+		NftID:   req.NftID,
+		TxFee:   fee,
+	})
+	if err != nil {
+		respondError(c, pdexErrorStatus(err), err)
+		return
+	}
+	respondOK(c, SendResult{TxHash: txHash})
+}
+
+func (api *APIService) Unstake(c *gin.Context) {
+	var req UnstakeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	accRT := api.getAccountInstance(c, req.Account)
+	if accRT == nil {
+		return
+	}
+	amount, ok := api.resolveAmount(c, req.Amount, req.TokenID)
+	if !ok {
+		return
+	}
+	fee, ok := api.resolveAmount(c, req.Fee, "")
+	if !ok {
+		return
+	}
+	txHash, err := api.pdex.Unstake(accRT, req.TokenID, req.NftID, amount, fee)
+	if err != nil {
+		respondError(c, pdexErrorStatus(err), err)
+		return
+	}
+	respondOK(c, SendResult{TxHash: txHash})
+}
+
+func (api *APIService) ClaimStakingRewards(c *gin.Context) {
+	var req ClaimStakingRewardsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	accRT := api.getAccountInstance(c, req.Account)
+	if accRT == nil {
+		return
+	}
+	fee, ok := api.resolveAmount(c, req.Fee, "")
+	if !ok {
+		return
+	}
+	txHash, err := api.pdex.ClaimStakingRewards(accRT, req.TokenID, req.NftID, fee)
+	if err != nil {
+		respondError(c, pdexErrorStatus(err), err)
+		return
+	}
+	respondOK(c, SendResult{TxHash: txHash})
+}
+
+// GetPortfolio values the balances of account, of the whole wallet when it
+// is empty, in the reference token given by symbol or ID, USDT by default.
+func (api *APIService) GetPortfolio(c *gin.Context) {
+	portfolio, err := api.pdex.GetPortfolio(c.DefaultQuery("reference", defaultPortfolioReference), c.Query("account"))
+	if err != nil {
+		respondError(c, pdexErrorStatus(err), err)
+		return
+	}
+	respondOK(c, portfolio)
+}
+
+func (api *APIService) GetPortfolioHistory(c *gin.Context) {
+	var from, to int64
+	var err error
+	if value := c.Query("from"); value != "" {
+		if from, err = strconv.ParseInt(value, 10, 64); err != nil {
+			respondError(c, http.StatusBadRequest, fmt.Errorf("invalid from: %v", err))
+			return
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if to, err = strconv.ParseInt(value, 10, 64); err != nil {
+			respondError(c, http.StatusBadRequest, fmt.Errorf("invalid to: %v", err))
+			return
+		}
+	}
+	points, err := api.pdex.GetPortfolioHistory(c.DefaultQuery("reference", defaultPortfolioReference), c.Query("account"), from, to)
+	if err != nil {
+		respondError(c, pdexErrorStatus(err), err)
+		return
+	}
+	respondOK(c, points)
 }
 
 func (api *APIService) WatchToken(c *gin.Context) {
@@ -89,22 +862,322 @@ func (api *APIService) WatchToken(c *gin.Context) {
 	acc := api.wlm.GetAccountInstance(account)
 
 	if acc == nil {
-		c.JSON(200, gin.H{"error": "account not found"})
+		respondError(c, http.StatusNotFound, walletmanager.ErrAccountNotFound)
+		return
+	}
+	if tokenid == "" {
+		respondError(c, http.StatusBadRequest, errors.New("tokenid is required"))
 		return
 	}
 	if action == "remove" {
 		err := acc.RemoveWatchToken(tokenid)
 		if err != nil {
-			c.JSON(200, gin.H{"error": err})
+			respondError(c, http.StatusInternalServerError, err)
 			return
 		}
-		c.JSON(200, gin.H{"result": "ok"})
+		respondOK(c, "ok")
 		return
 	}
 	err := acc.AddWatchToken(tokenid)
 	if err != nil {
-		c.JSON(200, gin.H{"error": err})
+		respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	respondOK(c, "ok")
+}
+
+func (api *APIService) Send(c *gin.Context) {
+	var req SendRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	acc := api.wlm.GetAccountInstance(req.Account)
+	if acc == nil {
+		respondError(c, http.StatusNotFound, walletmanager.ErrAccountNotFound)
+		return
+	}
+	var receivers []walletmanager.TxReceiver
+	for _, receiver := range req.Receivers {
+		amount, ok := api.resolveAmount(c, receiver.Amount, req.TokenID)
+		if !ok {
+			return
+		}
+		receivers = append(receivers, walletmanager.TxReceiver{
+			PaymentAddress: receiver.PaymentAddress,
+			Contact:        receiver.Contact,
+			Amount:         amount,
+		})
+	}
+	fee, ok := api.resolveAmount(c, req.Fee, "")
+	if !ok {
+		return
+	}
+	txHash, err := acc.CreateAndSendTransaction(walletmanager.TxParam{
+		TokenID:   req.TokenID,
+		Receivers: receivers,
+		Fee:       fee,
+		Memo:      req.Memo,
+	})
+	if err != nil {
+		respondError(c, txErrorStatus(err), err)
+		return
+	}
+	respondOK(c, SendResult{TxHash: txHash})
+}
+
+func (api *APIService) GetHistory(c *gin.Context) {
+	account := c.Query("account")
+	direction := walletmanager.HistoryDirection(c.Query("direction"))
+	switch direction {
+	case "", walletmanager.HistoryReceived, walletmanager.HistorySpent, walletmanager.HistorySent:
+	default:
+		respondError(c, http.StatusBadRequest, fmt.Errorf("invalid direction %v", direction))
+		return
+	}
+	page, limit, err := parsePagination(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	history, err := api.wlm.GetAccountHistory(account, walletmanager.HistoryFilter{
+		TokenID:   c.Query("tokenid"),
+		Direction: direction,
+		Offset:    (page - 1) * limit,
+		Limit:     limit,
+	})
+	if err != nil {
+		respondError(c, accountErrorStatus(err), err)
+		return
+	}
+	result := []HistoryEntryInfo{}
+	for _, entry := range history {
+		result = append(result, api.buildHistoryEntryInfo(entry))
+	}
+	respondOK(c, result)
+}
+
+func (api *APIService) WalletStatus(c *gin.Context) {
+	respondOK(c, WalletStatus{
+		Encrypted: api.wlm.IsEncrypted(),
+		Locked:    api.wlm.IsLocked(),
+		HasSeed:   api.wlm.HasMasterSeed(),
+	})
+}
+
+func (api *APIService) EncryptWallet(c *gin.Context) {
+	var req EncryptWalletRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	if err := api.wlm.EncryptWallet(req.Passphrase); err != nil {
+		respondError(c, walletErrorStatus(err), err)
+		return
+	}
+	respondOK(c, true)
+}
+
+func (api *APIService) UnlockWallet(c *gin.Context) {
+	var req UnlockWalletRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	until, err := api.wlm.Unlock(req.Passphrase, time.Duration(req.Timeout)*time.Second)
+	if err != nil {
+		respondError(c, walletErrorStatus(err), err)
+		return
+	}
+	respondOK(c, UnlockWalletResult{UnlockedUntil: until.Unix()})
+}
+
+func (api *APIService) LockWallet(c *gin.Context) {
+	api.wlm.Lock()
+	respondOK(c, true)
+}
+
+func (api *APIService) CreateFromMnemonic(c *gin.Context) {
+	var req CreateFromMnemonicRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	mnemonic, accounts, err := api.wlm.CreateFromMnemonic(req.Mnemonic, req.Name, req.Accounts)
+	if err != nil {
+		respondError(c, walletErrorStatus(err), err)
+		return
+	}
+	result := CreateFromMnemonicResult{Accounts: accounts}
+	// the mnemonic is only shown once, when the node generated it
+	if req.Mnemonic == "" {
+		result.Mnemonic = mnemonic
+	}
+	respondOK(c, result)
+}
+
+func (api *APIService) DeriveNextAccount(c *gin.Context) {
+	var req DeriveNextRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	account, err := api.wlm.DeriveNextAccount(req.Name, req.Note)
+	if err != nil {
+		respondError(c, walletErrorStatus(err), err)
+		return
+	}
+	respondOK(c, account)
+}
+
+func (api *APIService) ListContacts(c *gin.Context) {
+	contacts, err := api.wlm.ListContacts()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err)
 		return
 	}
+	respondOK(c, contacts)
+}
+
+func (api *APIService) GetContact(c *gin.Context) {
+	contact, err := api.wlm.GetContact(c.Query("name"))
+	if err != nil {
+		respondError(c, contactErrorStatus(err), err)
+		return
+	}
+	respondOK(c, contact)
+}
+
+func (api *APIService) AddContact(c *gin.Context) {
+	var req ContactRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	contact, err := api.wlm.AddContact(walletmanager.Contact{
+		Name:    req.Name,
+		Address: req.Address,
+		Note:    req.Note,
+	})
+	if err != nil {
+		respondError(c, contactErrorStatus(err), err)
+		return
+	}
+	respondOK(c, contact)
+}
+
+func (api *APIService) UpdateContact(c *gin.Context) {
+	var req UpdateContactRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	contact, err := api.wlm.UpdateContact(req.CurrentName, walletmanager.Contact{
+		Name:    req.Name,
+		Address: req.Address,
+		Note:    req.Note,
+	})
+	if err != nil {
+		respondError(c, contactErrorStatus(err), err)
+		return
+	}
+	respondOK(c, contact)
+}
 
+func (api *APIService) DeleteContact(c *gin.Context) {
+	name := c.Query("name")
+	if name == "" {
+		respondError(c, http.StatusBadRequest, errors.New("name is required"))
+		return
+	}
+	if err := api.wlm.DeleteContact(name); err != nil {
+		respondError(c, contactErrorStatus(err), err)
+		return
+	}
+	respondOK(c, true)
+}
+
+// getAccountInstance returns the runtime account of pubkey, responding with
+// an error when it does not exist.
+func (api *APIService) getAccountInstance(c *gin.Context, pubkey string) *walletmanager.RuntimeAccount {
+	accRT := api.wlm.GetAccountInstance(pubkey)
+	if accRT == nil {
+		respondError(c, http.StatusNotFound, walletmanager.ErrAccountNotFound)
+	}
+	return accRT
+}
+
+func buildAccountInfo(pubkey string, account walletmanager.Account) AccountInfo {
+	info := AccountInfo{
+		Pubkey:         pubkey,
+		Name:           account.Name,
+		Note:           account.Note,
+		Type:           account.Type,
+		PaymentAddress: account.PaymentAddress,
+		WatchTokens:    []string{},
+	}
+	for tokenID := range account.WatchTokens {
+		info.WatchTokens = append(info.WatchTokens, tokenID)
+	}
+	sort.Strings(info.WatchTokens)
+	return info
+}
+
+func accountErrorStatus(err error) int {
+	switch err {
+	case walletmanager.ErrAccountNotFound:
+		return http.StatusNotFound
+	case walletmanager.ErrAccountExists:
+		return http.StatusConflict
+	case walletmanager.ErrWalletLocked:
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
+func txErrorStatus(err error) int {
+	switch err {
+	case walletmanager.ErrCannotSign, walletmanager.ErrWatchOnly, walletmanager.ErrWalletLocked:
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
+func contactErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, walletmanager.ErrContactNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, walletmanager.ErrContactExists):
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+func pdexErrorStatus(err error) int {
+	switch err {
+	case pdexservice.ErrStateNotReady:
+		return http.StatusServiceUnavailable
+	case pdexservice.ErrPoolNotFound, pdexservice.ErrOrderNotFound, pdexservice.ErrStakingPoolNotFound,
+		walletmanager.ErrAccountNotFound:
+		return http.StatusNotFound
+	case walletmanager.ErrCannotSign, walletmanager.ErrWatchOnly, walletmanager.ErrWalletLocked:
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
+func walletErrorStatus(err error) int {
+	switch err {
+	case walletmanager.ErrWrongPassphrase:
+		return http.StatusUnauthorized
+	case walletmanager.ErrWalletLocked:
+		return http.StatusForbidden
+	case walletmanager.ErrWalletEncrypted, walletmanager.ErrNotEncrypted,
+		walletmanager.ErrMasterSeedExists, walletmanager.ErrNoMasterSeed,
+		walletmanager.ErrAccountExists:
+		return http.StatusConflict
+	case walletmanager.ErrInvalidMnemonic:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
 }
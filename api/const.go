@@ -0,0 +1,16 @@
+package api
+
+import "time"
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+const (
+	eventBufferSize        = 64
+	eventKeepAliveInterval = 30 * time.Second
+)
+
+// defaultPortfolioReference is the token portfolios are valued in by default
+const defaultPortfolioReference = "USDT"
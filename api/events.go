@@ -0,0 +1,77 @@
+package api
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Event is a node event pushed to the clients of /v1/events.
+type Event struct {
+	Type string
+	Time int64
+	Data interface{}
+}
+
+// eventHub fans the events out to the connected clients. A client too slow
+// to keep up with eventBufferSize pending events misses the next ones.
+type eventHub struct {
+	lock        sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+func (hub *eventHub) subscribe() chan Event {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	if hub.subscribers == nil {
+		hub.subscribers = make(map[chan Event]struct{})
+	}
+	ch := make(chan Event, eventBufferSize)
+	hub.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (hub *eventHub) unsubscribe(ch chan Event) {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	delete(hub.subscribers, ch)
+}
+
+func (hub *eventHub) publish(event Event) {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	for ch := range hub.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// PublishEvent sends an event to every connected client without blocking.
+func (api *APIService) PublishEvent(eventType string, data interface{}) {
+	api.events.publish(Event{Type: eventType, Time: time.Now().Unix(), Data: data})
+}
+
+// StreamEvents pushes the events to the client as server-sent events until
+// it disconnects.
+func (api *APIService) StreamEvents(c *gin.Context) {
+	ch := api.events.subscribe()
+	defer api.events.unsubscribe(ch)
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event := <-ch:
+			c.SSEvent(event.Type, event)
+			return true
+		case <-time.After(eventKeepAliveInterval):
+			c.SSEvent("keepalive", Event{Type: "keepalive", Time: time.Now().Unix()})
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		case <-api.closing:
+			return false
+		}
+	})
+}
@@ -1,16 +1,25 @@
 package api
 
 import (
+	"context"
+
 	"github.com/incognitochain/go-incognito-sdk-v2/incclient"
 	"github.com/obsidianwallet/obsidian-wallet-node/common"
 )
 
+// Stop does nothing, the HTTP server is stopped by Shutdown.
 func (api *APIService) Stop() error {
 	return nil
 }
-func (api *APIService) Start() error {
+
+func (api *APIService) Start(ctx context.Context) error {
+	return nil
+}
+func (api *APIService) SetClient(incclient *incclient.IncClient) error {
+	api.incclient = incclient
 	return nil
 }
+
 func (api *APIService) SwitchNetwork(networkParam common.NetworkID, incclient *incclient.IncClient) error {
 	api.incclient = incclient
 	return nil
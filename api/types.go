@@ -1,20 +1,347 @@
 package api
 
 import (
+	"net/http"
+	"sync"
+
 	"github.com/incognitochain/go-incognito-sdk-v2/incclient"
 	"github.com/obsidianwallet/obsidian-wallet-node/common"
+	"github.com/obsidianwallet/obsidian-wallet-node/pdexservice"
+	"github.com/obsidianwallet/obsidian-wallet-node/tokenregistry"
 	"github.com/obsidianwallet/obsidian-wallet-node/walletmanager"
 )
 
 type APIService struct {
-	address   string
-	incclient *incclient.IncClient
-	wlm       *walletmanager.WalletManager
+	address           string
+	incclient         *incclient.IncClient
+	wlm               *walletmanager.WalletManager
+	pdex              *pdexservice.PDexService
+	tokens            *tokenregistry.TokenRegistry
+	networkController NetworkController
+	events            eventHub
+
+	serverLock sync.Mutex
+	server     *http.Server
+	// closing is closed on Shutdown to end the event streams
+	closing chan struct{}
 }
 
 type NetworkController interface {
 	GetCurrentNetwork() string
+	GetCurrentRPC() string
 	GetNetworkList() []common.NetworkID
 	AddNetwork(networkID common.NetworkID) error
-	SwitchNetwork(network string) error
+	RemoveNetwork(network string) error
+	SwitchNetwork(network string) (*common.NetworkSwitchStatus, error)
+	GetSwitchStatus() *common.NetworkSwitchStatus
+}
+
+type AccountInfo struct {
+	Pubkey         string
+	Name           string
+	Note           string
+	Type           walletmanager.AccountType
+	PaymentAddress string
+	WatchTokens    []string
+}
+
+type AccountDetail struct {
+	AccountInfo
+	Balances map[string]uint64
+	// BalancesFormatted are the balances in tokens, for the tokens of known
+	// decimals
+	BalancesFormatted map[string]string
+	// UnverifiedBalances are the amounts received in coins whose spent status
+	// cannot be checked without the private key, as for watch-only accounts.
+	// They may have been spent and are not part of Balances.
+	UnverifiedBalances          map[string]uint64
+	UnverifiedBalancesFormatted map[string]string
+	// AmountsHidden is set for watch-only accounts without view key, their
+	// balances only count coins with public amounts
+	AmountsHidden bool
+}
+
+type CreateAccountRequest struct {
+	Name           string `binding:"required"`
+	Note           string
+	Type           walletmanager.AccountType
+	PrivateKey     string
+	PaymentAddress string
+	OTAKey         string
+	ViewKey        string
+}
+
+type UpdateAccountRequest struct {
+	Pubkey string `binding:"required"`
+	Name   string `binding:"required"`
+	Note   string
+}
+
+type SendRequest struct {
+	Account   string `binding:"required"`
+	TokenID   string
+	Receivers []SendReceiver `binding:"required"`
+	Fee       Amount
+	Memo      string
+}
+
+// SendReceiver is a receiver given by payment address or contact name.
+type SendReceiver struct {
+	PaymentAddress string
+	Contact        string
+	Amount         Amount
+}
+
+type SendResult struct {
+	TxHash string
+}
+
+type WalletStatus struct {
+	Encrypted bool
+	Locked    bool
+	HasSeed   bool
+}
+
+type EncryptWalletRequest struct {
+	Passphrase string `binding:"required"`
+}
+
+type UnlockWalletRequest struct {
+	Passphrase string `binding:"required"`
+	// Timeout is in seconds, defaults to 5 minutes
+	Timeout int64
+}
+
+type UnlockWalletResult struct {
+	UnlockedUntil int64
+}
+
+type CreateFromMnemonicRequest struct {
+	// Mnemonic is generated when empty
+	Mnemonic string
+	Name     string
+	// Accounts is the number of accounts to derive, defaults to 1
+	Accounts uint32
+}
+
+type CreateFromMnemonicResult struct {
+	Mnemonic string `json:",omitempty"`
+	Accounts []walletmanager.DerivedAccount
+}
+
+type DeriveNextRequest struct {
+	Name string
+	Note string
+}
+
+type ContactRequest struct {
+	Name    string `binding:"required"`
+	Address string `binding:"required"`
+	Note    string
+}
+
+type UpdateContactRequest struct {
+	CurrentName string `binding:"required"`
+	Name        string `binding:"required"`
+	Address     string `binding:"required"`
+	Note        string
+}
+
+type TradeRequest struct {
+	Account             string `binding:"required"`
+	TokenToSell         string `binding:"required"`
+	TokenToBuy          string `binding:"required"`
+	SellAmount          Amount
+	MinAcceptableAmount Amount
+	// FeeToken is PRV or TokenToSell, PRV by default. PDEX is only accepted
+	// when it is TokenToSell.
+	FeeToken string
+	Fee      Amount
+}
+
+type MintNFTRequest struct {
+	Account string `binding:"required"`
+	Fee     Amount
+}
+
+type ContributeRequest struct {
+	Account string `binding:"required"`
+	// PoolID is empty when creating a new pool
+	PoolID       string
+	Token0ID     string
+	Token1ID     string
+	Token0Amount Amount
+	Token1Amount Amount
+	Amplifier    uint
+	NftID        string
+	Fee          Amount
+}
+
+type WithdrawLiquidityRequest struct {
+	Account string `binding:"required"`
+	PoolID  string `binding:"required"`
+	NftID   string `binding:"required"`
+	// ShareAmount is raw only, pool shares are not a token and have no
+	// decimals to read a formatted amount with
+	ShareAmount uint64 `binding:"required"`
+	Fee         Amount
+}
+
+type ClaimLPFeesRequest struct {
+	Account string `binding:"required"`
+	PoolID  string `binding:"required"`
+	NftID   string `binding:"required"`
+	Fee     Amount
+}
+
+type PlaceOrderRequest struct {
+	Account             string `binding:"required"`
+	PoolID              string `binding:"required"`
+	TokenToSell         string `binding:"required"`
+	SellAmount          Amount
+	MinAcceptableAmount Amount
+	NftID               string
+	Fee                 Amount
+}
+
+type CancelOrderRequest struct {
+	Account string `binding:"required"`
+	OrderID string `binding:"required"`
+	Fee     Amount
+}
+
+type StakeRequest struct {
+	Account string `binding:"required"`
+	TokenID string `binding:"required"`
+	Amount  Amount
+	NftID   string
+	Fee     Amount
+}
+
+type UnstakeRequest struct {
+	Account string `binding:"required"`
+	TokenID string `binding:"required"`
+	NftID   string `binding:"required"`
+	Amount  Amount
+	Fee     Amount
+}
+
+type ClaimStakingRewardsRequest struct {
+	Account string `binding:"required"`
+	TokenID string `binding:"required"`
+	NftID   string `binding:"required"`
+	Fee     Amount
+}
+
+// WithdrawOrderRequest withdraws Amount of TokenID from the order, all the
+// order balances when TokenID is empty.
+type WithdrawOrderRequest struct {
+	Account string `binding:"required"`
+	OrderID string `binding:"required"`
+	TokenID string
+	Amount  Amount
+	Fee     Amount
+}
+
+// HistoryEntryInfo is a history entry with its amounts in tokens, the
+// formatted amounts are empty when the token decimals are unknown.
+type HistoryEntryInfo struct {
+	walletmanager.HistoryEntry
+	AmountFormatted string `json:",omitempty"`
+	FeeFormatted    string `json:",omitempty"`
+}
+
+type TradeEstimateInfo struct {
+	*pdexservice.TradeEstimate
+	SellAmountFormatted     string `json:",omitempty"`
+	ExpectedAmountFormatted string `json:",omitempty"`
+	FeeInSellTokenFormatted string `json:",omitempty"`
+	FeeInPRVFormatted       string `json:",omitempty"`
+}
+
+// PositionInfo is an LP position with its amounts in tokens. Share stays
+// raw, pool shares have no decimals.
+type PositionInfo struct {
+	pdexservice.Position
+	Token0AmountFormatted string            `json:",omitempty"`
+	Token1AmountFormatted string            `json:",omitempty"`
+	FeesFormatted         map[string]string `json:",omitempty"`
+}
+
+type LiquidityPositionsInfo struct {
+	NftIDs    []string
+	Positions []PositionInfo
+}
+
+type ContributionInfo struct {
+	pdexservice.Contribution
+	Token0AmountFormatted string `json:",omitempty"`
+	Token1AmountFormatted string `json:",omitempty"`
+	// Status replaces the raw status of Contribution
+	Status *ContributionStatusInfo `json:",omitempty"`
+}
+
+type ContributionStatusInfo struct {
+	pdexservice.ContributionStatus
+	Token0ContributedAmountFormatted string `json:",omitempty"`
+	Token0ReturnedAmountFormatted    string `json:",omitempty"`
+	Token1ContributedAmountFormatted string `json:",omitempty"`
+	Token1ReturnedAmountFormatted    string `json:",omitempty"`
+}
+
+type OrderInfo struct {
+	pdexservice.AccountOrder
+	SellAmountFormatted          string            `json:",omitempty"`
+	MinAcceptableAmountFormatted string            `json:",omitempty"`
+	SoldAmountFormatted          string            `json:",omitempty"`
+	BoughtAmountFormatted        string            `json:",omitempty"`
+	WithdrawableFormatted        map[string]string `json:",omitempty"`
+}
+
+type StakingPoolDetail struct {
+	pdexservice.StakingPoolInfo
+	LiquidityFormatted string `json:",omitempty"`
+}
+
+type StakingPositionInfo struct {
+	pdexservice.StakingPosition
+	AmountFormatted      string            `json:",omitempty"`
+	TotalStakedFormatted string            `json:",omitempty"`
+	RewardsFormatted     map[string]string `json:",omitempty"`
+}
+
+type StakingPositionsInfo struct {
+	BeaconHeight uint64
+	Positions    []StakingPositionInfo
+}
+
+type TradeResultInfo struct {
+	TxHash              string
+	TradingFee          uint64
+	TradingFeeFormatted string `json:",omitempty"`
+	FeeToken            string
+	Estimate            TradeEstimateInfo
+}
+
+type AddNetworkRequest struct {
+	Name        string   `binding:"required"`
+	RPCs        []string `binding:"required"`
+	ServiceURLs []string
+}
+
+type SwitchNetworkRequest struct {
+	Network string `binding:"required"`
+}
+
+// CurrentNetworkInfo is the network in use, Switch is the progress of the
+// last switch.
+type CurrentNetworkInfo struct {
+	Network string
+	RPC     string
+	Switch  *common.NetworkSwitchStatus `json:",omitempty"`
+}
+
+type HealthInfo struct {
+	Healthy bool
+	Workers []walletmanager.WorkerHealth
 }
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/obsidianwallet/obsidian-wallet-node/pdexservice"
+)
+
+func respondOK(c *gin.Context, result interface{}) {
+	c.JSON(http.StatusOK, gin.H{"result": result})
+}
+
+func respondError(c *gin.Context, status int, err error) {
+	c.JSON(status, gin.H{"error": err.Error()})
+}
+
+// parsePagination reads the 1-based page and the page size from the query.
+func parsePagination(c *gin.Context) (int, int, error) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		return 0, 0, errors.New("invalid page")
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPageSize)))
+	if err != nil || limit < 1 || limit > maxPageSize {
+		return 0, 0, errors.New("invalid limit")
+	}
+	return page, limit, nil
+}
+
+func buildPoolFilter(c *gin.Context) pdexservice.PoolFilter {
+	return pdexservice.PoolFilter{
+		TokenID:  c.Query("tokenid"),
+		Token0ID: c.Query("token0"),
+		Token1ID: c.Query("token1"),
+	}
+}
@@ -4,6 +4,12 @@ type Config struct {
 	ServingAddress string
 	UseNetwork     string
 	Networks       []NetworkID
+	// TokenOverrideFile lists custom tokens, tokens.json when empty
+	TokenOverrideFile string `json:",omitempty"`
+	// LegacyCoinNetwork is the network the coins of a database created
+	// before coins were stored per network were synced on. They are only
+	// migrated once it is set, and when that network is started.
+	LegacyCoinNetwork string `json:",omitempty"`
 }
 
 type NetworkID struct {
@@ -13,8 +19,34 @@ type NetworkID struct {
 }
 
 type CoinOwnerData struct {
-	Pubkey   string
-	Keyimage string
-	Value    uint64
-	Rk       string
+	Pubkey       string
+	Keyimage     string
+	Value        uint64
+	AmountHidden bool `json:",omitempty"`
+	Rk           string
+	TokenID      string
+	ShardID      int
+	Index        uint64
+}
+
+// NetworkSwitchStatus is the progress of a network switch, Step is the
+// stage it is at and Done is set once it succeeded or failed.
+type NetworkSwitchStatus struct {
+	From  string
+	To    string
+	Step  string
+	Done  bool
+	Error string `json:",omitempty"`
+	// RolledBack is set when the switch failed and every user was moved
+	// back to the From network
+	RolledBack bool `json:",omitempty"`
+	StartedAt  int64
+	FinishedAt int64 `json:",omitempty"`
+}
+
+// RPCFailoverEvent is emitted when the chain client moves to another RPC.
+type RPCFailoverEvent struct {
+	Network string
+	From    string
+	To      string
 }
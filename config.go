@@ -3,14 +3,18 @@ package main
 import (
 	"encoding/json"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 
 	"github.com/obsidianwallet/obsidian-wallet-node/common"
 )
 
+const configFile = "config.json"
+
 var cfg common.Config
 
 func loadConfig() error {
-	config, err := ioutil.ReadFile("config.json")
+	config, err := ioutil.ReadFile(configFile)
 	if err != nil {
 		return err
 	}
@@ -21,11 +25,33 @@ func loadConfig() error {
 	return nil
 }
 
+// updateConfigFile writes cfg to a temporary file next to config.json and
+// renames it over config.json, so a crash never leaves a truncated config.
 func updateConfigFile() error {
-	file, _ := json.MarshalIndent(cfg, "", " ")
-	err := ioutil.WriteFile("config.json", file, 0644)
+	file, err := json.MarshalIndent(cfg, "", " ")
 	if err != nil {
 		return err
 	}
-	return nil
+	tmp, err := ioutil.TempFile(filepath.Dir(configFile), filepath.Base(configFile)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+	if _, err := tmp.Write(file); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, configFile)
 }
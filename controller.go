@@ -1,34 +1,91 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"regexp"
 	"sync"
+	"time"
 
 	"github.com/incognitochain/go-incognito-sdk-v2/incclient"
 	"github.com/obsidianwallet/obsidian-wallet-node/common"
+	"github.com/rs/zerolog/log"
 )
 
+const (
+	switchStepPending     = "pending"
+	switchStepStopping    = "stopping"
+	switchStepConnecting  = "connecting"
+	switchStepSwitching   = "switching"
+	switchStepStarting    = "starting"
+	switchStepDone        = "done"
+	switchStepFailed      = "failed"
+	switchStepRollingBack = "rollingback"
+)
+
+const (
+	eventNetworkSwitch = "network_switch"
+	eventRPCFailover   = "rpc_failover"
+)
+
+// network names are part of database keys joined with -
+var networkNameRegex = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
 type NetworkController struct {
 	currentNetwork string
 	networkList    map[string]common.NetworkID
 	lock           sync.Mutex
 	incclient      *incclient.IncClient
 	networkUsers   []NetworkUserInterface
+
+	currentRPC string
+	rpcStatus  map[string]*RPCStatus
+	// checkNow wakes the RPC monitor up when the RPC in use fails calls
+	checkNow chan struct{}
+
+	// ctx is cancelled by Stop, workers are the RPC monitor and the
+	// network switch in progress
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+
+	// switchLock serializes network switches and RPC failovers, which
+	// take too long to hold lock
+	switchLock   sync.Mutex
+	switchStatus *common.NetworkSwitchStatus
+	eventHandler func(eventType string, data interface{})
 }
 
 type NetworkUserInterface interface {
+	// Stop returns once every worker of the user exited
 	Stop() error
-	Start() error
+	// Start runs the workers of the user until Stop is called or ctx is
+	// cancelled
+	Start(ctx context.Context) error
 	SwitchNetwork(networkParam common.NetworkID, incclient *incclient.IncClient) error
+	// SetClient replaces the chain client of the current network after an
+	// RPC failover, without stopping the user
+	SetClient(incclient *incclient.IncClient) error
+}
+
+// rpcErrorReporter is implemented by the network users making chain calls,
+// their failed calls count against the health of the RPC in use.
+type rpcErrorReporter interface {
+	SetRPCErrorHandler(handler func(client *incclient.IncClient, err error))
 }
 
 func NewNetworkController(currentNetwork string, networkList []common.NetworkID) (*NetworkController, error) {
 
 	nwctrl := &NetworkController{
 		networkList: make(map[string]common.NetworkID),
+		checkNow:    make(chan struct{}, 1),
 	}
 
 	for _, v := range networkList {
+		if !networkNameRegex.MatchString(v.Name) {
+			return nil, fmt.Errorf("invalid network name %q in config, only letters, digits and _ are allowed", v.Name)
+		}
 		nwctrl.networkList[v.Name] = v
 	}
 
@@ -36,12 +93,14 @@ func NewNetworkController(currentNetwork string, networkList []common.NetworkID)
 		return nil, fmt.Errorf("Network %s not found", currentNetwork)
 	}
 
-	incClient, err := initChainClient(nwctrl.networkList[currentNetwork])
+	incClient, rpc, statuses, err := connectNetwork(nwctrl.networkList[currentNetwork])
 	if err != nil {
 		return nil, fmt.Errorf("can't use %s network, error: %v", currentNetwork, err)
 	}
 	nwctrl.currentNetwork = currentNetwork
 	nwctrl.incclient = incClient
+	nwctrl.currentRPC = rpc
+	nwctrl.rpcStatus = statuses
 
 	return nwctrl, nil
 }
@@ -57,17 +116,34 @@ func (n *NetworkController) GetNetworkList() []common.NetworkID {
 }
 
 func (n *NetworkController) GetCurrentNetwork() string {
+	n.lock.Lock()
+	defer n.lock.Unlock()
 	return n.currentNetwork
 }
 
+// AddNetwork saves a new network to the config once one of its RPCs is
+// reachable and reports a sane chain.
 func (n *NetworkController) AddNetwork(networkID common.NetworkID) error {
+	if !networkNameRegex.MatchString(networkID.Name) {
+		return fmt.Errorf("invalid network name %q, only letters, digits and _ are allowed", networkID.Name)
+	}
+	n.lock.Lock()
+	_, exists := n.networkList[networkID.Name]
+	n.lock.Unlock()
+	if exists {
+		return fmt.Errorf("network %s already exists", networkID.Name)
+	}
+	// checked outside the lock, it can take up to rpcCheckTimeout
+	if err := validateNetwork(networkID); err != nil {
+		return err
+	}
+
 	n.lock.Lock()
 	defer n.lock.Unlock()
-	if _, ok := n.networkList[networkID.Name]; !ok {
-		n.networkList[networkID.Name] = networkID
-	} else {
+	if _, ok := n.networkList[networkID.Name]; ok {
 		return fmt.Errorf("network %s already exists", networkID.Name)
 	}
+	n.networkList[networkID.Name] = networkID
 	cfg.Networks = append(cfg.Networks, networkID)
 	return updateConfigFile()
 }
@@ -78,44 +154,136 @@ func (n *NetworkController) RemoveNetwork(network string) error {
 	if network == n.currentNetwork {
 		return fmt.Errorf("network %s is currently in use", network)
 	}
-	if _, ok := n.networkList[network]; ok {
-		delete(n.networkList, network)
+	if n.switchStatus != nil && !n.switchStatus.Done && n.switchStatus.To == network {
+		return fmt.Errorf("network %s is being switched to", network)
+	}
+	if _, ok := n.networkList[network]; !ok {
+		return fmt.Errorf("network %s not found", network)
 	}
+	delete(n.networkList, network)
 	for idx, v := range cfg.Networks {
 		if v.Name == network {
 			cfg.Networks = append(cfg.Networks[:idx], cfg.Networks[idx+1:]...)
-			return nil
+			break
 		}
 	}
 	return updateConfigFile()
 }
 
-func (n *NetworkController) SwitchNetwork(network string) error {
+// SwitchNetwork starts switching every network user to network in the
+// background, the returned status is updated as the switch goes on.
+func (n *NetworkController) SwitchNetwork(network string) (*common.NetworkSwitchStatus, error) {
 	n.lock.Lock()
 	defer n.lock.Unlock()
 	networkID, ok := n.networkList[network]
 	if !ok {
-		return fmt.Errorf("network %s not found", network)
+		return nil, fmt.Errorf("network %s not found", network)
+	}
+	if n.switchStatus != nil && !n.switchStatus.Done {
+		return nil, fmt.Errorf("switch to network %s is in progress", n.switchStatus.To)
+	}
+	if network == n.currentNetwork {
+		return nil, fmt.Errorf("network %s is already in use", network)
+	}
+	if n.ctx == nil || n.ctx.Err() != nil {
+		return nil, errors.New("network controller is not running")
+	}
+	n.switchStatus = &common.NetworkSwitchStatus{
+		From:      n.currentNetwork,
+		To:        network,
+		Step:      switchStepPending,
+		StartedAt: time.Now().Unix(),
 	}
+	n.emitSwitchEvent()
+	status := *n.switchStatus
+	n.workers.Add(1)
+	go n.switchNetwork(n.ctx, networkID)
+	return &status, nil
+}
+
+// GetSwitchStatus returns the progress of the last network switch, nil if
+// there was none.
+func (n *NetworkController) GetSwitchStatus() *common.NetworkSwitchStatus {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.switchStatus == nil {
+		return nil
+	}
+	status := *n.switchStatus
+	return &status
+}
+
+// switchNetwork moves every user to networkID as one transaction: on any
+// failure they are all moved back to the previous network. UseNetwork is
+// only saved once the switch succeeded, so a crash midway restarts on the
+// previous network.
+func (n *NetworkController) switchNetwork(ctx context.Context, networkID common.NetworkID) {
+	defer n.workers.Done()
+	n.switchLock.Lock()
+	defer n.switchLock.Unlock()
+
+	n.lock.Lock()
+	previous := n.networkList[n.currentNetwork]
+	previousClient := n.incclient
+	previousRPC := n.currentRPC
+	previousStatus := n.rpcStatus
+	n.lock.Unlock()
+
+	err := n.runSwitch(ctx, networkID)
+	if err == nil {
+		err = n.saveCurrentNetwork(networkID.Name)
+	}
+	if err == nil {
+		n.finishSwitch(switchStepDone, nil, false)
+		return
+	}
+	log.Error().Msgf("switch to network %v failed: %v", networkID.Name, err)
+
+	n.setSwitchStep(switchStepRollingBack)
+	n.lock.Lock()
+	n.currentNetwork = previous.Name
+	n.incclient = previousClient
+	n.currentRPC = previousRPC
+	n.rpcStatus = previousStatus
+	n.lock.Unlock()
+	if rollbackErr := n.restoreUsers(ctx, previous, previousClient); rollbackErr != nil {
+		log.Error().Msgf("rollback to network %v failed: %v", previous.Name, rollbackErr)
+		n.finishSwitch(switchStepFailed, fmt.Errorf("%v, rollback to %v failed: %v", err, previous.Name, rollbackErr), false)
+		return
+	}
+	n.finishSwitch(switchStepFailed, err, true)
+}
+
+func (n *NetworkController) runSwitch(ctx context.Context, networkID common.NetworkID) error {
+	n.setSwitchStep(switchStepStopping)
 	for _, v := range n.networkUsers {
 		err := v.Stop()
 		if err != nil {
 			return err
 		}
 	}
-	incClient, err := initChainClient(networkID)
+	n.setSwitchStep(switchStepConnecting)
+	incClient, rpc, statuses, err := connectNetwork(networkID)
 	if err != nil {
 		return err
 	}
-	n.incclient = incClient
+	n.setSwitchStep(switchStepSwitching)
 	for _, v := range n.networkUsers {
 		err := v.SwitchNetwork(networkID, incClient)
 		if err != nil {
 			return err
 		}
 	}
+	n.lock.Lock()
+	n.currentNetwork = networkID.Name
+	n.incclient = incClient
+	n.currentRPC = rpc
+	n.rpcStatus = statuses
+	n.lock.Unlock()
+
+	n.setSwitchStep(switchStepStarting)
 	for _, v := range n.networkUsers {
-		err := v.Start()
+		err := v.Start(ctx)
 		if err != nil {
 			return err
 		}
@@ -123,14 +291,118 @@ func (n *NetworkController) SwitchNetwork(network string) error {
 	return nil
 }
 
+// restoreUsers puts every user back on network whatever state the failed
+// switch left it in. Stop errors are ignored, some users are already
+// stopped.
+func (n *NetworkController) restoreUsers(ctx context.Context, network common.NetworkID, incClient *incclient.IncClient) error {
+	for _, v := range n.networkUsers {
+		if err := v.Stop(); err != nil {
+			log.Warn().Msgf("stop network user failed during rollback: %v", err)
+		}
+	}
+	for _, v := range n.networkUsers {
+		if err := v.SwitchNetwork(network, incClient); err != nil {
+			return err
+		}
+	}
+	for _, v := range n.networkUsers {
+		if err := v.Start(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *NetworkController) saveCurrentNetwork(network string) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	previous := cfg.UseNetwork
+	cfg.UseNetwork = network
+	if err := updateConfigFile(); err != nil {
+		cfg.UseNetwork = previous
+		return err
+	}
+	return nil
+}
+
+func (n *NetworkController) setSwitchStep(step string) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.switchStatus.Step = step
+	n.emitSwitchEvent()
+}
+
+func (n *NetworkController) finishSwitch(step string, err error, rolledBack bool) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.switchStatus.Step = step
+	n.switchStatus.Done = true
+	n.switchStatus.RolledBack = rolledBack
+	n.switchStatus.FinishedAt = time.Now().Unix()
+	if err != nil {
+		n.switchStatus.Error = err.Error()
+	}
+	n.emitSwitchEvent()
+}
+
+// SetEventHandler sets the function receiving the switch and failover
+// events, it must not block.
+func (n *NetworkController) SetEventHandler(handler func(eventType string, data interface{})) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.eventHandler = handler
+}
+
+// emitEvent passes an event to the event handler. The caller holds n.lock.
+func (n *NetworkController) emitEvent(eventType string, data interface{}) {
+	if n.eventHandler != nil {
+		n.eventHandler(eventType, data)
+	}
+}
+
+func (n *NetworkController) emitSwitchEvent() {
+	status := *n.switchStatus
+	n.emitEvent(eventNetworkSwitch, status)
+}
+
 func (n *NetworkController) AddNetworkUser(networkUser NetworkUserInterface) {
 	n.networkUsers = append(n.networkUsers, networkUser)
+	if reporter, ok := networkUser.(rpcErrorReporter); ok {
+		reporter.SetRPCErrorHandler(n.ReportRPCError)
+	}
 }
 
-func (n *NetworkController) Start() error {
+// Start moves the users to the current network and runs them and the RPC
+// monitor until Stop is called or ctx is cancelled. When a user fails to
+// start, the ones already started are stopped and the controller is left
+// stopped.
+func (n *NetworkController) Start(ctx context.Context) error {
 	n.lock.Lock()
 	defer n.lock.Unlock()
+	if n.cancel != nil {
+		return nil
+	}
+	n.ctx, n.cancel = context.WithCancel(ctx)
+
+	err := n.startUsers()
+	if err != nil {
+		n.cancel()
+		for idx := len(n.networkUsers) - 1; idx >= 0; idx-- {
+			if stopErr := n.networkUsers[idx].Stop(); stopErr != nil {
+				log.Warn().Msgf("stop network user failed after start error: %v", stopErr)
+			}
+		}
+		n.ctx, n.cancel = nil, nil
+		return err
+	}
+	n.workers.Add(1)
+	go n.monitorRPCs(n.ctx)
+	return nil
+}
 
+// startUsers moves the users to the current network and starts them. The
+// caller holds n.lock.
+func (n *NetworkController) startUsers() error {
 	for _, v := range n.networkUsers {
 		err := v.SwitchNetwork(n.networkList[n.currentNetwork], n.incclient)
 		if err != nil {
@@ -138,10 +410,55 @@ func (n *NetworkController) Start() error {
 		}
 	}
 	for _, v := range n.networkUsers {
-		err := v.Start()
+		err := v.Start(n.ctx)
 		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// Stop cancels the RPC monitor and the switch in progress, then stops the
+// users in the reverse order they were added. It returns once they all
+// exited.
+func (n *NetworkController) Stop() error {
+	n.lock.Lock()
+	cancel := n.cancel
+	n.cancel = nil
+	n.lock.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	n.workers.Wait()
+
+	var firstErr error
+	for idx := len(n.networkUsers) - 1; idx >= 0; idx-- {
+		if err := n.networkUsers[idx].Stop(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// connectNetwork creates a chain client on the healthiest RPC of network,
+// trying the others in order when it fails.
+func connectNetwork(network common.NetworkID) (*incclient.IncClient, string, map[string]*RPCStatus, error) {
+	if len(network.RPCs) == 0 {
+		return nil, "", nil, fmt.Errorf("network %s has no RPC endpoint", network.Name)
+	}
+	statuses := checkRPCs(network.RPCs, nil)
+	candidates := network.RPCs
+	if best := selectRPC(statuses); best != "" {
+		candidates = append([]string{best}, network.RPCs...)
+	}
+	var lastErr error
+	for _, rpc := range candidates {
+		incClient, err := initChainClient(network, rpc)
+		if err == nil {
+			return incClient, rpc, statuses, nil
+		}
+		lastErr = err
+	}
+	return nil, "", nil, lastErr
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/obsidianwallet/obsidian-wallet-node/common"
+)
+
+func TestNewNetworkControllerNetworkName(t *testing.T) {
+	for _, name := range []string{"main-net", "test net", ""} {
+		networks := []common.NetworkID{{Name: "mainnet"}, {Name: name}}
+		if _, err := NewNetworkController("mainnet", networks); err == nil {
+			t.Errorf("network %q accepted", name)
+		}
+	}
+}
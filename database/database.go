@@ -27,6 +27,10 @@ const (
 
 	// Default BadgerDB GC interval
 	badgerGCInterval = 10 * time.Minute
+
+	// BadgerDB discardRatio of Compact, low so that any value log file
+	// holding a stale value is rewritten
+	badgerCompactDiscardRatio = 0.01
 )
 
 var (
@@ -118,6 +122,24 @@ func (bdb *BadgerDB) Delete(namespace, key []byte) error {
 	return nil
 }
 
+// Update implements the DB interface. It stores objs and deletes deleteKeys of
+// a namespace in a single batch.
+func (bdb *BadgerDB) Update(namespace []byte, objs []Object, deleteKeys [][]byte) error {
+	batch := bdb.db.NewWriteBatch()
+	defer batch.Cancel()
+	for _, key := range deleteKeys {
+		if err := batch.Delete(badgerNamespaceKey(namespace, key)); err != nil {
+			return err
+		}
+	}
+	for _, obj := range objs {
+		if err := batch.Set(badgerNamespaceKey(namespace, obj.Key), obj.Value); err != nil {
+			return err
+		}
+	}
+	return batch.Flush()
+}
+
 func (bdb *BadgerDB) DeleteNamespace(namespace []byte) error {
 	batch := bdb.db.NewWriteBatch()
 	err := bdb.db.Update(func(txn *badger.Txn) error {
@@ -128,8 +150,9 @@ func (bdb *BadgerDB) DeleteNamespace(namespace []byte) error {
 		defer it.Close()
 
 		for it.Rewind(); it.Valid(); it.Next() {
-			item := it.Item()
-			k := item.Key()
+			// the batch keeps the key past the iterator, which reuses
+			// the buffer of Key
+			k := it.Item().KeyCopy(nil)
 
 			if err := batch.Delete(k); err != nil {
 				return err
@@ -171,8 +194,8 @@ func (bdb *BadgerDB) ReadIteratorCopy(prefix []byte, reverse bool, action func(k
 				}
 			}
 		} else {
-			prefix := append(prefix, 0xFF)
-			for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			seekKey := append(append([]byte{}, prefix...), 0xFF)
+			for it.Seek(seekKey); it.ValidForPrefix(prefix); it.Next() {
 				item := it.Item()
 				k := item.Key()
 				v, err := item.ValueCopy(nil)
@@ -209,10 +232,7 @@ func (bdb *BadgerDB) ReadIteratorNonCopy(prefix []byte, reverse bool, action fun
 				err := item.Value(func(v []byte) error {
 					var err error
 					willStop, err = action(k, v)
-					if err != nil {
-						log.Fatal(err)
-					}
-					return nil
+					return err
 				})
 				if err != nil {
 					return err
@@ -222,17 +242,14 @@ func (bdb *BadgerDB) ReadIteratorNonCopy(prefix []byte, reverse bool, action fun
 				}
 			}
 		} else {
-			prefix := append(prefix, 0xFF)
-			for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			seekKey := append(append([]byte{}, prefix...), 0xFF)
+			for it.Seek(seekKey); it.ValidForPrefix(prefix); it.Next() {
 				item := it.Item()
 				k := item.Key()
 				err := item.Value(func(v []byte) error {
 					var err error
 					willStop, err = action(k, v)
-					if err != nil {
-						log.Fatal(err)
-					}
-					return nil
+					return err
 				})
 				if err != nil {
 					return err
@@ -293,6 +310,26 @@ func (bdb *BadgerDB) runGC() {
 	}
 }
 
+// Compact implements the DB interface. It compacts the LSM tree into a single
+// level and rewrites the value log so that overwritten and deleted values are
+// removed from disk. Values still in the memtable and its write-ahead log are
+// only removed once it is flushed to a table, which happens when it is full
+// or the database is closed.
+func (bdb *BadgerDB) Compact() error {
+	if err := bdb.db.Flatten(1); err != nil {
+		return err
+	}
+	for {
+		err := bdb.db.RunValueLogGC(badgerCompactDiscardRatio)
+		if err == badger.ErrNoRewrite {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
 func (bdb *BadgerDB) CreateULID(t time.Time) ([]byte, error) {
 	id, _ := bdb.ulidSource.New(t)
 	return id.MarshalBinary()
@@ -21,7 +21,9 @@ type (
 		Get(namespace, key []byte) (value []byte, err error)
 		Set(namespace []byte, objs []Object) error
 		Delete(namespace, key []byte) error
+		Update(namespace []byte, objs []Object, deleteKeys [][]byte) error
 		DeleteNamespace(namespace []byte) error
+		Compact() error
 		ReadIteratorCopy(prefix []byte, reverse bool, action func(k []byte, v []byte) (bool, error)) error
 		ReadIteratorNonCopy(prefix []byte, reverse bool, action func(k []byte, v []byte) (willStop bool, err error)) error
 		Has(namespace, key []byte) (bool, error)
@@ -9,6 +9,8 @@ require (
 	github.com/gin-gonic/gin v1.8.1
 	github.com/incognitochain/go-incognito-sdk-v2 v1.0.1-beta
 	github.com/oklog/ulid/v2 v2.0.2
+	github.com/rs/zerolog v1.27.0
+	golang.org/x/crypto v0.0.0-20210711020723-a769d52b0f97
 )
 
 require (
@@ -53,7 +55,6 @@ require (
 	github.com/pelletier/go-toml/v2 v2.0.1 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/prometheus/tsdb v0.7.1 // indirect
-	github.com/rs/zerolog v1.27.0 // indirect
 	github.com/shirou/gopsutil v3.21.4-0.20210419000835-c7a38de76ee5+incompatible // indirect
 	github.com/syndtr/goleveldb v1.0.1-0.20210305035536-64b5b1c73954 // indirect
 	github.com/tklauser/go-sysconf v0.3.5 // indirect
@@ -62,7 +63,6 @@ require (
 	github.com/ugorji/go/codec v1.2.7 // indirect
 	github.com/wemeetagain/go-hdwallet v0.1.0 // indirect
 	go.opencensus.io v0.22.5 // indirect
-	golang.org/x/crypto v0.0.0-20210711020723-a769d52b0f97 // indirect
 	golang.org/x/net v0.0.0-20210226172049-e18ecbb05110 // indirect
 	golang.org/x/sys v0.0.0-20220704084225-05e143d24a9e // indirect
 	golang.org/x/text v0.3.6 // indirect
@@ -1,6 +1,11 @@
 package main
 
 import (
+	"context"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
@@ -9,9 +14,14 @@ import (
 	"github.com/obsidianwallet/obsidian-wallet-node/common"
 	"github.com/obsidianwallet/obsidian-wallet-node/database"
 	"github.com/obsidianwallet/obsidian-wallet-node/pdexservice"
+	"github.com/obsidianwallet/obsidian-wallet-node/tokenregistry"
 	"github.com/obsidianwallet/obsidian-wallet-node/walletmanager"
 )
 
+// shutdownTimeout is how long requests in progress may take to finish on
+// shutdown
+const shutdownTimeout = 15 * time.Second
+
 func main() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 	err := loadConfig()
@@ -28,17 +38,22 @@ func main() {
 		log.Fatal().Msg(err.Error())
 	}
 
-	wlm, err := walletmanager.InitWallet(db)
+	wlm, err := walletmanager.InitWallet(db, cfg.LegacyCoinNetwork)
 	if err != nil {
 		log.Fatal().Msg(err.Error())
 	}
 
-	pdex, err := pdexservice.InitPDexService()
+	tokens, err := tokenregistry.InitTokenRegistry(db, cfg.TokenOverrideFile)
 	if err != nil {
 		log.Fatal().Msg(err.Error())
 	}
 
-	apis, err := api.InitAPIService(common.DefaultConfig.ServingAddress, wlm, netwrokController)
+	pdex, err := pdexservice.InitPDexService(db, wlm, tokens)
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+
+	apis, err := api.InitAPIService(common.DefaultConfig.ServingAddress, wlm, pdex, tokens, netwrokController)
 	if err != nil {
 		log.Fatal().Msg(err.Error())
 	}
@@ -46,20 +61,51 @@ func main() {
 	netwrokController.AddNetworkUser(wlm)
 	netwrokController.AddNetworkUser(apis)
 	netwrokController.AddNetworkUser(pdex)
+	netwrokController.AddNetworkUser(tokens)
+	netwrokController.SetEventHandler(apis.PublishEvent)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	err = netwrokController.Start()
+	err = netwrokController.Start(ctx)
 	if err != nil {
 		log.Fatal().Msg(err.Error())
 	}
 
-	err = apis.Serve()
-	if err != nil {
-		log.Fatal().Msg(err.Error())
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- apis.Serve()
+	}()
+	select {
+	case <-ctx.Done():
+		log.Info().Msg("shutting down...")
+	case err := <-serveErr:
+		if err != nil {
+			log.Error().Msgf("api service stopped: %v", err)
+		}
+	}
+	shutdown(apis, netwrokController, db)
+}
+
+// shutdown stops the HTTP server first so no request reaches a stopped
+// service, then the network users, then closes the database.
+func shutdown(apis *api.APIService, netwrokController *NetworkController, db *database.Database) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := apis.Shutdown(ctx); err != nil {
+		log.Error().Msgf("api service shutdown failed: %v", err)
+	}
+	if err := netwrokController.Stop(); err != nil {
+		log.Error().Msgf("network users stop failed: %v", err)
+	}
+	if err := db.DB.Close(); err != nil {
+		log.Error().Msgf("database close failed: %v", err)
 	}
+	log.Info().Msg("shutdown complete")
 }
 
-func initChainClient(network common.NetworkID) (*incclient.IncClient, error) {
-	incClient, err := incclient.NewIncClientWithCache(network.RPC, incclient.MainNetETHHost, 2, network.Name)
+func initChainClient(network common.NetworkID, rpc string) (*incclient.IncClient, error) {
+	incClient, err := incclient.NewIncClientWithCache(rpc, incclient.MainNetETHHost, 2, network.Name)
 	if err != nil {
 		return nil, err
 	}
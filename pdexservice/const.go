@@ -0,0 +1,67 @@
+package pdexservice
+
+import "time"
+
+const (
+	dbPdexStatePrefix        = "pdex-state-"
+	dbPdexContributionPrefix = "pdex-contrib-"
+	dbPdexOrderPrefix        = "pdex-order-"
+	dbPdexStakingPrefix      = "pdex-staking-"
+	dbPdexPortfolioPrefix    = "pdex-portfolio-"
+)
+
+const (
+	refreshStateInterval     = 30 * time.Second
+	contributionStatusWindow = 24 * time.Hour
+	// orderPendingTimeout is how long an order may stay out of the book
+	// after being sent before it is considered rejected
+	orderPendingTimeout = 10 * time.Minute
+
+	portfolioSnapshotInterval  = time.Hour
+	portfolioSnapshotRetention = 365 * 24 * time.Hour
+)
+
+const (
+	PDEXTokenID = "0000000000000000000000000000000000000000000000000000000000000006"
+)
+
+// pDEX v3 metadata types
+const (
+	pdexv3AddLiquidityRequestMeta      = 281
+	pdexv3WithdrawLiquidityRequestMeta = 283
+	pdexv3TradeRequestMeta             = 285
+	pdexv3AddOrderRequestMeta          = 287
+	pdexv3WithdrawOrderRequestMeta     = 289
+	pdexv3UserMintNftRequestMeta       = 291
+	pdexv3StakingRequestMeta           = 295
+	pdexv3UnstakingRequestMeta         = 297
+	pdexv3WithdrawLPFeeRequestMeta     = 299
+	pdexv3WithdrawStakingRewardMeta    = 306
+)
+
+const (
+	// otaReceiverType prefixes serialized OTA receivers, after the key types
+	// of the wallet package
+	otaReceiverType = byte(0x4)
+
+	maxTradeHops   = 3
+	bpsDenominator = 10000
+)
+
+const (
+	// pdexv3PoolsVerbosity asks for the pools, params and staking pools
+	// without their shares, orders and stakers
+	pdexv3PoolsVerbosity = 1
+	// pdexv3StateVerbosity asks for shares, orders and stakers along with the
+	// pools, only needed while an account holds an access NFT
+	pdexv3StateVerbosity = 3
+	// lpFeesPerShareBase is the precision of the LP fees per share
+	lpFeesPerShareBase = 1e18
+	// minAmplifier is the amplifier of a pool without amplification
+	minAmplifier = 10000
+
+	tradeDirectionSell0 = byte(0)
+)
+
+// portfolioReferenceSymbols are the tokens portfolio snapshots are valued in
+var portfolioReferenceSymbols = []string{"USDT", "PRV"}
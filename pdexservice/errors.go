@@ -0,0 +1,21 @@
+package pdexservice
+
+import "errors"
+
+var (
+	ErrStateNotReady       = errors.New("pdex state is not available yet")
+	ErrNoRoute             = errors.New("no trade route between the tokens")
+	ErrMinAmountRequired   = errors.New("min acceptable amount is required")
+	ErrBelowMinAcceptable  = errors.New("expected amount is below the min acceptable amount")
+	ErrInvalidFeeToken     = errors.New("trading fee must be paid in PRV or in the sold token")
+	ErrPDEXFeeNotSold      = errors.New("trading fee can only be paid in PDEX when selling PDEX")
+	ErrPoolNotFound        = errors.New("pool not found")
+	ErrNoAccessNFT         = errors.New("account holds no pDEX access NFT, mint one first")
+	ErrNFTNotOwned         = errors.New("access NFT is not held by the account")
+	ErrNoShare             = errors.New("access NFT has no share in the pool")
+	ErrOrderNotFound       = errors.New("order not found")
+	ErrNothingToWithdraw   = errors.New("order has nothing to withdraw")
+	ErrStakingPoolNotFound = errors.New("staking pool not found")
+	ErrNotStaking          = errors.New("access NFT has nothing staked in the pool")
+	ErrUnknownReference    = errors.New("unknown reference token")
+)
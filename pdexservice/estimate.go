@@ -0,0 +1,216 @@
+package pdexservice
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/incognitochain/go-incognito-sdk-v2/common"
+)
+
+type TradeEstimate struct {
+	TokenToSell string
+	TokenToBuy  string
+	SellAmount  uint64
+	// Route is the list of pools the trade goes through, TokenRoute the
+	// tokens it goes through
+	Route          []string
+	TokenRoute     []string
+	ExpectedAmount uint64
+	// PriceImpact is in percent of the mid price output
+	PriceImpact float64
+	// FeeRateBPS is the sum of the fee rates of the route pools. For a
+	// multi-hop route it approximates the rate the beacon charges, the min
+	// acceptable amount of the trade bounds the difference.
+	FeeRateBPS uint
+	// FeeInSellToken is the trading fee paid with the sold token, FeeInPRV
+	// the fee paid with PRV after discount, 0 if there is no PRV route
+	FeeInSellToken uint64
+	FeeInPRV       uint64
+}
+
+type tradeRoute struct {
+	pools  []string
+	tokens []string
+	output uint64
+}
+
+// EstimateTrade finds the route through up to maxTradeHops pools giving the
+// most of tokenToBuy for amount of tokenToSell, using the cached reserves.
+func (pdexServ *PDexService) EstimateTrade(tokenToSell string, tokenToBuy string, amount uint64) (*TradeEstimate, error) {
+	if amount == 0 {
+		return nil, errors.New("sell amount must be greater than 0")
+	}
+	if tokenToSell == tokenToBuy {
+		return nil, errors.New("cannot trade a token for itself")
+	}
+	state, err := pdexServ.getState()
+	if err != nil {
+		return nil, err
+	}
+	return estimateTrade(state, tokenToSell, tokenToBuy, amount)
+}
+
+func estimateTrade(state *Pdexv3State, tokenToSell string, tokenToBuy string, amount uint64) (*TradeEstimate, error) {
+	route := findBestRoute(state, tokenToSell, tokenToBuy, amount)
+	if route == nil {
+		return nil, ErrNoRoute
+	}
+
+	result := &TradeEstimate{
+		TokenToSell:    tokenToSell,
+		TokenToBuy:     tokenToBuy,
+		SellAmount:     amount,
+		Route:          route.pools,
+		TokenRoute:     route.tokens,
+		ExpectedAmount: route.output,
+	}
+	midOutput := new(big.Float).SetUint64(amount)
+	for idx, poolID := range route.pools {
+		pool := state.PoolPairs[poolID]
+		midOutput.Mul(midOutput, pool.midPrice(route.tokens[idx]))
+		result.FeeRateBPS += state.poolFeeRate(poolID)
+	}
+	if midOutput.Sign() > 0 {
+		ratio, _ := new(big.Float).Quo(new(big.Float).SetUint64(route.output), midOutput).Float64()
+		result.PriceImpact = (1 - ratio) * 100
+	}
+
+	feeInSellToken := new(big.Int).SetUint64(amount)
+	feeInSellToken.Mul(feeInSellToken, new(big.Int).SetUint64(uint64(result.FeeRateBPS)))
+	result.FeeInSellToken = ceilDiv(feeInSellToken, big.NewInt(bpsDenominator))
+
+	feeInPRV := result.FeeInSellToken
+	if tokenToSell != common.PRVIDStr {
+		feeInPRV = 0
+		if feeRoute := findBestRoute(state, tokenToSell, common.PRVIDStr, result.FeeInSellToken); feeRoute != nil {
+			// converted at the mid price so the fee does not pay price impact
+			converted := new(big.Float).SetUint64(result.FeeInSellToken)
+			for idx, poolID := range feeRoute.pools {
+				converted.Mul(converted, state.PoolPairs[poolID].midPrice(feeRoute.tokens[idx]))
+			}
+			convertedInt, _ := converted.Int(nil)
+			feeInPRV = convertedInt.Uint64() + 1
+		}
+	}
+	if feeInPRV > 0 && state.Params.PRVDiscountPercent <= 100 {
+		discounted := new(big.Int).SetUint64(feeInPRV)
+		discounted.Mul(discounted, big.NewInt(int64(100-state.Params.PRVDiscountPercent)))
+		result.FeeInPRV = ceilDiv(discounted, big.NewInt(100))
+	}
+	return result, nil
+}
+
+// findBestRoute walks the pool graph from tokenToSell and returns the route
+// with the highest output, nil if tokenToBuy cannot be reached.
+func findBestRoute(state *Pdexv3State, tokenToSell string, tokenToBuy string, amount uint64) *tradeRoute {
+	poolsByToken := state.poolsByToken()
+
+	var best *tradeRoute
+	var walk func(route tradeRoute, amountIn uint64)
+	walk = func(route tradeRoute, amountIn uint64) {
+		current := route.tokens[len(route.tokens)-1]
+		for _, poolID := range poolsByToken[current] {
+			pool := state.PoolPairs[poolID]
+			next := pool.otherToken(current)
+			if containsToken(route.tokens, next) {
+				continue
+			}
+			amountOut, err := pool.swap(current, amountIn)
+			if err != nil || amountOut == 0 {
+				continue
+			}
+			nextRoute := tradeRoute{
+				pools:  append(append([]string{}, route.pools...), poolID),
+				tokens: append(append([]string{}, route.tokens...), next),
+				output: amountOut,
+			}
+			if next == tokenToBuy {
+				if best == nil || nextRoute.output > best.output {
+					best = &nextRoute
+				}
+				continue
+			}
+			if len(nextRoute.pools) < maxTradeHops {
+				walk(nextRoute, amountOut)
+			}
+		}
+	}
+	walk(tradeRoute{tokens: []string{tokenToSell}}, amount)
+	return best
+}
+
+// swap returns the amount of the other token bought with amountIn of
+// tokenIn, following the amplified constant product on virtual reserves.
+func (pool *PoolPairState) swap(tokenIn string, amountIn uint64) (uint64, error) {
+	virtualIn, virtualOut, realOut := pool.reserves(tokenIn)
+	if virtualIn == nil || virtualOut == nil {
+		return 0, errors.New("pool has no virtual reserves")
+	}
+	in := new(big.Int).SetUint64(amountIn)
+	num := new(big.Int).Mul(virtualOut, in)
+	den := new(big.Int).Add(virtualIn, in)
+	out := num.Div(num, den)
+	if !out.IsUint64() || out.Uint64() > realOut {
+		return 0, fmt.Errorf("insufficient liquidity in pool")
+	}
+	return out.Uint64(), nil
+}
+
+// midPrice is the amount of the other token one unit of tokenIn is worth
+// without price impact.
+func (pool *PoolPairState) midPrice(tokenIn string) *big.Float {
+	virtualIn, virtualOut, _ := pool.reserves(tokenIn)
+	if virtualIn == nil || virtualOut == nil || virtualIn.Sign() == 0 {
+		return new(big.Float)
+	}
+	return new(big.Float).Quo(new(big.Float).SetInt(virtualOut), new(big.Float).SetInt(virtualIn))
+}
+
+func (pool *PoolPairState) reserves(tokenIn string) (*big.Int, *big.Int, uint64) {
+	if tokenIn == pool.State.Token0ID {
+		return pool.State.Token0VirtualAmount, pool.State.Token1VirtualAmount, pool.State.Token1RealAmount
+	}
+	return pool.State.Token1VirtualAmount, pool.State.Token0VirtualAmount, pool.State.Token0RealAmount
+}
+
+func (pool *PoolPairState) otherToken(tokenID string) string {
+	if tokenID == pool.State.Token0ID {
+		return pool.State.Token1ID
+	}
+	return pool.State.Token0ID
+}
+
+// poolsByToken returns the pools trading each token.
+func (state *Pdexv3State) poolsByToken() map[string][]string {
+	poolsByToken := make(map[string][]string)
+	for poolID, pool := range state.PoolPairs {
+		poolsByToken[pool.State.Token0ID] = append(poolsByToken[pool.State.Token0ID], poolID)
+		poolsByToken[pool.State.Token1ID] = append(poolsByToken[pool.State.Token1ID], poolID)
+	}
+	return poolsByToken
+}
+
+func (state *Pdexv3State) poolFeeRate(poolID string) uint {
+	if feeRate, ok := state.Params.FeeRateBPS[poolID]; ok {
+		return feeRate
+	}
+	return state.Params.DefaultFeeRateBPS
+}
+
+func containsToken(tokens []string, tokenID string) bool {
+	for _, token := range tokens {
+		if token == tokenID {
+			return true
+		}
+	}
+	return false
+}
+
+func ceilDiv(num *big.Int, den *big.Int) uint64 {
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() > 0 {
+		quo.Add(quo, big.NewInt(1))
+	}
+	return quo.Uint64()
+}
@@ -0,0 +1,228 @@
+package pdexservice
+
+import (
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/incognitochain/go-incognito-sdk-v2/common"
+)
+
+// newTestPool returns a pool without amplification, its virtual reserves
+// are the real ones.
+func newTestPool(token0, token1 string, amount0, amount1 uint64) *PoolPairState {
+	return &PoolPairState{State: PoolPair{
+		Token0ID:            token0,
+		Token1ID:            token1,
+		Token0RealAmount:    amount0,
+		Token1RealAmount:    amount1,
+		Token0VirtualAmount: new(big.Int).SetUint64(amount0),
+		Token1VirtualAmount: new(big.Int).SetUint64(amount1),
+		Amplifier:           10000,
+	}}
+}
+
+func newTestState(pools map[string]*PoolPairState) *Pdexv3State {
+	return &Pdexv3State{
+		Params: Pdexv3Params{
+			DefaultFeeRateBPS:  30,
+			FeeRateBPS:         map[string]uint{},
+			PRVDiscountPercent: 25,
+		},
+		PoolPairs: pools,
+	}
+}
+
+func TestFindBestRoute(t *testing.T) {
+	tests := []struct {
+		name       string
+		pools      map[string]*PoolPairState
+		sell, buy  string
+		amount     uint64
+		wantPools  []string
+		wantTokens []string
+		wantOutput uint64
+	}{
+		{
+			name:       "direct",
+			pools:      map[string]*PoolPairState{"ab": newTestPool("A", "B", 1000000, 2000000)},
+			sell:       "A",
+			buy:        "B",
+			amount:     1000,
+			wantPools:  []string{"ab"},
+			wantTokens: []string{"A", "B"},
+			wantOutput: 1998,
+		},
+		{
+			name:       "reverse direction",
+			pools:      map[string]*PoolPairState{"ab": newTestPool("A", "B", 2000000, 1000000)},
+			sell:       "B",
+			buy:        "A",
+			amount:     1000,
+			wantPools:  []string{"ab"},
+			wantTokens: []string{"B", "A"},
+			wantOutput: 1998,
+		},
+		{
+			name: "two hops beat a shallow direct pool",
+			pools: map[string]*PoolPairState{
+				"ab": newTestPool("A", "B", 100000, 100000),
+				"ac": newTestPool("A", "C", 1000000, 1000000),
+				"cb": newTestPool("C", "B", 1000000, 1000000),
+			},
+			sell:       "A",
+			buy:        "B",
+			amount:     1000,
+			wantPools:  []string{"ac", "cb"},
+			wantTokens: []string{"A", "C", "B"},
+			wantOutput: 998,
+		},
+		{
+			name: "more hops than allowed",
+			pools: map[string]*PoolPairState{
+				"ab": newTestPool("A", "B", 1000000, 1000000),
+				"bc": newTestPool("B", "C", 1000000, 1000000),
+				"cd": newTestPool("C", "D", 1000000, 1000000),
+				"de": newTestPool("D", "E", 1000000, 1000000),
+			},
+			sell:   "A",
+			buy:    "E",
+			amount: 1000,
+		},
+		{
+			name:   "no pool",
+			pools:  map[string]*PoolPairState{"ab": newTestPool("A", "B", 1000000, 1000000)},
+			sell:   "A",
+			buy:    "C",
+			amount: 1000,
+		},
+		{
+			name: "output above the real reserve",
+			pools: map[string]*PoolPairState{"ab": {State: PoolPair{
+				Token0ID:            "A",
+				Token1ID:            "B",
+				Token0RealAmount:    1000,
+				Token1RealAmount:    10,
+				Token0VirtualAmount: big.NewInt(1000000),
+				Token1VirtualAmount: big.NewInt(1000000),
+			}}},
+			sell:   "A",
+			buy:    "B",
+			amount: 1000,
+		},
+	}
+	for _, tt := range tests {
+		route := findBestRoute(newTestState(tt.pools), tt.sell, tt.buy, tt.amount)
+		if tt.wantPools == nil {
+			if route != nil {
+				t.Errorf("%v: got route %v, want none", tt.name, route.pools)
+			}
+			continue
+		}
+		if route == nil {
+			t.Errorf("%v: got no route", tt.name)
+			continue
+		}
+		if !reflect.DeepEqual(route.pools, tt.wantPools) || !reflect.DeepEqual(route.tokens, tt.wantTokens) || route.output != tt.wantOutput {
+			t.Errorf("%v: got %v %v %v, want %v %v %v", tt.name, route.pools, route.tokens, route.output, tt.wantPools, tt.wantTokens, tt.wantOutput)
+		}
+	}
+}
+
+func TestEstimateTrade(t *testing.T) {
+	prv := common.PRVIDStr
+	tests := []struct {
+		name        string
+		pools       map[string]*PoolPairState
+		feeRates    map[string]uint
+		sell, buy   string
+		amount      uint64
+		wantErr     error
+		wantOutput  uint64
+		wantFeeBPS  uint
+		wantFeeSell uint64
+		wantFeePRV  uint64
+		wantImpact  float64
+	}{
+		{
+			name:        "no PRV route",
+			pools:       map[string]*PoolPairState{"ab": newTestPool("A", "B", 1000000, 2000000)},
+			sell:        "A",
+			buy:         "B",
+			amount:      1000,
+			wantOutput:  1998,
+			wantFeeBPS:  30,
+			wantFeeSell: 3,
+			wantImpact:  0.1,
+		},
+		{
+			name:        "pool fee rate",
+			pools:       map[string]*PoolPairState{"ab": newTestPool("A", "B", 1000000, 2000000)},
+			feeRates:    map[string]uint{"ab": 50},
+			sell:        "A",
+			buy:         "B",
+			amount:      1000,
+			wantOutput:  1998,
+			wantFeeBPS:  50,
+			wantFeeSell: 5,
+			wantImpact:  0.1,
+		},
+		{
+			name:        "fee converted to PRV at the mid price",
+			pools:       map[string]*PoolPairState{"ap": newTestPool("A", prv, 1000000, 500000)},
+			sell:        "A",
+			buy:         prv,
+			amount:      10000,
+			wantOutput:  4950,
+			wantFeeBPS:  30,
+			wantFeeSell: 30,
+			// 30 A is 15 PRV, rounded up to 16 then discounted by 25%
+			wantFeePRV: 12,
+			wantImpact: 1,
+		},
+		{
+			name:        "selling PRV",
+			pools:       map[string]*PoolPairState{"ap": newTestPool(prv, "A", 500000, 1000000)},
+			sell:        prv,
+			buy:         "A",
+			amount:      10000,
+			wantOutput:  19607,
+			wantFeeBPS:  30,
+			wantFeeSell: 30,
+			wantFeePRV:  23,
+			wantImpact:  1.965,
+		},
+		{
+			name:    "no route",
+			pools:   map[string]*PoolPairState{"ab": newTestPool("A", "B", 1000000, 1000000)},
+			sell:    "A",
+			buy:     "C",
+			amount:  1000,
+			wantErr: ErrNoRoute,
+		},
+	}
+	for _, tt := range tests {
+		state := newTestState(tt.pools)
+		if tt.feeRates != nil {
+			state.Params.FeeRateBPS = tt.feeRates
+		}
+		estimate, err := estimateTrade(state, tt.sell, tt.buy, tt.amount)
+		if err != tt.wantErr {
+			t.Errorf("%v: error = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if estimate.ExpectedAmount != tt.wantOutput || estimate.FeeRateBPS != tt.wantFeeBPS ||
+			estimate.FeeInSellToken != tt.wantFeeSell || estimate.FeeInPRV != tt.wantFeePRV {
+			t.Errorf("%v: got output %v fee rate %v fee %v fee in PRV %v, want %v %v %v %v", tt.name,
+				estimate.ExpectedAmount, estimate.FeeRateBPS, estimate.FeeInSellToken, estimate.FeeInPRV,
+				tt.wantOutput, tt.wantFeeBPS, tt.wantFeeSell, tt.wantFeePRV)
+		}
+		if math.Abs(estimate.PriceImpact-tt.wantImpact) > 0.01 {
+			t.Errorf("%v: price impact %v, want %v", tt.name, estimate.PriceImpact, tt.wantImpact)
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package pdexservice
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/incognitochain/go-incognito-sdk-v2/common"
+	"github.com/incognitochain/go-incognito-sdk-v2/metadata"
+	"github.com/rs/zerolog/log"
+
+	"github.com/obsidianwallet/obsidian-wallet-node/database"
+	"github.com/obsidianwallet/obsidian-wallet-node/walletmanager"
+)
+
+type ContributeParam struct {
+	// PoolID is empty when creating a new pool of Token0ID and Token1ID
+	PoolID       string
+	Token0ID     string
+	Token1ID     string
+	Token0Amount uint64
+	Token1Amount uint64
+	// Amplifier is only used when creating a pool
+	Amplifier uint
+	// NftID defaults to the first access NFT of the account
+	NftID string
+	TxFee uint64
+}
+
+type LiquidityPositions struct {
+	NftIDs    []string
+	Positions []Position
+}
+
+// MintNFT burns the PRV required by the beacon to mint a new access NFT to
+// the account.
+func (pdexServ *PDexService) MintNFT(account *walletmanager.RuntimeAccount, txFee uint64) (string, error) {
+	state, err := pdexServ.getState()
+	if err != nil {
+		return "", err
+	}
+	receivers, err := newOTAReceivers(account.GetAccount().PaymentAddress, common.PRVIDStr)
+	if err != nil {
+		return "", err
+	}
+	md := &UserMintNftRequest{
+		OtaReceiver:  receivers[common.PRVIDStr].String(),
+		Amount:       state.Params.MintNftRequireAmount,
+		MetadataBase: *metadata.NewMetadataBase(pdexv3UserMintNftRequestMeta),
+	}
+	return account.CreateAndSendTransaction(walletmanager.TxParam{
+		TokenID:   common.PRVIDStr,
+		Receivers: []walletmanager.TxReceiver{{PaymentAddress: common.BurningAddress2, Amount: md.Amount}},
+		Fee:       txFee,
+		Metadata:  md,
+	})
+}
+
+// ListPositions returns the access NFTs of the account and the liquidity
+// they hold in each pool.
+func (pdexServ *PDexService) ListPositions(account *walletmanager.RuntimeAccount) (*LiquidityPositions, error) {
+	state, err := pdexServ.getState()
+	if err != nil {
+		return nil, err
+	}
+	result := &LiquidityPositions{
+		NftIDs:    accountNFTs(state, account),
+		Positions: []Position{},
+	}
+	for _, nftID := range result.NftIDs {
+		for poolID, pool := range state.PoolPairs {
+			share, ok := pool.Shares[nftID]
+			if !ok || share.Amount == 0 {
+				continue
+			}
+			result.Positions = append(result.Positions, buildPosition(poolID, pool, nftID, share))
+		}
+	}
+	sort.Slice(result.Positions, func(i, j int) bool {
+		if result.Positions[i].NftID != result.Positions[j].NftID {
+			return result.Positions[i].NftID < result.Positions[j].NftID
+		}
+		return result.Positions[i].PoolID < result.Positions[j].PoolID
+	})
+	return result, nil
+}
+
+// Contribute sends both sides of a liquidity contribution under the same
+// pair hash. The contribution is recorded after each side so a failure of
+// the second one can be seen and handled.
+func (pdexServ *PDexService) Contribute(account *walletmanager.RuntimeAccount, param ContributeParam) (*Contribution, error) {
+	state, err := pdexServ.getState()
+	if err != nil {
+		return nil, err
+	}
+	if param.PoolID != "" {
+		pool, ok := state.PoolPairs[param.PoolID]
+		if !ok {
+			return nil, ErrPoolNotFound
+		}
+		param.Token0ID = pool.State.Token0ID
+		param.Token1ID = pool.State.Token1ID
+		param.Amplifier = pool.State.Amplifier
+	}
+	if param.Token0ID == "" || param.Token1ID == "" || param.Token0ID == param.Token1ID {
+		return nil, errors.New("contribution needs two different tokens")
+	}
+	if param.Token0Amount == 0 || param.Token1Amount == 0 {
+		return nil, errors.New("contribution amounts must be greater than 0")
+	}
+	if param.PoolID == "" && param.Amplifier < minAmplifier {
+		return nil, fmt.Errorf("amplifier of a new pool must be at least %v", minAmplifier)
+	}
+	nftID, err := pickNFT(state, account, param.NftID)
+	if err != nil {
+		return nil, err
+	}
+
+	pairHash, err := newPairHash()
+	if err != nil {
+		return nil, err
+	}
+	contribution := &Contribution{
+		PairHash:     pairHash,
+		PoolID:       param.PoolID,
+		NftID:        nftID,
+		Token0ID:     param.Token0ID,
+		Token1ID:     param.Token1ID,
+		Token0Amount: param.Token0Amount,
+		Token1Amount: param.Token1Amount,
+		Amplifier:    param.Amplifier,
+		Time:         time.Now().Unix(),
+	}
+	sides := []struct {
+		tokenID string
+		amount  uint64
+	}{
+		{param.Token0ID, param.Token0Amount},
+		{param.Token1ID, param.Token1Amount},
+	}
+	for _, side := range sides {
+		txHash, err := pdexServ.sendContribution(account, contribution, side.tokenID, side.amount, param.TxFee)
+		if err != nil {
+			contribution.Error = err.Error()
+		} else {
+			contribution.TxHashes = append(contribution.TxHashes, txHash)
+		}
+		if saveErr := pdexServ.saveContribution(account.Pubkey(), contribution); saveErr != nil {
+			log.Error().Msgf("save contribution %v failed: %v", pairHash, saveErr)
+		}
+		if err != nil {
+			return contribution, err
+		}
+	}
+	return contribution, nil
+}
+
+func (pdexServ *PDexService) sendContribution(account *walletmanager.RuntimeAccount, contribution *Contribution, tokenID string, amount uint64, txFee uint64) (string, error) {
+	receivers, err := newOTAReceivers(account.GetAccount().PaymentAddress, tokenID)
+	if err != nil {
+		return "", err
+	}
+	md := &AddLiquidityRequest{
+		PoolPairID:   contribution.PoolID,
+		PairHash:     contribution.PairHash,
+		OtaReceiver:  receivers[tokenID].String(),
+		TokenID:      tokenID,
+		NftID:        contribution.NftID,
+		TokenAmount:  amount,
+		Amplifier:    contribution.Amplifier,
+		MetadataBase: *metadata.NewMetadataBase(pdexv3AddLiquidityRequestMeta),
+	}
+	return account.CreateAndSendTransaction(walletmanager.TxParam{
+		TokenID:   tokenID,
+		Receivers: []walletmanager.TxReceiver{{PaymentAddress: common.BurningAddress2, Amount: amount}},
+		Fee:       txFee,
+		Metadata:  md,
+	})
+}
+
+// ListContributions returns the contributions of the account, newest first,
+// refreshing the chain status of the recent ones.
+func (pdexServ *PDexService) ListContributions(account *walletmanager.RuntimeAccount) ([]Contribution, error) {
+	pdexServ.lock.RLock()
+	client := pdexServ.incclient
+	network := pdexServ.currentNetwork.Name
+	pdexServ.lock.RUnlock()
+
+	result := []Contribution{}
+	prefix := buildContributionKey(network, account.Pubkey(), "")
+	err := pdexServ.db.DB.ReadIteratorCopy(append([]byte(dbPdexContributionPrefix), prefix...), false, func(k []byte, v []byte) (bool, error) {
+		var contribution Contribution
+		if err := json.Unmarshal(v, &contribution); err != nil {
+			return true, err
+		}
+		result = append(result, contribution)
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for idx := range result {
+		contribution := &result[idx]
+		if client == nil || len(contribution.TxHashes) == 0 || time.Since(time.Unix(contribution.Time, 0)) > contributionStatusWindow {
+			continue
+		}
+		status, err := getContributionStatus(client, contribution.PairHash)
+		if err != nil {
+			continue
+		}
+		contribution.Status = status
+		if err := pdexServ.saveContribution(account.Pubkey(), contribution); err != nil {
+			log.Error().Msgf("save contribution %v failed: %v", contribution.PairHash, err)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Time > result[j].Time
+	})
+	return result, nil
+}
+
+// WithdrawLiquidity withdraws shareAmount of the NFT share in poolID, the
+// NFT is burnt to prove ownership and minted back with the tokens.
+func (pdexServ *PDexService) WithdrawLiquidity(account *walletmanager.RuntimeAccount, poolID string, nftID string, shareAmount uint64, txFee uint64) (string, error) {
+	state, err := pdexServ.getState()
+	if err != nil {
+		return "", err
+	}
+	pool, share, err := checkPoolShare(state, account, poolID, nftID)
+	if err != nil {
+		return "", err
+	}
+	if shareAmount == 0 || shareAmount > share.Amount {
+		return "", errors.New("share amount must be between 1 and the NFT share")
+	}
+	receivers, err := newOTAReceivers(account.GetAccount().PaymentAddress, pool.State.Token0ID, pool.State.Token1ID, nftID)
+	if err != nil {
+		return "", err
+	}
+	md := &WithdrawLiquidityRequest{
+		PoolPairID:   poolID,
+		NftID:        nftID,
+		OtaReceivers: receivers,
+		ShareAmount:  shareAmount,
+		MetadataBase: *metadata.NewMetadataBase(pdexv3WithdrawLiquidityRequestMeta),
+	}
+	return sendNFTAccessTx(account, nftID, md, txFee)
+}
+
+// ClaimLPFees withdraws the LP fees the NFT earned in poolID.
+func (pdexServ *PDexService) ClaimLPFees(account *walletmanager.RuntimeAccount, poolID string, nftID string, txFee uint64) (string, error) {
+	state, err := pdexServ.getState()
+	if err != nil {
+		return "", err
+	}
+	pool, _, err := checkPoolShare(state, account, poolID, nftID)
+	if err != nil {
+		return "", err
+	}
+	receivers, err := newOTAReceivers(account.GetAccount().PaymentAddress, pool.State.Token0ID, pool.State.Token1ID, common.PRVIDStr, PDEXTokenID, nftID)
+	if err != nil {
+		return "", err
+	}
+	md := &WithdrawLPFeeRequest{
+		PoolPairID:   poolID,
+		NftID:        nftID,
+		Receivers:    receivers,
+		MetadataBase: *metadata.NewMetadataBase(pdexv3WithdrawLPFeeRequestMeta),
+	}
+	return sendNFTAccessTx(account, nftID, md, txFee)
+}
+
+// sendNFTAccessTx burns one unit of the access NFT along with md, the
+// beacon mints it back to the receiver given in md.
+func sendNFTAccessTx(account *walletmanager.RuntimeAccount, nftID string, md metadata.Metadata, txFee uint64) (string, error) {
+	return account.CreateAndSendTransaction(walletmanager.TxParam{
+		TokenID:   nftID,
+		Receivers: []walletmanager.TxReceiver{{PaymentAddress: common.BurningAddress2, Amount: 1}},
+		Fee:       txFee,
+		Metadata:  md,
+	})
+}
+
+func checkPoolShare(state *Pdexv3State, account *walletmanager.RuntimeAccount, poolID string, nftID string) (*PoolPairState, *Share, error) {
+	pool, ok := state.PoolPairs[poolID]
+	if !ok {
+		return nil, nil, ErrPoolNotFound
+	}
+	if _, err := pickNFT(state, account, nftID); err != nil {
+		return nil, nil, err
+	}
+	share, ok := pool.Shares[nftID]
+	if !ok || share.Amount == 0 {
+		return nil, nil, ErrNoShare
+	}
+	return pool, share, nil
+}
+
+// accountNFTs returns the access NFTs the account holds.
+func accountNFTs(state *Pdexv3State, account *walletmanager.RuntimeAccount) []string {
+	result := []string{}
+	for tokenID, balance := range account.GetBalances() {
+		if _, ok := state.NftIDs[tokenID]; ok && balance > 0 {
+			result = append(result, tokenID)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// pickNFT checks the account holds nftID, or picks its first NFT when
+// nftID is empty.
+func pickNFT(state *Pdexv3State, account *walletmanager.RuntimeAccount, nftID string) (string, error) {
+	nftIDs := accountNFTs(state, account)
+	if nftID == "" {
+		if len(nftIDs) == 0 {
+			return "", ErrNoAccessNFT
+		}
+		return nftIDs[0], nil
+	}
+	for _, id := range nftIDs {
+		if id == nftID {
+			return nftID, nil
+		}
+	}
+	return "", ErrNFTNotOwned
+}
+
+func buildPosition(poolID string, pool *PoolPairState, nftID string, share *Share) Position {
+	position := Position{
+		NftID:      nftID,
+		PoolID:     poolID,
+		Token0ID:   pool.State.Token0ID,
+		Token1ID:   pool.State.Token1ID,
+		Share:      share.Amount,
+		TotalShare: pool.State.ShareAmount,
+		Fees:       make(map[string]uint64),
+	}
+	if pool.State.ShareAmount > 0 {
+		position.Token0Amount = shareOf(pool.State.Token0RealAmount, share.Amount, pool.State.ShareAmount)
+		position.Token1Amount = shareOf(pool.State.Token1RealAmount, share.Amount, pool.State.ShareAmount)
+	}
+	for tokenID, fee := range share.TradingFees {
+		position.Fees[tokenID] += fee
+	}
+	// fees accrued since the share was last updated
+	for tokenID, feesPerShare := range pool.LpFeesPerShare {
+		accrued := new(big.Int).Set(feesPerShare)
+		if last, ok := share.LastLPFeesPerShare[tokenID]; ok && last != nil {
+			accrued.Sub(accrued, last)
+		}
+		if accrued.Sign() <= 0 {
+			continue
+		}
+		accrued.Mul(accrued, new(big.Int).SetUint64(share.Amount))
+		accrued.Div(accrued, new(big.Int).SetUint64(lpFeesPerShareBase))
+		if accrued.IsUint64() {
+			position.Fees[tokenID] += accrued.Uint64()
+		}
+	}
+	return position
+}
+
+func shareOf(amount uint64, share uint64, total uint64) uint64 {
+	result := new(big.Int).SetUint64(amount)
+	result.Mul(result, new(big.Int).SetUint64(share))
+	result.Div(result, new(big.Int).SetUint64(total))
+	return result.Uint64()
+}
+
+func newPairHash() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (pdexServ *PDexService) saveContribution(pubkey string, contribution *Contribution) error {
+	pdexServ.lock.RLock()
+	network := pdexServ.currentNetwork.Name
+	pdexServ.lock.RUnlock()
+	contributionBytes, err := json.Marshal(contribution)
+	if err != nil {
+		return err
+	}
+	return pdexServ.db.DB.Set([]byte(dbPdexContributionPrefix), []database.Object{{
+		Key:   buildContributionKey(network, pubkey, contribution.PairHash),
+		Value: contributionBytes,
+	}})
+}
+
+func buildContributionKey(network string, pubkey string, pairHash string) []byte {
+	return []byte(network + "-" + pubkey + "-" + pairHash)
+}
@@ -0,0 +1,227 @@
+package pdexservice
+
+import (
+	"encoding/json"
+
+	"github.com/incognitochain/go-incognito-sdk-v2/common"
+	"github.com/incognitochain/go-incognito-sdk-v2/metadata"
+)
+
+// pDEX v3 requests are not part of the SDK, they are declared here the way
+// the beacon decodes them. Their hash is the hash of their JSON encoding.
+
+type TradeRequest struct {
+	TradePath           []string               `json:"TradePath"`
+	TokenToSell         string                 `json:"TokenToSell"`
+	SellAmount          uint64                 `json:"SellAmount"`
+	MinAcceptableAmount uint64                 `json:"MinAcceptableAmount"`
+	TradingFee          uint64                 `json:"TradingFee"`
+	Receiver            map[string]OTAReceiver `json:"Receiver"`
+	metadata.MetadataBase
+}
+
+func (req TradeRequest) Hash() *common.Hash {
+	return hashMetadata(req)
+}
+
+func (req TradeRequest) HashWithoutSig() *common.Hash {
+	return req.Hash()
+}
+
+func (req *TradeRequest) CalculateSize() uint64 {
+	return calculateMetadataSize(req)
+}
+
+type AddLiquidityRequest struct {
+	PoolPairID  string `json:"PoolPairID"`
+	PairHash    string `json:"PairHash"`
+	OtaReceiver string `json:"OtaReceiver"`
+	TokenID     string `json:"TokenID"`
+	NftID       string `json:"NftID"`
+	TokenAmount uint64 `json:"TokenAmount"`
+	Amplifier   uint   `json:"Amplifier"`
+	metadata.MetadataBase
+}
+
+func (req AddLiquidityRequest) Hash() *common.Hash {
+	return hashMetadata(req)
+}
+
+func (req AddLiquidityRequest) HashWithoutSig() *common.Hash {
+	return req.Hash()
+}
+
+func (req *AddLiquidityRequest) CalculateSize() uint64 {
+	return calculateMetadataSize(req)
+}
+
+type WithdrawLiquidityRequest struct {
+	PoolPairID   string                 `json:"PoolPairID"`
+	NftID        string                 `json:"NftID"`
+	OtaReceivers map[string]OTAReceiver `json:"OtaReceivers"`
+	ShareAmount  uint64                 `json:"ShareAmount"`
+	metadata.MetadataBase
+}
+
+func (req WithdrawLiquidityRequest) Hash() *common.Hash {
+	return hashMetadata(req)
+}
+
+func (req WithdrawLiquidityRequest) HashWithoutSig() *common.Hash {
+	return req.Hash()
+}
+
+func (req *WithdrawLiquidityRequest) CalculateSize() uint64 {
+	return calculateMetadataSize(req)
+}
+
+type WithdrawLPFeeRequest struct {
+	PoolPairID string                 `json:"PoolPairID"`
+	NftID      string                 `json:"NftID"`
+	Receivers  map[string]OTAReceiver `json:"Receivers"`
+	metadata.MetadataBase
+}
+
+func (req WithdrawLPFeeRequest) Hash() *common.Hash {
+	return hashMetadata(req)
+}
+
+func (req WithdrawLPFeeRequest) HashWithoutSig() *common.Hash {
+	return req.Hash()
+}
+
+func (req *WithdrawLPFeeRequest) CalculateSize() uint64 {
+	return calculateMetadataSize(req)
+}
+
+type UserMintNftRequest struct {
+	OtaReceiver string `json:"OtaReceiver"`
+	Amount      uint64 `json:"Amount"`
+	metadata.MetadataBase
+}
+
+func (req UserMintNftRequest) Hash() *common.Hash {
+	return hashMetadata(req)
+}
+
+func (req UserMintNftRequest) HashWithoutSig() *common.Hash {
+	return req.Hash()
+}
+
+func (req *UserMintNftRequest) CalculateSize() uint64 {
+	return calculateMetadataSize(req)
+}
+
+type AddOrderRequest struct {
+	TokenToSell         string                 `json:"TokenToSell"`
+	PoolPairID          string                 `json:"PoolPairID"`
+	SellAmount          uint64                 `json:"SellAmount"`
+	MinAcceptableAmount uint64                 `json:"MinAcceptableAmount"`
+	Receiver            map[string]OTAReceiver `json:"Receiver"`
+	NftID               string                 `json:"NftID"`
+	metadata.MetadataBase
+}
+
+func (req AddOrderRequest) Hash() *common.Hash {
+	return hashMetadata(req)
+}
+
+func (req AddOrderRequest) HashWithoutSig() *common.Hash {
+	return req.Hash()
+}
+
+func (req *AddOrderRequest) CalculateSize() uint64 {
+	return calculateMetadataSize(req)
+}
+
+type WithdrawOrderRequest struct {
+	PoolPairID string                 `json:"PoolPairID"`
+	OrderID    string                 `json:"OrderID"`
+	TokenID    string                 `json:"TokenID"`
+	Amount     uint64                 `json:"Amount"`
+	Receiver   map[string]OTAReceiver `json:"Receiver"`
+	NftID      string                 `json:"NftID"`
+	metadata.MetadataBase
+}
+
+func (req WithdrawOrderRequest) Hash() *common.Hash {
+	return hashMetadata(req)
+}
+
+func (req WithdrawOrderRequest) HashWithoutSig() *common.Hash {
+	return req.Hash()
+}
+
+func (req *WithdrawOrderRequest) CalculateSize() uint64 {
+	return calculateMetadataSize(req)
+}
+
+type StakingRequest struct {
+	TokenID     string `json:"TokenID"`
+	OtaReceiver string `json:"OtaReceiver"`
+	NftID       string `json:"NftID"`
+	TokenAmount uint64 `json:"TokenAmount"`
+	metadata.MetadataBase
+}
+
+func (req StakingRequest) Hash() *common.Hash {
+	return hashMetadata(req)
+}
+
+func (req StakingRequest) HashWithoutSig() *common.Hash {
+	return req.Hash()
+}
+
+func (req *StakingRequest) CalculateSize() uint64 {
+	return calculateMetadataSize(req)
+}
+
+type UnstakingRequest struct {
+	StakingPoolID   string                 `json:"StakingPoolID"`
+	OtaReceivers    map[string]OTAReceiver `json:"OtaReceivers"`
+	NftID           string                 `json:"NftID"`
+	UnstakingAmount uint64                 `json:"UnstakingAmount"`
+	metadata.MetadataBase
+}
+
+func (req UnstakingRequest) Hash() *common.Hash {
+	return hashMetadata(req)
+}
+
+func (req UnstakingRequest) HashWithoutSig() *common.Hash {
+	return req.Hash()
+}
+
+func (req *UnstakingRequest) CalculateSize() uint64 {
+	return calculateMetadataSize(req)
+}
+
+type WithdrawStakingRewardRequest struct {
+	StakingPoolID string                 `json:"StakingPoolID"`
+	NftID         string                 `json:"NftID"`
+	Receivers     map[string]OTAReceiver `json:"Receivers"`
+	metadata.MetadataBase
+}
+
+func (req WithdrawStakingRewardRequest) Hash() *common.Hash {
+	return hashMetadata(req)
+}
+
+func (req WithdrawStakingRewardRequest) HashWithoutSig() *common.Hash {
+	return req.Hash()
+}
+
+func (req *WithdrawStakingRewardRequest) CalculateSize() uint64 {
+	return calculateMetadataSize(req)
+}
+
+func hashMetadata(md interface{}) *common.Hash {
+	rawBytes, _ := json.Marshal(md)
+	hash := common.HashH(rawBytes)
+	return &hash
+}
+
+func calculateMetadataSize(md interface{}) uint64 {
+	rawBytes, _ := json.Marshal(md)
+	return uint64(len(rawBytes))
+}
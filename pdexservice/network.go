@@ -1,17 +1,66 @@
 package pdexservice
 
 import (
+	"context"
+
 	"github.com/incognitochain/go-incognito-sdk-v2/incclient"
 	"github.com/obsidianwallet/obsidian-wallet-node/common"
 )
 
+// Stop cancels the workers and returns once they all exited.
 func (pdexServ *PDexService) Stop() error {
+	pdexServ.lock.Lock()
+	cancel := pdexServ.cancel
+	pdexServ.cancel = nil
+	pdexServ.lock.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	pdexServ.workers.Wait()
 	return nil
 }
-func (pdexServ *PDexService) Start() error {
+
+// Start runs the workers until Stop is called or ctx is cancelled.
+func (pdexServ *PDexService) Start(ctx context.Context) error {
+	pdexServ.lock.Lock()
+	defer pdexServ.lock.Unlock()
+	if pdexServ.cancel != nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	pdexServ.cancel = cancel
+	pdexServ.workers.Add(2)
+	go pdexServ.refreshState(ctx)
+	go pdexServ.snapshotPortfolio(ctx)
 	return nil
 }
+
+func (pdexServ *PDexService) SetClient(incclient *incclient.IncClient) error {
+	pdexServ.lock.Lock()
+	defer pdexServ.lock.Unlock()
+	pdexServ.incclient = incclient
+	return nil
+}
+
+// SetRPCErrorHandler sets the function told about the chain calls that
+// failed, with the client they were made with.
+func (pdexServ *PDexService) SetRPCErrorHandler(handler func(client *incclient.IncClient, err error)) {
+	pdexServ.lock.Lock()
+	defer pdexServ.lock.Unlock()
+	pdexServ.rpcErrorHandler = handler
+}
+
 func (pdexServ *PDexService) SwitchNetwork(networkParam common.NetworkID, incclient *incclient.IncClient) error {
+	// serve the cached state until the first refresh on the new network
+	state, err := pdexServ.loadState(networkParam.Name)
+	if err != nil {
+		return err
+	}
+	pdexServ.lock.Lock()
+	defer pdexServ.lock.Unlock()
 	pdexServ.incclient = incclient
+	pdexServ.currentNetwork = networkParam
+	pdexServ.state = state
 	return nil
 }
@@ -0,0 +1,286 @@
+package pdexservice
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/incognitochain/go-incognito-sdk-v2/common"
+	"github.com/incognitochain/go-incognito-sdk-v2/metadata"
+
+	"github.com/obsidianwallet/obsidian-wallet-node/database"
+	"github.com/obsidianwallet/obsidian-wallet-node/walletmanager"
+)
+
+type PlaceOrderParam struct {
+	PoolID      string
+	TokenToSell string
+	SellAmount  uint64
+	// MinAcceptableAmount of the other token sets the price of the order
+	MinAcceptableAmount uint64
+	// NftID defaults to the first access NFT of the account
+	NftID string
+	TxFee uint64
+}
+
+// PlaceOrder sends a limit order selling SellAmount of TokenToSell in the
+// pool for at least MinAcceptableAmount of the other token.
+func (pdexServ *PDexService) PlaceOrder(account *walletmanager.RuntimeAccount, param PlaceOrderParam) (*AccountOrder, error) {
+	state, err := pdexServ.getState()
+	if err != nil {
+		return nil, err
+	}
+	pool, ok := state.PoolPairs[param.PoolID]
+	if !ok {
+		return nil, ErrPoolNotFound
+	}
+	if param.TokenToSell != pool.State.Token0ID && param.TokenToSell != pool.State.Token1ID {
+		return nil, errors.New("token to sell is not in the pool")
+	}
+	if param.SellAmount == 0 {
+		return nil, errors.New("sell amount must be greater than 0")
+	}
+	if param.MinAcceptableAmount == 0 {
+		return nil, ErrMinAmountRequired
+	}
+	nftID, err := pickNFT(state, account, param.NftID)
+	if err != nil {
+		return nil, err
+	}
+	tokenToBuy := pool.otherToken(param.TokenToSell)
+
+	receivers, err := newOTAReceivers(account.GetAccount().PaymentAddress, param.TokenToSell, tokenToBuy)
+	if err != nil {
+		return nil, err
+	}
+	md := &AddOrderRequest{
+		TokenToSell:         param.TokenToSell,
+		PoolPairID:          param.PoolID,
+		SellAmount:          param.SellAmount,
+		MinAcceptableAmount: param.MinAcceptableAmount,
+		Receiver:            receivers,
+		NftID:               nftID,
+		MetadataBase:        *metadata.NewMetadataBase(pdexv3AddOrderRequestMeta),
+	}
+	txHash, err := account.CreateAndSendTransaction(walletmanager.TxParam{
+		TokenID:   param.TokenToSell,
+		Receivers: []walletmanager.TxReceiver{{PaymentAddress: common.BurningAddress2, Amount: param.SellAmount}},
+		Fee:       param.TxFee,
+		Metadata:  md,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	order := &AccountOrder{
+		OrderID:             txHash,
+		PoolID:              param.PoolID,
+		NftID:               nftID,
+		TokenToSell:         param.TokenToSell,
+		TokenToBuy:          tokenToBuy,
+		SellAmount:          param.SellAmount,
+		MinAcceptableAmount: param.MinAcceptableAmount,
+		Time:                time.Now().Unix(),
+		Status:              OrderPending,
+		Withdrawable:        make(map[string]uint64),
+	}
+	if err := pdexServ.saveOrders(map[string]*AccountOrder{pdexServ.orderKey(account.Pubkey(), txHash): order}); err != nil {
+		return order, err
+	}
+	return order, nil
+}
+
+// ListOrders returns the orders placed by the account, newest first.
+func (pdexServ *PDexService) ListOrders(account *walletmanager.RuntimeAccount) ([]AccountOrder, error) {
+	orders, err := pdexServ.loadOrders(pdexServ.orderKey(account.Pubkey(), ""))
+	if err != nil {
+		return nil, err
+	}
+	result := []AccountOrder{}
+	for _, order := range orders {
+		result = append(result, *order)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Time > result[j].Time
+	})
+	return result, nil
+}
+
+// CancelOrder withdraws the whole remaining balances of the order, which
+// removes it from the book.
+func (pdexServ *PDexService) CancelOrder(account *walletmanager.RuntimeAccount, orderID string, txFee uint64) (string, error) {
+	return pdexServ.WithdrawOrder(account, orderID, "", 0, txFee)
+}
+
+// WithdrawOrder withdraws amount of tokenID from the order balances, all of
+// them when tokenID is empty.
+func (pdexServ *PDexService) WithdrawOrder(account *walletmanager.RuntimeAccount, orderID string, tokenID string, amount uint64, txFee uint64) (string, error) {
+	state, err := pdexServ.getState()
+	if err != nil {
+		return "", err
+	}
+	orders, err := pdexServ.loadOrders(pdexServ.orderKey(account.Pubkey(), orderID))
+	if err != nil {
+		return "", err
+	}
+	order, ok := orders[pdexServ.orderKey(account.Pubkey(), orderID)]
+	if !ok {
+		return "", ErrOrderNotFound
+	}
+	if _, err := pickNFT(state, account, order.NftID); err != nil {
+		return "", err
+	}
+	updateOrderStatus(order, state, time.Now())
+	if order.Status == OrderPending || order.Status == OrderClosed || order.Status == OrderRejected {
+		return "", ErrNothingToWithdraw
+	}
+
+	receiverTokens := []string{order.TokenToSell, order.TokenToBuy, order.NftID}
+	withdrawTokenID := order.TokenToSell
+	if tokenID != "" {
+		if tokenID != order.TokenToSell && tokenID != order.TokenToBuy {
+			return "", errors.New("token is not traded by the order")
+		}
+		if order.Withdrawable[tokenID] == 0 || amount > order.Withdrawable[tokenID] {
+			return "", ErrNothingToWithdraw
+		}
+		receiverTokens = []string{tokenID, order.NftID}
+		withdrawTokenID = tokenID
+	} else {
+		amount = 0
+	}
+	receivers, err := newOTAReceivers(account.GetAccount().PaymentAddress, receiverTokens...)
+	if err != nil {
+		return "", err
+	}
+	md := &WithdrawOrderRequest{
+		PoolPairID:   order.PoolID,
+		OrderID:      orderID,
+		TokenID:      withdrawTokenID,
+		Amount:       amount,
+		Receiver:     receivers,
+		NftID:        order.NftID,
+		MetadataBase: *metadata.NewMetadataBase(pdexv3WithdrawOrderRequestMeta),
+	}
+	return sendNFTAccessTx(account, order.NftID, md, txFee)
+}
+
+// trackOrders updates the stored orders of network from state.
+func (pdexServ *PDexService) trackOrders(network string, state *Pdexv3State) error {
+	orders, err := pdexServ.loadOrders(network + "-")
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	changed := make(map[string]*AccountOrder)
+	for key, order := range orders {
+		if order.Status == OrderClosed || order.Status == OrderRejected {
+			continue
+		}
+		before := *order
+		updateOrderStatus(order, state, now)
+		if !reflect.DeepEqual(before, *order) {
+			changed[key] = order
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	return pdexServ.saveOrders(changed)
+}
+
+// updateOrderStatus sets the status, filled amounts and withdrawable
+// balances of order from the orderbook of its pool.
+func updateOrderStatus(order *AccountOrder, state *Pdexv3State, now time.Time) {
+	var bookOrder *Order
+	pool, ok := state.PoolPairs[order.PoolID]
+	if ok {
+		for _, o := range pool.Orderbook.Orders {
+			if o.Id == order.OrderID {
+				bookOrder = o
+				break
+			}
+		}
+	}
+	if bookOrder == nil {
+		switch {
+		case order.SeenInBook:
+			order.Status = OrderClosed
+		case now.Sub(time.Unix(order.Time, 0)) > orderPendingTimeout:
+			order.Status = OrderRejected
+		default:
+			order.Status = OrderPending
+		}
+		order.Withdrawable = make(map[string]uint64)
+		return
+	}
+
+	order.SeenInBook = true
+	sellBalance, buyBalance := bookOrder.Token0Balance, bookOrder.Token1Balance
+	if bookOrder.TradeDirection != tradeDirectionSell0 {
+		sellBalance, buyBalance = buyBalance, sellBalance
+	}
+	order.SoldAmount = 0
+	if order.SellAmount > sellBalance {
+		order.SoldAmount = order.SellAmount - sellBalance
+	}
+	order.BoughtAmount = buyBalance
+	order.Withdrawable = make(map[string]uint64)
+	if sellBalance > 0 {
+		order.Withdrawable[order.TokenToSell] = sellBalance
+	}
+	if buyBalance > 0 {
+		order.Withdrawable[order.TokenToBuy] = buyBalance
+	}
+	switch {
+	case sellBalance == 0:
+		order.Status = OrderFilled
+	case order.SoldAmount > 0:
+		order.Status = OrderPartiallyFilled
+	default:
+		order.Status = OrderOpen
+	}
+}
+
+func (pdexServ *PDexService) loadOrders(prefix string) (map[string]*AccountOrder, error) {
+	result := make(map[string]*AccountOrder)
+	fullPrefix := []byte(dbPdexOrderPrefix + prefix)
+	err := pdexServ.db.DB.ReadIteratorCopy(fullPrefix, false, func(k []byte, v []byte) (bool, error) {
+		var order AccountOrder
+		if err := json.Unmarshal(v, &order); err != nil {
+			return true, err
+		}
+		result[string(k[len(dbPdexOrderPrefix):])] = &order
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (pdexServ *PDexService) saveOrders(orders map[string]*AccountOrder) error {
+	var objs []database.Object
+	for key, order := range orders {
+		orderBytes, err := json.Marshal(order)
+		if err != nil {
+			return err
+		}
+		objs = append(objs, database.Object{
+			Key:   []byte(key),
+			Value: orderBytes,
+		})
+	}
+	return pdexServ.db.DB.Set([]byte(dbPdexOrderPrefix), objs)
+}
+
+// orderKey is the key of an order of pubkey on the current network, without
+// the namespace.
+func (pdexServ *PDexService) orderKey(pubkey string, orderID string) string {
+	pdexServ.lock.RLock()
+	network := pdexServ.currentNetwork.Name
+	pdexServ.lock.RUnlock()
+	return network + "-" + pubkey + "-" + orderID
+}
@@ -0,0 +1,93 @@
+package pdexservice
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUpdateOrderStatus(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	bookState := func(order *Order) *Pdexv3State {
+		pool := newTestPool("A", "B", 1000000, 1000000)
+		if order != nil {
+			pool.Orderbook.Orders = []*Order{order}
+		}
+		return newTestState(map[string]*PoolPairState{"ab": pool})
+	}
+	tests := []struct {
+		name             string
+		order            AccountOrder
+		bookOrder        *Order
+		wantStatus       OrderStatus
+		wantSold         uint64
+		wantBought       uint64
+		wantWithdrawable map[string]uint64
+	}{
+		{
+			name:             "not in the book yet",
+			order:            AccountOrder{Time: now.Add(-time.Minute).Unix()},
+			wantStatus:       OrderPending,
+			wantWithdrawable: map[string]uint64{},
+		},
+		{
+			name:             "never reached the book",
+			order:            AccountOrder{Time: now.Add(-orderPendingTimeout - time.Second).Unix()},
+			wantStatus:       OrderRejected,
+			wantWithdrawable: map[string]uint64{},
+		},
+		{
+			name:             "left the book",
+			order:            AccountOrder{Time: now.Add(-time.Hour).Unix(), SeenInBook: true},
+			wantStatus:       OrderClosed,
+			wantWithdrawable: map[string]uint64{},
+		},
+		{
+			name:             "open",
+			order:            AccountOrder{SellAmount: 1000},
+			bookOrder:        &Order{Token0Balance: 1000, TradeDirection: tradeDirectionSell0},
+			wantStatus:       OrderOpen,
+			wantWithdrawable: map[string]uint64{"A": 1000},
+		},
+		{
+			name:             "partially filled",
+			order:            AccountOrder{SellAmount: 1000},
+			bookOrder:        &Order{Token0Balance: 400, Token1Balance: 1200, TradeDirection: tradeDirectionSell0},
+			wantStatus:       OrderPartiallyFilled,
+			wantSold:         600,
+			wantBought:       1200,
+			wantWithdrawable: map[string]uint64{"A": 400, "B": 1200},
+		},
+		{
+			name:             "filled selling token 1",
+			order:            AccountOrder{SellAmount: 1000, TokenToSell: "B", TokenToBuy: "A"},
+			bookOrder:        &Order{Token0Balance: 500, TradeDirection: 1},
+			wantStatus:       OrderFilled,
+			wantSold:         1000,
+			wantBought:       500,
+			wantWithdrawable: map[string]uint64{"A": 500},
+		},
+	}
+	for _, tt := range tests {
+		order := tt.order
+		order.OrderID = "order"
+		order.PoolID = "ab"
+		if order.TokenToSell == "" {
+			order.TokenToSell, order.TokenToBuy = "A", "B"
+		}
+		if tt.bookOrder != nil {
+			tt.bookOrder.Id = "order"
+		}
+		updateOrderStatus(&order, bookState(tt.bookOrder), now)
+		if order.Status != tt.wantStatus || order.SoldAmount != tt.wantSold || order.BoughtAmount != tt.wantBought {
+			t.Errorf("%v: got %v sold %v bought %v, want %v %v %v", tt.name,
+				order.Status, order.SoldAmount, order.BoughtAmount, tt.wantStatus, tt.wantSold, tt.wantBought)
+		}
+		if !reflect.DeepEqual(order.Withdrawable, tt.wantWithdrawable) {
+			t.Errorf("%v: withdrawable %v, want %v", tt.name, order.Withdrawable, tt.wantWithdrawable)
+		}
+		if tt.bookOrder != nil && !order.SeenInBook {
+			t.Errorf("%v: order in the book is not marked seen", tt.name)
+		}
+	}
+}
@@ -1,6 +1,207 @@
 package pdexservice
 
-func InitPDexService() (*PDexService, error) {
-	service := &PDexService{}
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/obsidianwallet/obsidian-wallet-node/database"
+	"github.com/obsidianwallet/obsidian-wallet-node/tokenregistry"
+	"github.com/obsidianwallet/obsidian-wallet-node/walletmanager"
+)
+
+func InitPDexService(db *database.Database, wlm *walletmanager.WalletManager, tokens *tokenregistry.TokenRegistry) (*PDexService, error) {
+	service := &PDexService{db: db, wlm: wlm, tokens: tokens}
 	return service, nil
 }
+
+// refreshState keeps the pDEX state of the current network up to date until
+// ctx is cancelled.
+func (pdexServ *PDexService) refreshState(ctx context.Context) {
+	defer pdexServ.workers.Done()
+	for {
+		if err := pdexServ.updateState(); err != nil {
+			log.Error().Msgf("update pdex state failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(refreshStateInterval):
+		}
+	}
+}
+
+func (pdexServ *PDexService) updateState() error {
+	pdexServ.lock.RLock()
+	client := pdexServ.incclient
+	network := pdexServ.currentNetwork.Name
+	reportRPCError := pdexServ.rpcErrorHandler
+	last := pdexServ.state
+	pdexServ.lock.RUnlock()
+	if client == nil {
+		return errors.New("no chain client")
+	}
+
+	state, err := pdexServ.fetchState(client, last)
+	if err != nil {
+		if reportRPCError != nil {
+			reportRPCError(client, err)
+		}
+		return err
+	}
+	if state == nil {
+		return nil
+	}
+	if err := pdexServ.saveState(network, state); err != nil {
+		return err
+	}
+	// access NFTs are not in the chain token list
+	nftIDs := make([]string, 0, len(state.NftIDs))
+	for nftID := range state.NftIDs {
+		nftIDs = append(nftIDs, nftID)
+	}
+	if err := pdexServ.wlm.RegisterTokenIDs(nftIDs); err != nil {
+		return err
+	}
+	// without the orderbook every order would look closed
+	if state.Verbosity >= pdexv3StateVerbosity {
+		if err := pdexServ.trackOrders(network, state); err != nil {
+			return err
+		}
+	}
+	if err := pdexServ.cacheStakingPositions(network, state); err != nil {
+		return err
+	}
+
+	pdexServ.lock.Lock()
+	defer pdexServ.lock.Unlock()
+	// the network may have been switched while fetching
+	if pdexServ.currentNetwork.Name == network {
+		pdexServ.state = state
+	}
+	return nil
+}
+
+func (pdexServ *PDexService) getState() (*Pdexv3State, error) {
+	pdexServ.lock.RLock()
+	defer pdexServ.lock.RUnlock()
+	if pdexServ.state == nil {
+		return nil, ErrStateNotReady
+	}
+	return pdexServ.state, nil
+}
+
+// ListPools returns the pools of the current network matching filter,
+// largest liquidity first.
+func (pdexServ *PDexService) ListPools(filter PoolFilter) ([]PoolInfo, error) {
+	state, err := pdexServ.getState()
+	if err != nil {
+		return nil, err
+	}
+	result := []PoolInfo{}
+	for poolID, pool := range state.PoolPairs {
+		if !filter.match(pool.State.Token0ID, pool.State.Token1ID) {
+			continue
+		}
+		result = append(result, buildPoolInfo(state, poolID, pool))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ShareAmount != result[j].ShareAmount {
+			return result[i].ShareAmount > result[j].ShareAmount
+		}
+		return result[i].PoolID < result[j].PoolID
+	})
+	return result, nil
+}
+
+func (pdexServ *PDexService) GetPool(poolID string) (*PoolInfo, error) {
+	state, err := pdexServ.getState()
+	if err != nil {
+		return nil, err
+	}
+	pool, ok := state.PoolPairs[poolID]
+	if !ok {
+		return nil, ErrPoolNotFound
+	}
+	info := buildPoolInfo(state, poolID, pool)
+	return &info, nil
+}
+
+// ListPairs returns the token pairs of the current network matching filter.
+func (pdexServ *PDexService) ListPairs(filter PoolFilter) ([]PairInfo, error) {
+	state, err := pdexServ.getState()
+	if err != nil {
+		return nil, err
+	}
+	pairs := make(map[string]*PairInfo)
+	for poolID, pool := range state.PoolPairs {
+		if !filter.match(pool.State.Token0ID, pool.State.Token1ID) {
+			continue
+		}
+		pairID := buildPairID(pool.State.Token0ID, pool.State.Token1ID)
+		pair, ok := pairs[pairID]
+		if !ok {
+			pair = &PairInfo{
+				PairID:   pairID,
+				Token0ID: pool.State.Token0ID,
+				Token1ID: pool.State.Token1ID,
+			}
+			pairs[pairID] = pair
+		}
+		pair.Token0Amount += pool.State.Token0RealAmount
+		pair.Token1Amount += pool.State.Token1RealAmount
+		pair.PoolIDs = append(pair.PoolIDs, poolID)
+	}
+	result := []PairInfo{}
+	for _, pair := range pairs {
+		sort.Strings(pair.PoolIDs)
+		result = append(result, *pair)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].PairID < result[j].PairID
+	})
+	return result, nil
+}
+
+func buildPoolInfo(state *Pdexv3State, poolID string, pool *PoolPairState) PoolInfo {
+	return PoolInfo{
+		PoolID:              poolID,
+		Token0ID:            pool.State.Token0ID,
+		Token1ID:            pool.State.Token1ID,
+		Token0Amount:        pool.State.Token0RealAmount,
+		Token1Amount:        pool.State.Token1RealAmount,
+		Token0VirtualAmount: pool.State.Token0VirtualAmount,
+		Token1VirtualAmount: pool.State.Token1VirtualAmount,
+		Amplifier:           pool.State.Amplifier,
+		ShareAmount:         pool.State.ShareAmount,
+		FeeRateBPS:          state.poolFeeRate(poolID),
+	}
+}
+
+// match reports whether a pool of token0 and token1 passes the filter, pair
+// tokens are matched in either order.
+func (filter PoolFilter) match(token0 string, token1 string) bool {
+	if filter.TokenID != "" && token0 != filter.TokenID && token1 != filter.TokenID {
+		return false
+	}
+	if filter.Token0ID != "" && filter.Token1ID != "" {
+		return (token0 == filter.Token0ID && token1 == filter.Token1ID) ||
+			(token0 == filter.Token1ID && token1 == filter.Token0ID)
+	}
+	for _, tokenID := range []string{filter.Token0ID, filter.Token1ID} {
+		if tokenID != "" && token0 != tokenID && token1 != tokenID {
+			return false
+		}
+	}
+	return true
+}
+
+func buildPairID(token0 string, token1 string) string {
+	if token0 > token1 {
+		token0, token1 = token1, token0
+	}
+	return token0 + "-" + token1
+}
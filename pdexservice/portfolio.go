@@ -0,0 +1,336 @@
+package pdexservice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/obsidianwallet/obsidian-wallet-node/database"
+	"github.com/obsidianwallet/obsidian-wallet-node/tokenregistry"
+	"github.com/obsidianwallet/obsidian-wallet-node/walletmanager"
+)
+
+// GetPortfolio values the balances of the account pubkey, of every account
+// when pubkey is empty, in the reference token given by ID or symbol.
+func (pdexServ *PDexService) GetPortfolio(reference string, pubkey string) (*Portfolio, error) {
+	state, err := pdexServ.getState()
+	if err != nil {
+		return nil, err
+	}
+	refToken, err := pdexServ.resolveReference(reference)
+	if err != nil {
+		return nil, err
+	}
+	accounts := pdexServ.wlm.ListAccountInstances()
+	if pubkey != "" {
+		account, ok := accounts[pubkey]
+		if !ok {
+			return nil, walletmanager.ErrAccountNotFound
+		}
+		accounts = map[string]*walletmanager.RuntimeAccount{pubkey: account}
+	}
+
+	portfolio := buildPortfolio(state, accounts, refToken.TokenID)
+	portfolio.ValueFormatted = tokenregistry.FormatAmount(portfolio.Value, refToken.Decimals)
+	for idx := range portfolio.Accounts {
+		account := &portfolio.Accounts[idx]
+		account.ValueFormatted = tokenregistry.FormatAmount(account.Value, refToken.Decimals)
+		for hIdx := range account.Holdings {
+			holding := &account.Holdings[hIdx]
+			if holding.Priced {
+				holding.ValueFormatted = tokenregistry.FormatAmount(holding.Value, refToken.Decimals)
+			}
+		}
+	}
+	return portfolio, nil
+}
+
+// GetPortfolioHistory returns the snapshotted values of the account pubkey,
+// of the whole wallet when pubkey is empty, between from and to. Only the
+// reference tokens of the snapshots have a history.
+func (pdexServ *PDexService) GetPortfolioHistory(reference string, pubkey string, from int64, to int64) ([]PortfolioPoint, error) {
+	refToken, err := pdexServ.resolveReference(reference)
+	if err != nil {
+		return nil, err
+	}
+	pdexServ.lock.RLock()
+	network := pdexServ.currentNetwork.Name
+	pdexServ.lock.RUnlock()
+
+	result := []PortfolioPoint{}
+	prefix := []byte(dbPdexPortfolioPrefix + network + "-")
+	err = pdexServ.db.DB.ReadIteratorCopy(prefix, false, func(k []byte, v []byte) (bool, error) {
+		var snapshot PortfolioSnapshot
+		if err := json.Unmarshal(v, &snapshot); err != nil {
+			return true, err
+		}
+		if snapshot.Time < from {
+			return false, nil
+		}
+		if to > 0 && snapshot.Time > to {
+			return true, nil
+		}
+		value, ok := snapshot.Values[refToken.TokenID]
+		if pubkey != "" {
+			value, ok = snapshot.Accounts[pubkey][refToken.TokenID]
+		}
+		if ok {
+			result = append(result, PortfolioPoint{
+				Time:           snapshot.Time,
+				Value:          value,
+				ValueFormatted: tokenregistry.FormatAmount(value, refToken.Decimals),
+			})
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// snapshotPortfolio saves the value of the wallet every
+// portfolioSnapshotInterval until ctx is cancelled.
+func (pdexServ *PDexService) snapshotPortfolio(ctx context.Context) {
+	defer pdexServ.workers.Done()
+	wait := pdexServ.nextSnapshotDelay()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait = portfolioSnapshotInterval
+		if err := pdexServ.takePortfolioSnapshot(); err != nil {
+			log.Error().Msgf("portfolio snapshot failed: %v", err)
+			wait = refreshStateInterval
+		}
+	}
+}
+
+func (pdexServ *PDexService) takePortfolioSnapshot() error {
+	state, err := pdexServ.getState()
+	if err != nil {
+		return err
+	}
+	pdexServ.lock.RLock()
+	network := pdexServ.currentNetwork.Name
+	pdexServ.lock.RUnlock()
+
+	now := time.Now()
+	snapshot := PortfolioSnapshot{
+		Time:         now.Unix(),
+		BeaconHeight: state.BeaconHeight,
+		Values:       make(map[string]uint64),
+		Accounts:     make(map[string]map[string]uint64),
+	}
+	accounts := pdexServ.wlm.ListAccountInstances()
+	for _, symbol := range portfolioReferenceSymbols {
+		refToken, err := pdexServ.resolveReference(symbol)
+		if err != nil {
+			// not every network has every reference token
+			continue
+		}
+		portfolio := buildPortfolio(state, accounts, refToken.TokenID)
+		snapshot.Values[refToken.TokenID] = portfolio.Value
+		for _, account := range portfolio.Accounts {
+			if snapshot.Accounts[account.Pubkey] == nil {
+				snapshot.Accounts[account.Pubkey] = make(map[string]uint64)
+			}
+			snapshot.Accounts[account.Pubkey][refToken.TokenID] = account.Value
+		}
+	}
+	snapshotBytes, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	err = pdexServ.db.DB.Set([]byte(dbPdexPortfolioPrefix), []database.Object{{
+		Key:   buildPortfolioSnapshotKey(network, snapshot.Time),
+		Value: snapshotBytes,
+	}})
+	if err != nil {
+		return err
+	}
+	return pdexServ.pruneSnapshots(network, now.Add(-portfolioSnapshotRetention).Unix())
+}
+
+func (pdexServ *PDexService) pruneSnapshots(network string, before int64) error {
+	var expired [][]byte
+	prefix := []byte(dbPdexPortfolioPrefix + network + "-")
+	beforeKey := string(buildPortfolioSnapshotKey(network, before))
+	err := pdexServ.db.DB.ReadIteratorCopy(prefix, false, func(k []byte, v []byte) (bool, error) {
+		key := k[len(dbPdexPortfolioPrefix):]
+		if string(key) >= beforeKey {
+			return true, nil
+		}
+		expired = append(expired, append([]byte{}, key...))
+		return false, nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range expired {
+		if err := pdexServ.db.DB.Delete([]byte(dbPdexPortfolioPrefix), key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextSnapshotDelay is the time left before the next snapshot of the
+// current network is due.
+func (pdexServ *PDexService) nextSnapshotDelay() time.Duration {
+	pdexServ.lock.RLock()
+	network := pdexServ.currentNetwork.Name
+	pdexServ.lock.RUnlock()
+	var last int64
+	prefix := []byte(dbPdexPortfolioPrefix + network + "-")
+	err := pdexServ.db.DB.ReadIteratorCopy(prefix, true, func(k []byte, v []byte) (bool, error) {
+		var snapshot PortfolioSnapshot
+		if err := json.Unmarshal(v, &snapshot); err != nil {
+			return true, err
+		}
+		last = snapshot.Time
+		return true, nil
+	})
+	if err != nil {
+		return 0
+	}
+	delay := time.Until(time.Unix(last, 0).Add(portfolioSnapshotInterval))
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+func (pdexServ *PDexService) resolveReference(reference string) (*tokenregistry.Token, error) {
+	if token, err := pdexServ.tokens.GetToken(reference); err == nil {
+		return token, nil
+	}
+	token, err := pdexServ.tokens.FindBySymbol(reference)
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", ErrUnknownReference, reference)
+	}
+	return token, nil
+}
+
+func buildPortfolio(state *Pdexv3State, accounts map[string]*walletmanager.RuntimeAccount, refTokenID string) *Portfolio {
+	portfolio := &Portfolio{
+		ReferenceTokenID: refTokenID,
+		BeaconHeight:     state.BeaconHeight,
+		Accounts:         []AccountPortfolio{},
+	}
+	prices := make(map[string]*big.Float)
+	for pubkey, account := range accounts {
+		accountPortfolio := AccountPortfolio{
+			Pubkey:   pubkey,
+			Name:     account.GetAccount().Name,
+			Holdings: []Holding{},
+		}
+		for tokenID, balance := range account.GetBalances() {
+			if _, isNFT := state.NftIDs[tokenID]; isNFT || balance == 0 {
+				continue
+			}
+			price, ok := prices[tokenID]
+			if !ok {
+				price = midPriceTo(state, tokenID, refTokenID)
+				prices[tokenID] = price
+			}
+			holding := Holding{TokenID: tokenID, Balance: balance}
+			if price != nil {
+				value, _ := new(big.Float).Mul(new(big.Float).SetUint64(balance), price).Int(nil)
+				if value.IsUint64() {
+					holding.Value = value.Uint64()
+					holding.Priced = true
+					accountPortfolio.Value += holding.Value
+				}
+			}
+			accountPortfolio.Holdings = append(accountPortfolio.Holdings, holding)
+		}
+		sort.Slice(accountPortfolio.Holdings, func(i, j int) bool {
+			holdings := accountPortfolio.Holdings
+			if holdings[i].Value != holdings[j].Value {
+				return holdings[i].Value > holdings[j].Value
+			}
+			return holdings[i].TokenID < holdings[j].TokenID
+		})
+		portfolio.Value += accountPortfolio.Value
+		portfolio.Accounts = append(portfolio.Accounts, accountPortfolio)
+	}
+	sort.Slice(portfolio.Accounts, func(i, j int) bool {
+		if portfolio.Accounts[i].Name != portfolio.Accounts[j].Name {
+			return portfolio.Accounts[i].Name < portfolio.Accounts[j].Name
+		}
+		return portfolio.Accounts[i].Pubkey < portfolio.Accounts[j].Pubkey
+	})
+	return portfolio
+}
+
+type priceRoute struct {
+	pools  []string
+	tokens []string
+}
+
+// midPriceTo returns the value of one unit of tokenID in refTokenID at mid
+// price, nil when no route leads to refTokenID. The route with the fewest
+// pools is used and, among those, the one whose first pool is the deepest.
+func midPriceTo(state *Pdexv3State, tokenID string, refTokenID string) *big.Float {
+	if tokenID == refTokenID {
+		return big.NewFloat(1)
+	}
+	poolsByToken := state.poolsByToken()
+	frontier := []priceRoute{{tokens: []string{tokenID}}}
+	for hop := 0; hop < maxTradeHops && len(frontier) > 0; hop++ {
+		var best *priceRoute
+		var bestDepth *big.Int
+		var next []priceRoute
+		for _, route := range frontier {
+			current := route.tokens[len(route.tokens)-1]
+			for _, poolID := range poolsByToken[current] {
+				other := state.PoolPairs[poolID].otherToken(current)
+				if containsToken(route.tokens, other) {
+					continue
+				}
+				nextRoute := priceRoute{
+					pools:  append(append([]string{}, route.pools...), poolID),
+					tokens: append(append([]string{}, route.tokens...), other),
+				}
+				if other != refTokenID {
+					next = append(next, nextRoute)
+					continue
+				}
+				depth, _, _ := state.PoolPairs[nextRoute.pools[0]].reserves(tokenID)
+				if depth == nil {
+					continue
+				}
+				if best == nil || depth.Cmp(bestDepth) > 0 ||
+					(depth.Cmp(bestDepth) == 0 && strings.Join(nextRoute.pools, ",") < strings.Join(best.pools, ",")) {
+					best, bestDepth = &nextRoute, depth
+				}
+			}
+		}
+		if best != nil {
+			price := big.NewFloat(1)
+			for idx, poolID := range best.pools {
+				price.Mul(price, state.PoolPairs[poolID].midPrice(best.tokens[idx]))
+			}
+			if price.Sign() == 0 {
+				return nil
+			}
+			return price
+		}
+		frontier = next
+	}
+	return nil
+}
+
+func buildPortfolioSnapshotKey(network string, timestamp int64) []byte {
+	// zero padded so the keys sort by time
+	return []byte(fmt.Sprintf("%v-%020d", network, timestamp))
+}
@@ -0,0 +1,80 @@
+package pdexservice
+
+import "testing"
+
+func TestMidPriceTo(t *testing.T) {
+	tests := []struct {
+		name  string
+		pools map[string]*PoolPairState
+		token string
+		// want is 0 when there is no price
+		want float64
+	}{
+		{
+			name:  "reference token",
+			token: "P",
+			want:  1,
+		},
+		{
+			name:  "direct pool",
+			pools: map[string]*PoolPairState{"ap": newTestPool("A", "P", 1000000, 500000)},
+			token: "A",
+			want:  0.5,
+		},
+		{
+			name:  "reversed pool",
+			pools: map[string]*PoolPairState{"pa": newTestPool("P", "A", 500000, 1000000)},
+			token: "A",
+			want:  0.5,
+		},
+		{
+			name: "deepest direct pool",
+			pools: map[string]*PoolPairState{
+				"ap1": newTestPool("A", "P", 100, 100),
+				"ap2": newTestPool("A", "P", 1000000, 2000000),
+			},
+			token: "A",
+			want:  2,
+		},
+		{
+			name: "fewest hops before depth",
+			pools: map[string]*PoolPairState{
+				"ap": newTestPool("A", "P", 10, 10),
+				"ab": newTestPool("A", "B", 1000000, 2000000),
+				"bp": newTestPool("B", "P", 1000000, 3000000),
+			},
+			token: "A",
+			want:  1,
+		},
+		{
+			name: "two hops",
+			pools: map[string]*PoolPairState{
+				"ab": newTestPool("A", "B", 1000, 2000),
+				"bp": newTestPool("B", "P", 1000000, 3000000),
+			},
+			token: "A",
+			want:  6,
+		},
+		{
+			name:  "no route",
+			pools: map[string]*PoolPairState{"ab": newTestPool("A", "B", 1000, 2000)},
+			token: "A",
+		},
+	}
+	for _, tt := range tests {
+		price := midPriceTo(newTestState(tt.pools), tt.token, "P")
+		if tt.want == 0 {
+			if price != nil {
+				t.Errorf("%v: got price %v, want none", tt.name, price)
+			}
+			continue
+		}
+		if price == nil {
+			t.Errorf("%v: got no price, want %v", tt.name, tt.want)
+			continue
+		}
+		if got, _ := price.Float64(); got != tt.want {
+			t.Errorf("%v: got price %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package pdexservice
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/incognitochain/go-incognito-sdk-v2/coin"
+	"github.com/incognitochain/go-incognito-sdk-v2/common"
+	"github.com/incognitochain/go-incognito-sdk-v2/common/base58"
+	"github.com/incognitochain/go-incognito-sdk-v2/key"
+	"github.com/incognitochain/go-incognito-sdk-v2/wallet"
+)
+
+// OTAReceiver is a one-time address the beacon mints pDEX outputs to, so
+// responses cannot be linked to the payment address of the account.
+type OTAReceiver struct {
+	PublicKey []byte
+	TxRandom  coin.TxRandom
+}
+
+func newOTAReceiver(paymentAddress key.PaymentAddress) (*OTAReceiver, error) {
+	outCoin, err := coin.NewCoinFromPaymentInfo(&key.PaymentInfo{
+		PaymentAddress: paymentAddress,
+		Amount:         0,
+		Message:        []byte{},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &OTAReceiver{
+		PublicKey: outCoin.GetPublicKey().ToBytesS(),
+		TxRandom:  *outCoin.GetTxRandom(),
+	}, nil
+}
+
+// newOTAReceivers builds one receiver per token for the account at
+// paymentAddress.
+func newOTAReceivers(paymentAddress string, tokenIDs ...string) (map[string]OTAReceiver, error) {
+	addrWallet, err := wallet.Base58CheckDeserialize(paymentAddress)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrWallet.KeySet.PaymentAddress.Pk) == 0 {
+		return nil, errors.New("invalid payment address")
+	}
+	result := make(map[string]OTAReceiver)
+	for _, tokenID := range tokenIDs {
+		if _, ok := result[tokenID]; ok {
+			continue
+		}
+		receiver, err := newOTAReceiver(addrWallet.KeySet.PaymentAddress)
+		if err != nil {
+			return nil, err
+		}
+		result[tokenID] = *receiver
+	}
+	return result, nil
+}
+
+func (recv OTAReceiver) Bytes() []byte {
+	rawBytes := []byte{otaReceiverType}
+	rawBytes = append(rawBytes, recv.PublicKey...)
+	rawBytes = append(rawBytes, recv.TxRandom.Bytes()...)
+	return rawBytes
+}
+
+func (recv OTAReceiver) String() string {
+	return base58.Base58Check{}.NewEncode(recv.Bytes(), common.ZeroByte)
+}
+
+func (recv OTAReceiver) MarshalJSON() ([]byte, error) {
+	return json.Marshal(recv.String())
+}
@@ -0,0 +1,261 @@
+package pdexservice
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/incognitochain/go-incognito-sdk-v2/common"
+	"github.com/incognitochain/go-incognito-sdk-v2/metadata"
+
+	"github.com/obsidianwallet/obsidian-wallet-node/database"
+	"github.com/obsidianwallet/obsidian-wallet-node/walletmanager"
+)
+
+type StakeParam struct {
+	TokenID string
+	Amount  uint64
+	// NftID defaults to the first access NFT of the account
+	NftID string
+	TxFee uint64
+}
+
+// ListStakingPools returns the staking pools of the current network, largest
+// first.
+func (pdexServ *PDexService) ListStakingPools() ([]StakingPoolInfo, error) {
+	state, err := pdexServ.getState()
+	if err != nil {
+		return nil, err
+	}
+	result := []StakingPoolInfo{}
+	for tokenID, pool := range state.StakingPools {
+		result = append(result, StakingPoolInfo{
+			TokenID:     tokenID,
+			Liquidity:   pool.Liquidity,
+			Stakers:     len(pool.Stakers),
+			RewardShare: state.Params.StakingPoolsShare[tokenID],
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Liquidity != result[j].Liquidity {
+			return result[i].Liquidity > result[j].Liquidity
+		}
+		return result[i].TokenID < result[j].TokenID
+	})
+	return result, nil
+}
+
+// Stake burns Amount of TokenID into its staking pool under the access NFT.
+func (pdexServ *PDexService) Stake(account *walletmanager.RuntimeAccount, param StakeParam) (string, error) {
+	state, err := pdexServ.getState()
+	if err != nil {
+		return "", err
+	}
+	if _, ok := state.StakingPools[param.TokenID]; !ok {
+		return "", ErrStakingPoolNotFound
+	}
+	if param.Amount == 0 {
+		return "", errors.New("stake amount must be greater than 0")
+	}
+	nftID, err := pickNFT(state, account, param.NftID)
+	if err != nil {
+		return "", err
+	}
+	// the receiver gets the tokens back if the beacon rejects the request
+	receivers, err := newOTAReceivers(account.GetAccount().PaymentAddress, param.TokenID)
+	if err != nil {
+		return "", err
+	}
+	md := &StakingRequest{
+		TokenID:      param.TokenID,
+		OtaReceiver:  receivers[param.TokenID].String(),
+		NftID:        nftID,
+		TokenAmount:  param.Amount,
+		MetadataBase: *metadata.NewMetadataBase(pdexv3StakingRequestMeta),
+	}
+	return account.CreateAndSendTransaction(walletmanager.TxParam{
+		TokenID:   param.TokenID,
+		Receivers: []walletmanager.TxReceiver{{PaymentAddress: common.BurningAddress2, Amount: param.Amount}},
+		Fee:       param.TxFee,
+		Metadata:  md,
+	})
+}
+
+// Unstake withdraws amount of the NFT stake in the staking pool of tokenID.
+func (pdexServ *PDexService) Unstake(account *walletmanager.RuntimeAccount, tokenID string, nftID string, amount uint64, txFee uint64) (string, error) {
+	state, err := pdexServ.getState()
+	if err != nil {
+		return "", err
+	}
+	_, staker, err := checkStaker(state, account, tokenID, nftID)
+	if err != nil {
+		return "", err
+	}
+	if amount == 0 || amount > staker.Liquidity {
+		return "", errors.New("unstake amount must be between 1 and the staked amount")
+	}
+	receivers, err := newOTAReceivers(account.GetAccount().PaymentAddress, tokenID, nftID)
+	if err != nil {
+		return "", err
+	}
+	md := &UnstakingRequest{
+		StakingPoolID:   tokenID,
+		OtaReceivers:    receivers,
+		NftID:           nftID,
+		UnstakingAmount: amount,
+		MetadataBase:    *metadata.NewMetadataBase(pdexv3UnstakingRequestMeta),
+	}
+	return sendNFTAccessTx(account, nftID, md, txFee)
+}
+
+// ClaimStakingRewards withdraws the rewards the NFT earned in the staking
+// pool of tokenID.
+func (pdexServ *PDexService) ClaimStakingRewards(account *walletmanager.RuntimeAccount, tokenID string, nftID string, txFee uint64) (string, error) {
+	state, err := pdexServ.getState()
+	if err != nil {
+		return "", err
+	}
+	pool, staker, err := checkStaker(state, account, tokenID, nftID)
+	if err != nil {
+		return "", err
+	}
+	receiverTokens := []string{nftID}
+	for rewardTokenID := range stakingRewards(pool, staker) {
+		receiverTokens = append(receiverTokens, rewardTokenID)
+	}
+	receivers, err := newOTAReceivers(account.GetAccount().PaymentAddress, receiverTokens...)
+	if err != nil {
+		return "", err
+	}
+	md := &WithdrawStakingRewardRequest{
+		StakingPoolID: tokenID,
+		NftID:         nftID,
+		Receivers:     receivers,
+		MetadataBase:  *metadata.NewMetadataBase(pdexv3WithdrawStakingRewardMeta),
+	}
+	return sendNFTAccessTx(account, nftID, md, txFee)
+}
+
+// ListStakingPositions returns the staking positions of the account cached
+// at the last state refresh, computing them when there are none yet.
+func (pdexServ *PDexService) ListStakingPositions(account *walletmanager.RuntimeAccount) (*StakingPositions, error) {
+	pdexServ.lock.RLock()
+	network := pdexServ.currentNetwork.Name
+	pdexServ.lock.RUnlock()
+	value, err := pdexServ.db.DB.Get([]byte(dbPdexStakingPrefix), buildStakingKey(network, account.Pubkey()))
+	if err == nil {
+		var positions StakingPositions
+		if err := json.Unmarshal(value, &positions); err != nil {
+			return nil, err
+		}
+		return &positions, nil
+	}
+	if err != badger.ErrKeyNotFound {
+		return nil, err
+	}
+	state, err := pdexServ.getState()
+	if err != nil {
+		return nil, err
+	}
+	return buildStakingPositions(state, account), nil
+}
+
+// cacheStakingPositions computes the staking positions of every account
+// from state and saves them for network.
+func (pdexServ *PDexService) cacheStakingPositions(network string, state *Pdexv3State) error {
+	var objs []database.Object
+	for pubkey, account := range pdexServ.wlm.ListAccountInstances() {
+		positionsBytes, err := json.Marshal(buildStakingPositions(state, account))
+		if err != nil {
+			return err
+		}
+		objs = append(objs, database.Object{
+			Key:   buildStakingKey(network, pubkey),
+			Value: positionsBytes,
+		})
+	}
+	if len(objs) == 0 {
+		return nil
+	}
+	return pdexServ.db.DB.Set([]byte(dbPdexStakingPrefix), objs)
+}
+
+func buildStakingPositions(state *Pdexv3State, account *walletmanager.RuntimeAccount) *StakingPositions {
+	result := &StakingPositions{
+		BeaconHeight: state.BeaconHeight,
+		Positions:    []StakingPosition{},
+	}
+	for _, nftID := range accountNFTs(state, account) {
+		for tokenID, pool := range state.StakingPools {
+			staker, ok := pool.Stakers[nftID]
+			if !ok {
+				continue
+			}
+			rewards := stakingRewards(pool, staker)
+			if staker.Liquidity == 0 && len(rewards) == 0 {
+				continue
+			}
+			result.Positions = append(result.Positions, StakingPosition{
+				NftID:       nftID,
+				TokenID:     tokenID,
+				Amount:      staker.Liquidity,
+				TotalStaked: pool.Liquidity,
+				Rewards:     rewards,
+			})
+		}
+	}
+	sort.Slice(result.Positions, func(i, j int) bool {
+		if result.Positions[i].NftID != result.Positions[j].NftID {
+			return result.Positions[i].NftID < result.Positions[j].NftID
+		}
+		return result.Positions[i].TokenID < result.Positions[j].TokenID
+	})
+	return result
+}
+
+// stakingRewards returns the claimable rewards of staker, the ones already
+// credited plus the ones accrued since its stake last changed.
+func stakingRewards(pool *StakingPoolState, staker *Staker) map[string]uint64 {
+	rewards := make(map[string]uint64)
+	for tokenID, reward := range staker.Rewards {
+		if reward > 0 {
+			rewards[tokenID] += reward
+		}
+	}
+	for tokenID, rewardsPerShare := range pool.RewardsPerShare {
+		accrued := new(big.Int).Set(rewardsPerShare)
+		if last, ok := staker.LastRewardsPerShare[tokenID]; ok && last != nil {
+			accrued.Sub(accrued, last)
+		}
+		if accrued.Sign() <= 0 {
+			continue
+		}
+		accrued.Mul(accrued, new(big.Int).SetUint64(staker.Liquidity))
+		accrued.Div(accrued, new(big.Int).SetUint64(lpFeesPerShareBase))
+		if accrued.IsUint64() && accrued.Uint64() > 0 {
+			rewards[tokenID] += accrued.Uint64()
+		}
+	}
+	return rewards
+}
+
+func checkStaker(state *Pdexv3State, account *walletmanager.RuntimeAccount, tokenID string, nftID string) (*StakingPoolState, *Staker, error) {
+	pool, ok := state.StakingPools[tokenID]
+	if !ok {
+		return nil, nil, ErrStakingPoolNotFound
+	}
+	if _, err := pickNFT(state, account, nftID); err != nil {
+		return nil, nil, err
+	}
+	staker, ok := pool.Stakers[nftID]
+	if !ok {
+		return nil, nil, ErrNotStaking
+	}
+	return pool, staker, nil
+}
+
+func buildStakingKey(network string, pubkey string) []byte {
+	return []byte(network + "-" + pubkey)
+}
@@ -0,0 +1,58 @@
+package pdexservice
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestStakingRewards(t *testing.T) {
+	perShare := func(value string) *big.Int {
+		result, ok := new(big.Int).SetString(value, 10)
+		if !ok {
+			t.Fatalf("invalid number %v", value)
+		}
+		return result
+	}
+	tests := []struct {
+		name   string
+		pool   StakingPoolState
+		staker Staker
+		want   map[string]uint64
+	}{
+		{
+			name:   "stored rewards only",
+			staker: Staker{Liquidity: 50, Rewards: map[string]uint64{"P": 100, "Q": 0}},
+			want:   map[string]uint64{"P": 100},
+		},
+		{
+			name:   "accrued since the last claim",
+			pool:   StakingPoolState{RewardsPerShare: map[string]*big.Int{"P": perShare("3000000000000000000")}},
+			staker: Staker{Liquidity: 50, Rewards: map[string]uint64{"P": 5}, LastRewardsPerShare: map[string]*big.Int{"P": perShare("1000000000000000000")}},
+			want:   map[string]uint64{"P": 105},
+		},
+		{
+			name:   "no last rewards per share",
+			pool:   StakingPoolState{RewardsPerShare: map[string]*big.Int{"P": perShare("1500000000000000000")}},
+			staker: Staker{Liquidity: 10},
+			want:   map[string]uint64{"P": 15},
+		},
+		{
+			name:   "rewards per share not above the last one",
+			pool:   StakingPoolState{RewardsPerShare: map[string]*big.Int{"P": perShare("1000000000000000000")}},
+			staker: Staker{Liquidity: 10, LastRewardsPerShare: map[string]*big.Int{"P": perShare("2000000000000000000")}},
+			want:   map[string]uint64{},
+		},
+		{
+			name:   "accrued below one unit",
+			pool:   StakingPoolState{RewardsPerShare: map[string]*big.Int{"P": perShare("1")}},
+			staker: Staker{Liquidity: 1},
+			want:   map[string]uint64{},
+		},
+	}
+	for _, tt := range tests {
+		if got := stakingRewards(&tt.pool, &tt.staker); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1 +1,135 @@
 package pdexservice
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/incognitochain/go-incognito-sdk-v2/incclient"
+	"github.com/incognitochain/go-incognito-sdk-v2/rpchandler"
+
+	"github.com/obsidianwallet/obsidian-wallet-node/database"
+)
+
+type pdexv3StateFilter struct {
+	Key       string
+	Verbosity uint
+}
+
+type pdexv3StateRequest struct {
+	BeaconHeight uint64
+	Filter       pdexv3StateFilter
+}
+
+// fetchState fetches the pDEX v3 state at the best beacon height, with the
+// shares, orders and stakers only when an account holds an access NFT. It
+// returns nil when last is still up to date.
+func (pdexServ *PDexService) fetchState(client *incclient.IncClient, last *Pdexv3State) (*Pdexv3State, error) {
+	bestBlocks, err := client.GetBestBlock()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get best blocks: %v", err)
+	}
+	beaconHeight := bestBlocks[-1]
+
+	verbosity := uint(pdexv3PoolsVerbosity)
+	if last != nil && pdexServ.holdsNFT(last.NftIDs) {
+		verbosity = pdexv3StateVerbosity
+	}
+	if last != nil && last.BeaconHeight == beaconHeight && last.Verbosity >= verbosity {
+		return nil, nil
+	}
+	state, err := getPdexv3State(client, beaconHeight, verbosity)
+	if err != nil {
+		return nil, err
+	}
+	// the NFTs of the accounts may have been minted since the last state
+	if verbosity < pdexv3StateVerbosity && pdexServ.holdsNFT(state.NftIDs) {
+		return getPdexv3State(client, beaconHeight, pdexv3StateVerbosity)
+	}
+	return state, nil
+}
+
+// holdsNFT tells whether an account of the wallet holds one of nftIDs.
+func (pdexServ *PDexService) holdsNFT(nftIDs map[string]uint64) bool {
+	for _, account := range pdexServ.wlm.ListAccountInstances() {
+		for tokenID, balance := range account.GetBalances() {
+			if _, ok := nftIDs[tokenID]; ok && balance > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getPdexv3State fetches the pDEX v3 state at beaconHeight. The SDK has no
+// pDEX v3 support, so the RPC is called directly.
+func getPdexv3State(client *incclient.IncClient, beaconHeight uint64, verbosity uint) (*Pdexv3State, error) {
+	params := []interface{}{pdexv3StateRequest{
+		BeaconHeight: beaconHeight,
+		Filter:       pdexv3StateFilter{Key: "All", Verbosity: verbosity},
+	}}
+	responseInBytes, err := client.NewRPCCall("1.0", "pdexv3_getState", params, 1)
+	if err != nil {
+		return nil, err
+	}
+	var state Pdexv3State
+	if err := rpchandler.ParseResponse(responseInBytes, &state); err != nil {
+		return nil, err
+	}
+	state.BeaconHeight = beaconHeight
+	state.Verbosity = verbosity
+	if state.PoolPairs == nil {
+		state.PoolPairs = make(map[string]*PoolPairState)
+	}
+	if state.StakingPools == nil {
+		state.StakingPools = make(map[string]*StakingPoolState)
+	}
+	if state.NftIDs == nil {
+		state.NftIDs = make(map[string]uint64)
+	}
+	return &state, nil
+}
+
+type contributionStatusRequest struct {
+	PairHash string
+}
+
+func getContributionStatus(client *incclient.IncClient, pairHash string) (*ContributionStatus, error) {
+	params := []interface{}{contributionStatusRequest{PairHash: pairHash}}
+	responseInBytes, err := client.NewRPCCall("1.0", "pdexv3_getContributionStatus", params, 1)
+	if err != nil {
+		return nil, err
+	}
+	var status ContributionStatus
+	if err := rpchandler.ParseResponse(responseInBytes, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func (pdexServ *PDexService) saveState(network string, state *Pdexv3State) error {
+	stateBytes, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return pdexServ.db.DB.Set([]byte(dbPdexStatePrefix), []database.Object{{
+		Key:   []byte(network),
+		Value: stateBytes,
+	}})
+}
+
+// loadState returns the last state cached for network, nil if there is none.
+func (pdexServ *PDexService) loadState(network string) (*Pdexv3State, error) {
+	value, err := pdexServ.db.DB.Get([]byte(dbPdexStatePrefix), []byte(network))
+	if err != nil {
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var state Pdexv3State
+	if err := json.Unmarshal(value, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
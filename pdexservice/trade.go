@@ -0,0 +1,105 @@
+package pdexservice
+
+import (
+	"github.com/incognitochain/go-incognito-sdk-v2/common"
+	"github.com/incognitochain/go-incognito-sdk-v2/metadata"
+
+	"github.com/obsidianwallet/obsidian-wallet-node/walletmanager"
+)
+
+type TradeParam struct {
+	TokenToSell         string
+	TokenToBuy          string
+	SellAmount          uint64
+	MinAcceptableAmount uint64
+	// FeeToken is PRV or TokenToSell, PRV by default. The beacon takes the
+	// trading fee in no other token, so PDEX pays it only when sold.
+	FeeToken string
+	// TxFee is the network fee of the transaction in PRV
+	TxFee uint64
+}
+
+type TradeResult struct {
+	TxHash     string
+	TradingFee uint64
+	// FeeToken is the token TradingFee is paid with
+	FeeToken string
+	Estimate *TradeEstimate
+}
+
+// Trade submits a pDEX v3 trade from account along the best route of the
+// cached state. It refuses to send when the estimated output is below the
+// min acceptable amount, which the beacon enforces again on execution.
+func (pdexServ *PDexService) Trade(account *walletmanager.RuntimeAccount, param TradeParam) (*TradeResult, error) {
+	if param.MinAcceptableAmount == 0 {
+		return nil, ErrMinAmountRequired
+	}
+	if param.FeeToken == "" {
+		param.FeeToken = common.PRVIDStr
+	}
+	if param.FeeToken == PDEXTokenID && param.TokenToSell != PDEXTokenID {
+		return nil, ErrPDEXFeeNotSold
+	}
+	if param.FeeToken != common.PRVIDStr && param.FeeToken != param.TokenToSell {
+		return nil, ErrInvalidFeeToken
+	}
+	estimate, err := pdexServ.EstimateTrade(param.TokenToSell, param.TokenToBuy, param.SellAmount)
+	if err != nil {
+		return nil, err
+	}
+	if estimate.ExpectedAmount < param.MinAcceptableAmount {
+		return nil, ErrBelowMinAcceptable
+	}
+
+	tradingFee := estimate.FeeInSellToken
+	if param.FeeToken == common.PRVIDStr && param.TokenToSell != common.PRVIDStr {
+		if estimate.FeeInPRV == 0 {
+			return nil, ErrNoRoute
+		}
+		tradingFee = estimate.FeeInPRV
+	}
+
+	// refunds go back to the sold token, the PRV fee is refunded too when
+	// the trade is rejected
+	receiverTokens := []string{param.TokenToSell, param.TokenToBuy}
+	if param.FeeToken == common.PRVIDStr {
+		receiverTokens = append(receiverTokens, common.PRVIDStr)
+	}
+	receivers, err := newOTAReceivers(account.GetAccount().PaymentAddress, receiverTokens...)
+	if err != nil {
+		return nil, err
+	}
+	md := &TradeRequest{
+		TradePath:           estimate.Route,
+		TokenToSell:         param.TokenToSell,
+		SellAmount:          param.SellAmount,
+		MinAcceptableAmount: param.MinAcceptableAmount,
+		TradingFee:          tradingFee,
+		Receiver:            receivers,
+		MetadataBase:        *metadata.NewMetadataBase(pdexv3TradeRequestMeta),
+	}
+
+	burnAmount := param.SellAmount
+	var prvBurn []walletmanager.TxReceiver
+	if param.FeeToken == param.TokenToSell {
+		burnAmount += tradingFee
+	} else {
+		prvBurn = []walletmanager.TxReceiver{{PaymentAddress: common.BurningAddress2, Amount: tradingFee}}
+	}
+	txHash, err := account.CreateAndSendTransaction(walletmanager.TxParam{
+		TokenID:      param.TokenToSell,
+		Receivers:    []walletmanager.TxReceiver{{PaymentAddress: common.BurningAddress2, Amount: burnAmount}},
+		PRVReceivers: prvBurn,
+		Fee:          param.TxFee,
+		Metadata:     md,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &TradeResult{
+		TxHash:     txHash,
+		TradingFee: tradingFee,
+		FeeToken:   param.FeeToken,
+		Estimate:   estimate,
+	}, nil
+}
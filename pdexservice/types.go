@@ -1,8 +1,291 @@
 package pdexservice
 
-import "github.com/incognitochain/go-incognito-sdk-v2/incclient"
+import (
+	"context"
+	"math/big"
+	"sync"
 
+	"github.com/incognitochain/go-incognito-sdk-v2/incclient"
+	"github.com/obsidianwallet/obsidian-wallet-node/common"
+	"github.com/obsidianwallet/obsidian-wallet-node/database"
+	"github.com/obsidianwallet/obsidian-wallet-node/tokenregistry"
+	"github.com/obsidianwallet/obsidian-wallet-node/walletmanager"
+)
+
+// PDexService reads the pDEX state from the chain RPC, it does not use the
+// service URLs of the network.
 type PDexService struct {
-	serviceURL string
-	incclient  *incclient.IncClient
+	incclient *incclient.IncClient
+	db        *database.Database
+	wlm       *walletmanager.WalletManager
+	tokens    *tokenregistry.TokenRegistry
+
+	lock           sync.RWMutex
+	currentNetwork common.NetworkID
+	state          *Pdexv3State
+	// rpcErrorHandler is told about the failed chain calls
+	rpcErrorHandler func(client *incclient.IncClient, err error)
+
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+}
+
+// Pdexv3State is the part of the beacon pDEX v3 state the service keeps, as
+// returned by the pdexv3_getState RPC.
+type Pdexv3State struct {
+	BeaconHeight    uint64
+	BeaconTimeStamp int64
+	// Verbosity is the level the state was fetched at, shares, orders and
+	// stakers are only in states fetched at pdexv3StateVerbosity
+	Verbosity uint
+	Params    Pdexv3Params
+	PoolPairs map[string]*PoolPairState
+	// StakingPools are keyed by the staked token ID
+	StakingPools map[string]*StakingPoolState
+	// NftIDs are the access NFTs minted so far with their burnt amount
+	NftIDs map[string]uint64
+}
+
+type Pdexv3Params struct {
+	DefaultFeeRateBPS               uint
+	FeeRateBPS                      map[string]uint
+	PRVDiscountPercent              uint
+	TradingProtocolFeePercent       uint
+	TradingStakingPoolRewardPercent uint
+	MintNftRequireAmount            uint64
+	MaxOrdersPerNft                 uint
+	// StakingPoolsShare is the weight of each staking pool in the PDEX
+	// block rewards
+	StakingPoolsShare map[string]uint
+}
+
+type PoolPairState struct {
+	State           PoolPair
+	Shares          map[string]*Share
+	Orderbook       Orderbook
+	LpFeesPerShare  map[string]*big.Int
+	ProtocolFees    map[string]uint64
+	StakingPoolFees map[string]uint64
+}
+
+type PoolPair struct {
+	Token0ID            string
+	Token1ID            string
+	Token0RealAmount    uint64
+	Token1RealAmount    uint64
+	ShareAmount         uint64
+	Token0VirtualAmount *big.Int
+	Token1VirtualAmount *big.Int
+	Amplifier           uint
+}
+
+// Share is the liquidity of an access NFT in a pool.
+type Share struct {
+	Amount             uint64
+	TradingFees        map[string]uint64
+	LastLPFeesPerShare map[string]*big.Int
+}
+
+type Orderbook struct {
+	Orders []*Order `json:"orders"`
+}
+
+// Order is a limit order in a pool orderbook, its ID is the hash of the
+// transaction placing it.
+type Order struct {
+	Id             string
+	NftID          string
+	Token0Rate     uint64
+	Token1Rate     uint64
+	Token0Balance  uint64
+	Token1Balance  uint64
+	TradeDirection byte
+	Fee            uint64
+}
+
+type StakingPoolState struct {
+	Liquidity       uint64
+	Stakers         map[string]*Staker
+	RewardsPerShare map[string]*big.Int
+}
+
+// Staker is the stake of an access NFT in a staking pool.
+type Staker struct {
+	Liquidity           uint64
+	Rewards             map[string]uint64
+	LastRewardsPerShare map[string]*big.Int
+}
+
+type PoolInfo struct {
+	PoolID              string
+	Token0ID            string
+	Token1ID            string
+	Token0Amount        uint64
+	Token1Amount        uint64
+	Token0VirtualAmount *big.Int
+	Token1VirtualAmount *big.Int
+	Amplifier           uint
+	ShareAmount         uint64
+	FeeRateBPS          uint
+}
+
+// PairInfo groups the pools trading the same two tokens.
+type PairInfo struct {
+	PairID       string
+	Token0ID     string
+	Token1ID     string
+	Token0Amount uint64
+	Token1Amount uint64
+	PoolIDs      []string
+}
+
+type PoolFilter struct {
+	TokenID  string
+	Token0ID string
+	Token1ID string
+}
+
+// Position is the liquidity an access NFT of an account holds in a pool,
+// valued from the cached reserves.
+type Position struct {
+	NftID        string
+	PoolID       string
+	Token0ID     string
+	Token1ID     string
+	Share        uint64
+	TotalShare   uint64
+	Token0Amount uint64
+	Token1Amount uint64
+	// Fees are the LP fees claimable per token
+	Fees map[string]uint64
+}
+
+// Contribution is a two-sided liquidity contribution sent by an account,
+// both sides share PairHash so the beacon can match them.
+type Contribution struct {
+	PairHash     string
+	PoolID       string
+	NftID        string
+	Token0ID     string
+	Token1ID     string
+	Token0Amount uint64
+	Token1Amount uint64
+	Amplifier    uint
+	TxHashes     []string
+	Time         int64
+	// Status is the last contribution status reported by the chain
+	Status *ContributionStatus `json:",omitempty"`
+	Error  string              `json:",omitempty"`
+}
+
+type ContributionStatus struct {
+	Status                  int
+	PoolPairID              string
+	Token0ID                string
+	Token0ContributedAmount uint64
+	Token0ReturnedAmount    uint64
+	Token1ID                string
+	Token1ContributedAmount uint64
+	Token1ReturnedAmount    uint64
+}
+
+type OrderStatus string
+
+const (
+	OrderPending         OrderStatus = "pending"
+	OrderOpen            OrderStatus = "open"
+	OrderPartiallyFilled OrderStatus = "partially_filled"
+	OrderFilled          OrderStatus = "filled"
+	OrderClosed          OrderStatus = "closed"
+	OrderRejected        OrderStatus = "rejected"
+)
+
+// AccountOrder is a limit order placed by an account, its status is updated
+// from the orderbook each time the state is refreshed.
+type AccountOrder struct {
+	OrderID             string
+	PoolID              string
+	NftID               string
+	TokenToSell         string
+	TokenToBuy          string
+	SellAmount          uint64
+	MinAcceptableAmount uint64
+	Time                int64
+	Status              OrderStatus
+	// SoldAmount and BoughtAmount are the filled part of the order
+	SoldAmount   uint64
+	BoughtAmount uint64
+	// Withdrawable is the balance of each token withdrawable from the order
+	Withdrawable map[string]uint64
+	SeenInBook   bool
+}
+
+type StakingPoolInfo struct {
+	TokenID   string
+	Liquidity uint64
+	// Stakers is only counted while an account holds an access NFT, see
+	// pdexv3StateVerbosity
+	Stakers int
+	// RewardShare is the weight of the pool in the PDEX block rewards
+	RewardShare uint
+}
+
+// StakingPosition is the stake of an access NFT of an account in a staking
+// pool with the rewards it accrued.
+type StakingPosition struct {
+	NftID       string
+	TokenID     string
+	Amount      uint64
+	TotalStaked uint64
+	Rewards     map[string]uint64
+}
+
+// StakingPositions are the staking positions of an account, computed and
+// cached each time the state is refreshed.
+type StakingPositions struct {
+	BeaconHeight uint64
+	Positions    []StakingPosition
+}
+
+// Holding is a token balance valued in the reference token of a portfolio.
+// Priced is false when no pool route leads to the reference token.
+type Holding struct {
+	TokenID        string
+	Balance        uint64
+	Value          uint64
+	ValueFormatted string `json:",omitempty"`
+	Priced         bool
+}
+
+type AccountPortfolio struct {
+	Pubkey         string
+	Name           string
+	Value          uint64
+	ValueFormatted string `json:",omitempty"`
+	Holdings       []Holding
+}
+
+// Portfolio values the balances of the accounts at the pDEX mid prices of
+// the cached state.
+type Portfolio struct {
+	ReferenceTokenID string
+	BeaconHeight     uint64
+	Value            uint64
+	ValueFormatted   string `json:",omitempty"`
+	Accounts         []AccountPortfolio
+}
+
+// PortfolioSnapshot is the value of the portfolio at a time, in each
+// reference token, in total and per account pubkey.
+type PortfolioSnapshot struct {
+	Time         int64
+	BeaconHeight uint64
+	Values       map[string]uint64
+	Accounts     map[string]map[string]uint64
+}
+
+type PortfolioPoint struct {
+	Time           int64
+	Value          uint64
+	ValueFormatted string `json:",omitempty"`
 }
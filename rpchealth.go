@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/incognitochain/go-incognito-sdk-v2/incclient"
+	"github.com/incognitochain/go-incognito-sdk-v2/rpchandler"
+	"github.com/incognitochain/go-incognito-sdk-v2/rpchandler/jsonresult"
+	"github.com/rs/zerolog/log"
+
+	"github.com/obsidianwallet/obsidian-wallet-node/common"
+)
+
+const (
+	rpcHealthCheckInterval = 30 * time.Second
+	rpcCheckTimeout        = 10 * time.Second
+	// rpcMaxHeightLag is how many beacon blocks an RPC may be behind the
+	// highest one before it is considered out of sync
+	rpcMaxHeightLag = 5
+	// rpcStallTimeout is how long the beacon height of an RPC may stay the
+	// same before it is considered stalled
+	rpcStallTimeout = 3 * time.Minute
+	// rpcMaxCallErrors failed calls within rpcCallErrorWindow make the RPC
+	// in use unhealthy
+	rpcMaxCallErrors   = 3
+	rpcCallErrorWindow = time.Minute
+	// rpcNodeErrorPrefix starts the errors the SDK returns when the node
+	// answered with an error, the RPC itself works
+	rpcNodeErrorPrefix = "RPC returns an error"
+)
+
+// RPCStatus is the last health check result of an RPC endpoint.
+type RPCStatus struct {
+	URL          string
+	Healthy      bool
+	LatencyMs    int64
+	BeaconHeight uint64
+	ShardCount   int
+	LastCheck    int64
+	// LastAdvance is the last time the beacon height increased
+	LastAdvance int64
+	// CallErrors is how many chain calls failed since LastCallError minus
+	// rpcCallErrorWindow
+	CallErrors    int    `json:",omitempty"`
+	LastCallError int64  `json:",omitempty"`
+	Error         string `json:",omitempty"`
+}
+
+// GetRPCStatus returns the health of the RPCs of the current network, the
+// one in use first.
+func (n *NetworkController) GetRPCStatus() []RPCStatus {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	var result []RPCStatus
+	for _, status := range n.rpcStatus {
+		result = append(result, *status)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if (result[i].URL == n.currentRPC) != (result[j].URL == n.currentRPC) {
+			return result[i].URL == n.currentRPC
+		}
+		return result[i].URL < result[j].URL
+	})
+	return result
+}
+
+// GetCurrentRPC returns the RPC endpoint the chain client is using.
+func (n *NetworkController) GetCurrentRPC() string {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.currentRPC
+}
+
+// monitorRPCs health-checks the RPCs of the current network and fails over
+// to the best one when the RPC in use is unhealthy, until ctx is cancelled.
+// A check also runs as soon as the RPC in use fails too many calls.
+func (n *NetworkController) monitorRPCs(ctx context.Context) {
+	defer n.workers.Done()
+	ticker := time.NewTicker(rpcHealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-n.checkNow:
+		}
+		n.checkAndFailover()
+	}
+}
+
+func (n *NetworkController) checkAndFailover() {
+	n.lock.Lock()
+	network := n.networkList[n.currentNetwork]
+	previous := make(map[string]*RPCStatus, len(n.rpcStatus))
+	for url, status := range n.rpcStatus {
+		copied := *status
+		previous[url] = &copied
+	}
+	n.lock.Unlock()
+
+	statuses := checkRPCs(network.RPCs, previous)
+
+	n.switchLock.Lock()
+	defer n.switchLock.Unlock()
+	n.lock.Lock()
+	// the network may have been switched while checking
+	if n.currentNetwork != network.Name {
+		n.lock.Unlock()
+		return
+	}
+	keepCallErrors(statuses, n.rpcStatus, time.Now())
+	n.rpcStatus = statuses
+	n.lock.Unlock()
+	if err := n.failover(network); err != nil {
+		log.Error().Msgf("rpc failover failed: %v", err)
+	}
+}
+
+// failover moves every network user to the best RPC when the one in use is
+// not healthy anymore. The caller holds n.switchLock, the new client is
+// built without holding n.lock.
+func (n *NetworkController) failover(network common.NetworkID) error {
+	n.lock.Lock()
+	from := n.currentRPC
+	if current, ok := n.rpcStatus[from]; ok && current.Healthy {
+		n.lock.Unlock()
+		return nil
+	}
+	best := selectRPC(n.rpcStatus)
+	n.lock.Unlock()
+	if best == "" || best == from {
+		return fmt.Errorf("no healthy RPC for network %v", network.Name)
+	}
+
+	incClient, err := initChainClient(network, best)
+	if err != nil {
+		n.lock.Lock()
+		if status, ok := n.rpcStatus[best]; ok {
+			status.Healthy = false
+			status.Error = err.Error()
+		}
+		n.lock.Unlock()
+		return err
+	}
+	log.Info().Msgf("switching %v RPC from %v to %v", network.Name, from, best)
+	n.lock.Lock()
+	n.incclient = incClient
+	n.currentRPC = best
+	n.emitEvent(eventRPCFailover, common.RPCFailoverEvent{
+		Network: network.Name,
+		From:    from,
+		To:      best,
+	})
+	n.lock.Unlock()
+	for _, v := range n.networkUsers {
+		if err := v.SetClient(incClient); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReportRPCError counts a failed chain call against the RPC client was
+// connected to. Once the RPC in use failed rpcMaxCallErrors calls within
+// rpcCallErrorWindow it is marked unhealthy and the monitor fails over
+// without waiting for the next check. Errors returned by the node itself
+// and calls made with a replaced client are ignored.
+func (n *NetworkController) ReportRPCError(client *incclient.IncClient, err error) {
+	if err == nil || !isEndpointError(err) {
+		return
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if client == nil || client != n.incclient {
+		return
+	}
+	status, ok := n.rpcStatus[n.currentRPC]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if now.Sub(time.Unix(status.LastCallError, 0)) > rpcCallErrorWindow {
+		status.CallErrors = 0
+	}
+	status.CallErrors++
+	status.LastCallError = now.Unix()
+	if status.CallErrors < rpcMaxCallErrors {
+		return
+	}
+	status.Healthy = false
+	status.Error = fmt.Sprintf("%v failed calls, last: %v", status.CallErrors, err)
+	select {
+	case n.checkNow <- struct{}{}:
+	default:
+	}
+}
+
+// isEndpointError tells whether err comes from reaching the RPC rather than
+// from the node rejecting the request.
+func isEndpointError(err error) bool {
+	return !strings.HasPrefix(err.Error(), rpcNodeErrorPrefix)
+}
+
+// keepCallErrors carries the recent call errors of previous over to the new
+// statuses, an RPC answering the health check but failing the calls stays
+// unhealthy until the errors are older than rpcCallErrorWindow.
+func keepCallErrors(statuses, previous map[string]*RPCStatus, now time.Time) {
+	for url, status := range statuses {
+		last, ok := previous[url]
+		if !ok || now.Sub(time.Unix(last.LastCallError, 0)) > rpcCallErrorWindow {
+			continue
+		}
+		status.CallErrors = last.CallErrors
+		status.LastCallError = last.LastCallError
+		if status.CallErrors >= rpcMaxCallErrors && status.Healthy {
+			status.Healthy = false
+			status.Error = last.Error
+		}
+	}
+}
+
+// checkRPCs checks every RPC in parallel and marks unhealthy the ones
+// failing, lagging behind the highest beacon height or stalled.
+func checkRPCs(rpcs []string, previous map[string]*RPCStatus) map[string]*RPCStatus {
+	results := make(chan *RPCStatus, len(rpcs))
+	for _, url := range rpcs {
+		go func(url string) {
+			status := checkRPC(url)
+			if last, ok := previous[url]; ok && status.Error == "" && status.BeaconHeight <= last.BeaconHeight {
+				status.LastAdvance = last.LastAdvance
+			}
+			results <- status
+		}(url)
+	}
+
+	statuses := make(map[string]*RPCStatus)
+	var maxHeight uint64
+	for range rpcs {
+		status := <-results
+		statuses[status.URL] = status
+		if status.BeaconHeight > maxHeight {
+			maxHeight = status.BeaconHeight
+		}
+	}
+	now := time.Now()
+	for _, status := range statuses {
+		switch {
+		case status.Error != "":
+		case status.BeaconHeight+rpcMaxHeightLag < maxHeight:
+			status.Error = fmt.Sprintf("beacon height %v is behind %v", status.BeaconHeight, maxHeight)
+		case now.Sub(time.Unix(status.LastAdvance, 0)) > rpcStallTimeout:
+			status.Error = fmt.Sprintf("beacon height stuck at %v", status.BeaconHeight)
+		default:
+			status.Healthy = true
+		}
+	}
+	return statuses
+}
+
+// checkRPC measures the latency and beacon height of an RPC with a
+// getbestblock call.
+func checkRPC(url string) *RPCStatus {
+	now := time.Now()
+	status := &RPCStatus{URL: url, LastCheck: now.Unix(), LastAdvance: now.Unix()}
+	requestBytes, err := json.Marshal(rpchandler.CreateJsonRequest("1.0", "getbestblock", []interface{}{}, 1))
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	client := http.Client{Timeout: rpcCheckTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewBuffer(requestBytes))
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.LatencyMs = time.Since(now).Milliseconds()
+
+	var bestBlocks jsonresult.BestBlockResult
+	if err := rpchandler.ParseResponse(body, &bestBlocks); err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	beacon, ok := bestBlocks.BestBlocks[-1]
+	if !ok {
+		status.Error = "no beacon best block"
+		return status
+	}
+	status.BeaconHeight = beacon.Height
+	status.ShardCount = len(bestBlocks.BestBlocks) - 1
+	return status
+}
+
+// validateNetwork checks that at least one RPC of network is reachable and
+// reports a chain with a beacon and shards that produced blocks.
+func validateNetwork(network common.NetworkID) error {
+	if len(network.RPCs) == 0 {
+		return fmt.Errorf("network %s has no RPC endpoint", network.Name)
+	}
+	var errs []string
+	for url, status := range checkRPCs(network.RPCs, nil) {
+		switch {
+		case status.Error != "":
+			errs = append(errs, fmt.Sprintf("%v: %v", url, status.Error))
+		case status.BeaconHeight == 0:
+			errs = append(errs, fmt.Sprintf("%v: beacon has no block", url))
+		case status.ShardCount <= 0:
+			errs = append(errs, fmt.Sprintf("%v: no shard best block", url))
+		default:
+			return nil
+		}
+	}
+	sort.Strings(errs)
+	return fmt.Errorf("no usable RPC for network %v: %v", network.Name, strings.Join(errs, "; "))
+}
+
+// selectRPC returns the healthy RPC with the lowest latency, empty if none
+// is healthy.
+func selectRPC(statuses map[string]*RPCStatus) string {
+	var best *RPCStatus
+	for _, status := range statuses {
+		if !status.Healthy {
+			continue
+		}
+		if best == nil || status.LatencyMs < best.LatencyMs ||
+			(status.LatencyMs == best.LatencyMs && status.URL < best.URL) {
+			best = status
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.URL
+}
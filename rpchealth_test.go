@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/incognitochain/go-incognito-sdk-v2/incclient"
+)
+
+func TestSelectRPC(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []RPCStatus
+		want     string
+	}{
+		{name: "none"},
+		{
+			name:     "no healthy RPC",
+			statuses: []RPCStatus{{URL: "a", LatencyMs: 10}},
+		},
+		{
+			name: "lowest latency",
+			statuses: []RPCStatus{
+				{URL: "a", Healthy: true, LatencyMs: 30},
+				{URL: "b", Healthy: true, LatencyMs: 10},
+				{URL: "c", LatencyMs: 1},
+			},
+			want: "b",
+		},
+		{
+			name: "same latency",
+			statuses: []RPCStatus{
+				{URL: "b", Healthy: true, LatencyMs: 10},
+				{URL: "a", Healthy: true, LatencyMs: 10},
+			},
+			want: "a",
+		},
+	}
+	for _, tt := range tests {
+		statuses := make(map[string]*RPCStatus)
+		for idx := range tt.statuses {
+			statuses[tt.statuses[idx].URL] = &tt.statuses[idx]
+		}
+		if got := selectRPC(statuses); got != tt.want {
+			t.Errorf("%v: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func newTestRPC(t *testing.T, response string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, response)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func bestBlockResponse(beaconHeight uint64) string {
+	return fmt.Sprintf(`{"Result":{"BestBlocks":{"-1":{"Height":%v},"0":{"Height":7},"1":{"Height":8}}},"Error":null,"Id":1}`, beaconHeight)
+}
+
+func TestCheckRPCs(t *testing.T) {
+	healthy := newTestRPC(t, bestBlockResponse(100)).URL
+	lagging := newTestRPC(t, bestBlockResponse(90)).URL
+	stalled := newTestRPC(t, bestBlockResponse(100)).URL
+	nodeError := newTestRPC(t, `{"Result":null,"Error":{"Code":-1,"Message":"not ready"},"Id":1}`).URL
+	empty := newTestRPC(t, "").URL
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	down := closed.URL
+
+	previous := map[string]*RPCStatus{
+		stalled: {URL: stalled, BeaconHeight: 100, LastAdvance: time.Now().Add(-rpcStallTimeout - time.Minute).Unix()},
+	}
+	statuses := checkRPCs([]string{healthy, lagging, stalled, nodeError, empty, down}, previous)
+	tests := []struct {
+		url         string
+		wantHealthy bool
+		wantHeight  uint64
+	}{
+		{healthy, true, 100},
+		{lagging, false, 90},
+		{stalled, false, 100},
+		{nodeError, false, 0},
+		{empty, false, 0},
+		{down, false, 0},
+	}
+	for _, tt := range tests {
+		status, ok := statuses[tt.url]
+		if !ok {
+			t.Errorf("no status for %v", tt.url)
+			continue
+		}
+		if status.Healthy != tt.wantHealthy || status.BeaconHeight != tt.wantHeight {
+			t.Errorf("%v: got healthy %v height %v, want %v %v", tt.url, status.Healthy, status.BeaconHeight, tt.wantHealthy, tt.wantHeight)
+		}
+		if status.Healthy != (status.Error == "") {
+			t.Errorf("%v: healthy %v with error %q", tt.url, status.Healthy, status.Error)
+		}
+	}
+	if statuses[healthy].ShardCount != 2 {
+		t.Errorf("got %v shards, want 2", statuses[healthy].ShardCount)
+	}
+}
+
+func TestReportRPCError(t *testing.T) {
+	client := &incclient.IncClient{}
+	n := &NetworkController{
+		incclient:  client,
+		currentRPC: "a",
+		rpcStatus:  map[string]*RPCStatus{"a": {URL: "a", Healthy: true}},
+		checkNow:   make(chan struct{}, 1),
+	}
+	endpointErr := errors.New("connection refused")
+
+	n.ReportRPCError(client, errors.New("RPC returns an error: invalid params"))
+	n.ReportRPCError(&incclient.IncClient{}, endpointErr)
+	if status := n.rpcStatus["a"]; status.CallErrors != 0 {
+		t.Fatalf("node errors and replaced clients counted: %v call errors", status.CallErrors)
+	}
+
+	for idx := 1; idx <= rpcMaxCallErrors; idx++ {
+		n.ReportRPCError(client, endpointErr)
+		status := n.rpcStatus["a"]
+		if status.CallErrors != idx {
+			t.Fatalf("got %v call errors, want %v", status.CallErrors, idx)
+		}
+		if wantHealthy := idx < rpcMaxCallErrors; status.Healthy != wantHealthy {
+			t.Fatalf("after %v call errors healthy is %v", idx, status.Healthy)
+		}
+	}
+	select {
+	case <-n.checkNow:
+	default:
+		t.Fatal("monitor not woken up")
+	}
+
+	// errors older than the window start the count again
+	n.rpcStatus["a"] = &RPCStatus{URL: "a", Healthy: true, CallErrors: rpcMaxCallErrors - 1,
+		LastCallError: time.Now().Add(-rpcCallErrorWindow - time.Second).Unix()}
+	n.ReportRPCError(client, endpointErr)
+	if status := n.rpcStatus["a"]; status.CallErrors != 1 || !status.Healthy {
+		t.Errorf("got %v call errors healthy %v, want 1 true", status.CallErrors, status.Healthy)
+	}
+}
+
+func TestKeepCallErrors(t *testing.T) {
+	now := time.Now()
+	previous := map[string]*RPCStatus{
+		"failing": {URL: "failing", CallErrors: rpcMaxCallErrors, LastCallError: now.Unix(), Error: "calls failed"},
+		"recent":  {URL: "recent", CallErrors: 1, LastCallError: now.Unix()},
+		"old":     {URL: "old", CallErrors: rpcMaxCallErrors, LastCallError: now.Add(-rpcCallErrorWindow - time.Second).Unix()},
+	}
+	statuses := map[string]*RPCStatus{
+		"failing": {URL: "failing", Healthy: true},
+		"recent":  {URL: "recent", Healthy: true},
+		"old":     {URL: "old", Healthy: true},
+		"new":     {URL: "new", Healthy: true},
+	}
+	keepCallErrors(statuses, previous, now)
+	tests := []struct {
+		url         string
+		wantErrors  int
+		wantHealthy bool
+	}{
+		{"failing", rpcMaxCallErrors, false},
+		{"recent", 1, true},
+		{"old", 0, true},
+		{"new", 0, true},
+	}
+	for _, tt := range tests {
+		status := statuses[tt.url]
+		if status.CallErrors != tt.wantErrors || status.Healthy != tt.wantHealthy {
+			t.Errorf("%v: got %v call errors healthy %v, want %v %v", tt.url, status.CallErrors, status.Healthy, tt.wantErrors, tt.wantHealthy)
+		}
+	}
+	if statuses["failing"].Error != "calls failed" {
+		t.Errorf("failing RPC error is %q", statuses["failing"].Error)
+	}
+}
@@ -0,0 +1,84 @@
+package tokenregistry
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// FormatAmount writes amount of raw units as a decimal number of tokens,
+// without trailing zeros.
+func FormatAmount(amount uint64, decimals int) string {
+	digits := new(big.Int).SetUint64(amount).String()
+	if decimals <= 0 {
+		return digits
+	}
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	intPart := digits[:len(digits)-decimals]
+	fracPart := strings.TrimRight(digits[len(digits)-decimals:], "0")
+	if fracPart == "" {
+		return intPart
+	}
+	return intPart + "." + fracPart
+}
+
+// ParseAmount reads a decimal number of tokens into raw units. It is strict:
+// signs, exponents, separators, more fractional digits than decimals and
+// amounts overflowing uint64 are rejected rather than rounded.
+func ParseAmount(value string, decimals int) (uint64, error) {
+	if decimals < 0 {
+		decimals = 0
+	}
+	intPart, fracPart := value, ""
+	if idx := strings.IndexByte(value, '.'); idx >= 0 {
+		intPart, fracPart = value[:idx], value[idx+1:]
+		if fracPart == "" {
+			return 0, fmt.Errorf("invalid amount %q", value)
+		}
+	}
+	if intPart == "" || !isDigits(intPart) || !isDigits(fracPart) {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	// trailing zeros lose no precision
+	fracPart = strings.TrimRight(fracPart, "0")
+	if len(fracPart) > decimals {
+		return 0, fmt.Errorf("amount %q has more than %v decimals", value, decimals)
+	}
+	fracPart += strings.Repeat("0", decimals-len(fracPart))
+
+	result, ok := new(big.Int).SetString(intPart+fracPart, 10)
+	if !ok || !result.IsUint64() {
+		return 0, fmt.Errorf("amount %q is out of range", value)
+	}
+	return result.Uint64(), nil
+}
+
+// FormatAmount formats amount of tokenID with the token decimals, it returns
+// false when the token is unknown.
+func (registry *TokenRegistry) FormatAmount(tokenID string, amount uint64) (string, bool) {
+	token, err := registry.GetToken(tokenID)
+	if err != nil {
+		return "", false
+	}
+	return FormatAmount(amount, token.Decimals), true
+}
+
+// ParseAmount reads a decimal amount of tokenID with the token decimals.
+func (registry *TokenRegistry) ParseAmount(tokenID string, value string) (uint64, error) {
+	token, err := registry.GetToken(tokenID)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse amount of token %v: %w", tokenID, err)
+	}
+	return ParseAmount(value, token.Decimals)
+}
+
+func isDigits(value string) bool {
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
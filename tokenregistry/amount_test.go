@@ -0,0 +1,88 @@
+package tokenregistry
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		amount   uint64
+		decimals int
+		want     string
+	}{
+		{0, 9, "0"},
+		{0, 0, "0"},
+		{1, 9, "0.000000001"},
+		{1000000000, 9, "1"},
+		{1250000000, 9, "1.25"},
+		{123456789012, 9, "123.456789012"},
+		{100, 2, "1"},
+		{105, 2, "1.05"},
+		{42, 0, "42"},
+		{42, -1, "42"},
+		{math.MaxUint64, 9, "18446744073.709551615"},
+	}
+	for _, tt := range tests {
+		if got := FormatAmount(tt.amount, tt.decimals); got != tt.want {
+			t.Errorf("FormatAmount(%v, %v) = %q, want %q", tt.amount, tt.decimals, got, tt.want)
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		value    string
+		decimals int
+		want     uint64
+		wantErr  bool
+	}{
+		{"0", 9, 0, false},
+		{"1", 9, 1000000000, false},
+		{"1.25", 9, 1250000000, false},
+		{"0.000000001", 9, 1, false},
+		{"1.2500000000000", 9, 1250000000, false},
+		{"007", 2, 700, false},
+		{"42", 0, 42, false},
+		{"42", -1, 42, false},
+		{"18446744073.709551615", 9, math.MaxUint64, false},
+		{"18446744073.709551616", 9, 0, true},
+		{"0.0000000001", 9, 0, true},
+		{"1.5", 0, 0, true},
+		{"", 9, 0, true},
+		{".5", 9, 0, true},
+		{"1.", 9, 0, true},
+		{"-1", 9, 0, true},
+		{"+1", 9, 0, true},
+		{"1e9", 9, 0, true},
+		{"1,000", 9, 0, true},
+		{" 1", 9, 0, true},
+		{"1.2.3", 9, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.value, tt.decimals)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAmount(%q, %v) error = %v, wantErr %v", tt.value, tt.decimals, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseAmount(%q, %v) = %v, want %v", tt.value, tt.decimals, got, tt.want)
+		}
+	}
+}
+
+func TestParseFormatRoundTrip(t *testing.T) {
+	for _, amount := range []uint64{0, 1, 10, 999999999, 1000000001, math.MaxUint64} {
+		for _, decimals := range []int{0, 2, 6, 9} {
+			formatted := FormatAmount(amount, decimals)
+			parsed, err := ParseAmount(formatted, decimals)
+			if err != nil {
+				t.Errorf("ParseAmount(%q, %v) failed: %v", formatted, decimals, err)
+				continue
+			}
+			if parsed != amount {
+				t.Errorf("round trip of %v with %v decimals gave %v", amount, decimals, parsed)
+			}
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package tokenregistry
+
+import "time"
+
+const (
+	dbTokenListPrefix = "token-list-"
+)
+
+const (
+	refreshInterval = time.Hour
+	// retryInterval is used instead of refreshInterval after a failed fetch
+	retryInterval = time.Minute
+	fetchTimeout  = 30 * time.Second
+
+	tokenListPath = "/coins/tokenlist"
+	// DefaultOverrideFile is read when the config sets no override file
+	DefaultOverrideFile = "tokens.json"
+)
+
+const (
+	prvTokenID  = "0000000000000000000000000000000000000000000000000000000000000004"
+	pdexTokenID = "0000000000000000000000000000000000000000000000000000000000000006"
+	// nativeDecimals are the decimals of PRV and PDEX
+	nativeDecimals = 9
+)
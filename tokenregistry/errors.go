@@ -0,0 +1,8 @@
+package tokenregistry
+
+import "errors"
+
+var (
+	ErrTokenNotFound = errors.New("token not found")
+	ErrNoServiceURL  = errors.New("network has no service URL")
+)
@@ -0,0 +1,63 @@
+package tokenregistry
+
+import (
+	"context"
+
+	"github.com/incognitochain/go-incognito-sdk-v2/incclient"
+	"github.com/obsidianwallet/obsidian-wallet-node/common"
+)
+
+// Stop cancels the refresh worker and returns once it exited.
+func (registry *TokenRegistry) Stop() error {
+	registry.lock.Lock()
+	cancel := registry.cancel
+	registry.cancel = nil
+	registry.lock.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	registry.workers.Wait()
+	return nil
+}
+
+// Start runs the refresh worker until Stop is called or ctx is cancelled.
+func (registry *TokenRegistry) Start(ctx context.Context) error {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	if registry.cancel != nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	registry.cancel = cancel
+	registry.workers.Add(1)
+	go registry.refreshTokens(ctx)
+	return nil
+}
+
+// SetClient does nothing, the registry only talks to the service URLs.
+func (registry *TokenRegistry) SetClient(incclient *incclient.IncClient) error {
+	return nil
+}
+
+func (registry *TokenRegistry) SwitchNetwork(networkParam common.NetworkID, incclient *incclient.IncClient) error {
+	// serve the cached list until it expires
+	var fetched []Token
+	var updatedAt int64
+	cache, err := registry.loadTokenList(networkParam.Name)
+	if err != nil {
+		return err
+	}
+	if cache != nil {
+		fetched = cache.Tokens
+		updatedAt = cache.UpdatedAt
+	}
+	tokens := registry.buildTokens(networkParam.Name, fetched)
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	registry.currentNetwork = networkParam
+	registry.serviceURLs = networkParam.ServiceURLs
+	registry.tokens = tokens
+	registry.updatedAt = updatedAt
+	return nil
+}
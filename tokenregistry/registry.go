@@ -0,0 +1,342 @@
+package tokenregistry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/rs/zerolog/log"
+
+	"github.com/obsidianwallet/obsidian-wallet-node/database"
+)
+
+func InitTokenRegistry(db *database.Database, overrideFile string) (*TokenRegistry, error) {
+	if overrideFile == "" {
+		overrideFile = DefaultOverrideFile
+	}
+	registry := &TokenRegistry{
+		db:           db,
+		overrideFile: overrideFile,
+		tokens:       defaultTokens(),
+	}
+	return registry, nil
+}
+
+// refreshTokens keeps the token list of the current network up to date until
+// ctx is cancelled. The first fetch waits for the cached list to expire.
+func (registry *TokenRegistry) refreshTokens(ctx context.Context) {
+	defer registry.workers.Done()
+	for {
+		registry.lock.RLock()
+		nextUpdate := time.Unix(registry.updatedAt, 0).Add(refreshInterval)
+		registry.lock.RUnlock()
+		wait := time.Until(nextUpdate)
+		if wait <= 0 {
+			wait = refreshInterval
+			if err := registry.update(); err != nil {
+				log.Error().Msgf("update token list failed: %v", err)
+				wait = retryInterval
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Refresh fetches the token list now instead of waiting for the refresh
+// interval.
+func (registry *TokenRegistry) Refresh() error {
+	return registry.update()
+}
+
+func (registry *TokenRegistry) update() error {
+	registry.lock.RLock()
+	serviceURLs := registry.serviceURLs
+	network := registry.currentNetwork.Name
+	registry.lock.RUnlock()
+	if len(serviceURLs) == 0 {
+		return ErrNoServiceURL
+	}
+
+	fetched, err := fetchTokenListFrom(serviceURLs)
+	if err != nil {
+		return err
+	}
+	cache := cachedTokenList{UpdatedAt: time.Now().Unix(), Tokens: fetched}
+	if err := registry.saveTokenList(network, &cache); err != nil {
+		return err
+	}
+	tokens := registry.buildTokens(network, cache.Tokens)
+
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	// the network may have been switched while fetching
+	if registry.currentNetwork.Name == network {
+		registry.tokens = tokens
+		registry.updatedAt = cache.UpdatedAt
+	}
+	return nil
+}
+
+// GetToken returns the metadata of tokenID.
+func (registry *TokenRegistry) GetToken(tokenID string) (*Token, error) {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	token, ok := registry.tokens[tokenID]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+	result := *token
+	return &result, nil
+}
+
+// FindBySymbol returns the token with symbol ignoring case. When several
+// tokens share it, unified tokens come first, then verified ones.
+func (registry *TokenRegistry) FindBySymbol(symbol string) (*Token, error) {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	var best *Token
+	for _, token := range registry.tokens {
+		if !strings.EqualFold(token.Symbol, symbol) {
+			continue
+		}
+		if best == nil || tokenPreferred(token, best) {
+			best = token
+		}
+	}
+	if best == nil {
+		return nil, ErrTokenNotFound
+	}
+	result := *best
+	return &result, nil
+}
+
+func tokenPreferred(token *Token, other *Token) bool {
+	if token.Unified != other.Unified {
+		return token.Unified
+	}
+	if token.Verified != other.Verified {
+		return token.Verified
+	}
+	return token.TokenID < other.TokenID
+}
+
+// ListTokens returns the page of tokens matching filter, verified tokens
+// first then by symbol.
+func (registry *TokenRegistry) ListTokens(filter TokenFilter) TokenList {
+	registry.lock.RLock()
+	matched := []Token{}
+	for _, token := range registry.tokens {
+		if filter.match(token) {
+			matched = append(matched, *token)
+		}
+	}
+	updatedAt := registry.updatedAt
+	registry.lock.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].Verified != matched[j].Verified {
+			return matched[i].Verified
+		}
+		symbolI, symbolJ := strings.ToLower(matched[i].Symbol), strings.ToLower(matched[j].Symbol)
+		if symbolI != symbolJ {
+			return symbolI < symbolJ
+		}
+		return matched[i].TokenID < matched[j].TokenID
+	})
+	result := TokenList{Total: len(matched), UpdatedAt: updatedAt, Tokens: []Token{}}
+	if filter.Offset < len(matched) {
+		end := len(matched)
+		if filter.Limit > 0 && filter.Offset+filter.Limit < end {
+			end = filter.Offset + filter.Limit
+		}
+		result.Tokens = matched[filter.Offset:end]
+	}
+	return result
+}
+
+func (filter TokenFilter) match(token *Token) bool {
+	if filter.VerifiedOnly && !token.Verified {
+		return false
+	}
+	if filter.Network != "" && !strings.EqualFold(filter.Network, token.Network) {
+		return false
+	}
+	if filter.Query == "" {
+		return true
+	}
+	query := strings.ToLower(filter.Query)
+	return token.TokenID == filter.Query ||
+		strings.Contains(strings.ToLower(token.Symbol), query) ||
+		strings.Contains(strings.ToLower(token.Name), query)
+}
+
+// fetchTokenListFrom tries the service URLs in order until one returns the
+// token list.
+func fetchTokenListFrom(serviceURLs []string) ([]Token, error) {
+	var errs []string
+	for _, serviceURL := range serviceURLs {
+		tokens, err := fetchTokenList(serviceURL)
+		if err == nil {
+			return tokens, nil
+		}
+		log.Error().Msgf("fetch token list from %v failed: %v", serviceURL, err)
+		errs = append(errs, fmt.Sprintf("%v: %v", serviceURL, err))
+	}
+	return nil, fmt.Errorf("no service URL returned the token list: %v", strings.Join(errs, "; "))
+}
+
+func fetchTokenList(serviceURL string) ([]Token, error) {
+	client := http.Client{Timeout: fetchTimeout}
+	resp, err := client.Get(strings.TrimRight(serviceURL, "/") + tokenListPath)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token list request failed with status %v", resp.Status)
+	}
+	var response struct {
+		Result []serviceToken
+		Error  interface{}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	if response.Error != nil {
+		return nil, fmt.Errorf("token list request failed: %v", response.Error)
+	}
+
+	var tokens []Token
+	for _, info := range response.Result {
+		token := info.toToken()
+		token.Unified = len(info.ListUnifiedToken) > 0
+		tokens = append(tokens, token)
+		for _, child := range info.ListUnifiedToken {
+			childToken := child.toToken()
+			childToken.ParentTokenID = info.TokenID
+			tokens = append(tokens, childToken)
+		}
+	}
+	return tokens, nil
+}
+
+func (info serviceToken) toToken() Token {
+	symbol := info.PSymbol
+	if symbol == "" {
+		symbol = info.Symbol
+	}
+	return Token{
+		TokenID:  info.TokenID,
+		Symbol:   symbol,
+		Name:     info.Name,
+		Decimals: info.PDecimals,
+		Verified: info.Verified,
+		Network:  info.Network,
+	}
+}
+
+// buildTokens merges the native tokens, the fetched tokens and the override
+// file entries of network, in increasing priority. A broken override file is
+// logged and skipped so it cannot take the registry down.
+func (registry *TokenRegistry) buildTokens(network string, fetched []Token) map[string]*Token {
+	tokens := defaultTokens()
+	for idx := range fetched {
+		token := fetched[idx]
+		if _, ok := tokens[token.TokenID]; ok && token.ParentTokenID != "" {
+			// keep the top-level entry over the unified child one
+			continue
+		}
+		tokens[token.TokenID] = &token
+	}
+	overrides, err := registry.loadOverrides(network)
+	if err != nil {
+		log.Error().Msgf("load token overrides failed: %v", err)
+	}
+	for idx := range overrides {
+		token := overrides[idx]
+		token.Custom = true
+		tokens[token.TokenID] = &token
+	}
+	return tokens
+}
+
+// loadOverrides reads the custom tokens of network from the override file,
+// a JSON object of token lists keyed by network name.
+func (registry *TokenRegistry) loadOverrides(network string) ([]Token, error) {
+	data, err := ioutil.ReadFile(registry.overrideFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var overrides map[string][]Token
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("invalid token override file %v: %v", registry.overrideFile, err)
+	}
+	for _, token := range overrides[network] {
+		if token.TokenID == "" {
+			return nil, fmt.Errorf("token override without TokenID in %v", registry.overrideFile)
+		}
+	}
+	return overrides[network], nil
+}
+
+func (registry *TokenRegistry) saveTokenList(network string, list *cachedTokenList) error {
+	listBytes, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	return registry.db.DB.Set([]byte(dbTokenListPrefix), []database.Object{{
+		Key:   []byte(network),
+		Value: listBytes,
+	}})
+}
+
+// loadTokenList returns the token list cached for network, nil if there is
+// none.
+func (registry *TokenRegistry) loadTokenList(network string) (*cachedTokenList, error) {
+	value, err := registry.db.DB.Get([]byte(dbTokenListPrefix), []byte(network))
+	if err != nil {
+		if err == badger.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var list cachedTokenList
+	if err := json.Unmarshal(value, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+func defaultTokens() map[string]*Token {
+	return map[string]*Token{
+		prvTokenID: {
+			TokenID:  prvTokenID,
+			Symbol:   "PRV",
+			Name:     "Privacy",
+			Decimals: nativeDecimals,
+			Verified: true,
+		},
+		pdexTokenID: {
+			TokenID:  pdexTokenID,
+			Symbol:   "PDEX",
+			Name:     "pDEX",
+			Decimals: nativeDecimals,
+			Verified: true,
+		},
+	}
+}
@@ -0,0 +1,76 @@
+package tokenregistry
+
+import (
+	"context"
+	"sync"
+
+	"github.com/obsidianwallet/obsidian-wallet-node/common"
+	"github.com/obsidianwallet/obsidian-wallet-node/database"
+)
+
+type TokenRegistry struct {
+	db           *database.Database
+	overrideFile string
+
+	lock           sync.RWMutex
+	currentNetwork common.NetworkID
+	serviceURLs    []string
+	tokens         map[string]*Token
+	updatedAt      int64
+
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+}
+
+// Token is the metadata of a token as served by the registry.
+type Token struct {
+	TokenID  string
+	Symbol   string
+	Name     string
+	Decimals int
+	Verified bool
+	// Network is the network the token is bridged from, empty for tokens
+	// native to Incognito
+	Network string `json:",omitempty"`
+	// Unified tokens group the pTokens of the same asset bridged from
+	// several networks, ParentTokenID is the unified token of a pToken
+	Unified       bool
+	ParentTokenID string `json:",omitempty"`
+	// Custom tokens come from the local override file
+	Custom bool `json:",omitempty"`
+}
+
+type TokenFilter struct {
+	// Query matches the token ID, or part of the symbol or name ignoring
+	// case
+	Query        string
+	VerifiedOnly bool
+	Network      string
+	Offset       int
+	Limit        int
+}
+
+type TokenList struct {
+	Total     int
+	UpdatedAt int64
+	Tokens    []Token
+}
+
+// cachedTokenList is the token list of a network as stored in the database.
+type cachedTokenList struct {
+	UpdatedAt int64
+	Tokens    []Token
+}
+
+// serviceToken is a token of the coin service token list.
+type serviceToken struct {
+	TokenID          string
+	Name             string
+	Symbol           string
+	PSymbol          string
+	PDecimals        int
+	Verified         bool
+	Network          string
+	IsBridge         bool
+	ListUnifiedToken []serviceToken
+}
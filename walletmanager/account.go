@@ -1,116 +1,176 @@
 package walletmanager
 
 import (
+	"context"
+	"encoding/hex"
 	"encoding/json"
-	"log"
 	"sync"
 	"time"
 
+	"github.com/dgraph-io/badger/v3"
 	"github.com/incognitochain/go-incognito-sdk-v2/coin"
 	"github.com/incognitochain/go-incognito-sdk-v2/common"
 	"github.com/incognitochain/go-incognito-sdk-v2/common/base58"
 	"github.com/incognitochain/go-incognito-sdk-v2/incclient"
+	"github.com/incognitochain/go-incognito-sdk-v2/wallet"
 	wcommon "github.com/obsidianwallet/obsidian-wallet-node/common"
 	"github.com/obsidianwallet/obsidian-wallet-node/database"
+	"github.com/rs/zerolog/log"
 )
 
-func (rtacc *RuntimeAccount) scanCoins() {
-	for {
-		select {
-		case <-rtacc.stopCh:
-			rtacc.isStopped = true
-			return
-		default:
-			rtacc.isStopped = false
-			shardID := getAddressShardID(rtacc.wlk.KeySet.PaymentAddress.Pk[:], 8)
-			var wg sync.WaitGroup
-			for tokenID, currentIndex := range rtacc.coinstate.scannedCoinIndex {
-				wg.Add(1)
-				go func(tkID string, cIdx uint64) {
-					defer func() {
-						wg.Done()
-
-					}()
-					nextIndex := cIdx + 100
-					coinPubkeyList, err := rtacc.wlm.coinsyncmng.GetCoinPubkeyByIndices(shardID, tkID, cIdx, nextIndex)
-					if err != nil {
-						log.Fatalln(err)
-					}
-					coinList, err := rtacc.wlm.coinsyncmng.GetCoinByPubkey(coinPubkeyList)
-					if err != nil {
-						log.Fatalln(err)
-					}
-					coinOwnerData, err := rtacc.checkCoinOwner(coinList)
-					if err != nil {
-						log.Fatalln(err)
-					}
-					_ = coinOwnerData
-				}(tokenID, currentIndex)
-			}
+// scanCoinsOnce checks the ownership of the next batch of synced coins of
+// every coin stream. A failed batch keeps its scan cursor and is retried.
+func (rtacc *RuntimeAccount) scanCoinsOnce() error {
+	shardID := rtacc.shardID
+	csm := rtacc.wlm.getCoinSyncManager()
+	rtacc.lock.RLock()
+	scanState := make(map[string]uint64)
+	for tokenID, currentIndex := range rtacc.coinstate.ScannedCoinIndex {
+		scanState[tokenID] = currentIndex
+	}
+	rtacc.lock.RUnlock()
 
-			time.Sleep(scanCoinsInterval)
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(scanState))
+	for tokenID, currentIndex := range scanState {
+		syncedIndex := csm.getSyncedIndex(shardID, tokenID)
+		if currentIndex >= syncedIndex {
+			continue
 		}
+		wg.Add(1)
+		go func(tkID string, cIdx uint64, syncedIdx uint64) {
+			defer wg.Done()
+			nextIndex := cIdx + scanCoinsBatchSize
+			if nextIndex > syncedIdx {
+				nextIndex = syncedIdx
+			}
+			coinPubkeyList, err := csm.GetCoinPubkeyByIndices(shardID, tkID, cIdx, nextIndex)
+			if err != nil {
+				errCh <- err
+				return
+			}
+			coinList, err := csm.GetCoinByPubkey(coinPubkeyList)
+			if err != nil {
+				errCh <- err
+				return
+			}
+			coinOwnerData, err := rtacc.checkCoinOwner(shardID, cIdx, coinList)
+			if err != nil {
+				errCh <- err
+				return
+			}
+			if err := rtacc.saveOwnedCoins(tkID, nextIndex, coinOwnerData); err != nil {
+				errCh <- err
+			}
+		}(tokenID, currentIndex, syncedIndex)
 	}
+	wg.Wait()
+	close(errCh)
+	return <-errCh
 }
 
-func (rtacc *RuntimeAccount) checkBalance() {
-	for {
-		rtacc.lock.Lock()
-		shardID := getAddressShardID(rtacc.wlk.KeySet.PaymentAddress.Pk[:], 8)
+// checkBalanceOnce drops the coins the chain reports spent and the pending
+// key images that timed out.
+func (rtacc *RuntimeAccount) checkBalanceOnce() error {
+	if err := rtacc.resolveKeyImages(); err != nil {
+		return err
+	}
+	shardID := rtacc.shardID
+	// the key images are copied so the account is not locked during the RPCs
+	rtacc.lock.RLock()
+	prvList := append([]string{}, rtacc.coinstate.PRVUTXOList...)
+	tokenLists := make(map[string][]string)
+	for tokenID, keyimageList := range rtacc.coinstate.TokenUTXOList {
+		tokenLists[tokenID] = append([]string{}, keyimageList...)
+	}
+	rtacc.lock.RUnlock()
 
-		newPRVList, err := checkKeyImage(byte(shardID), common.PRVCoinID.String(), rtacc.coinstate.PRVUTXOList, rtacc.wlm.incclient)
+	client := rtacc.wlm.getClient()
+	spentList, err := checkKeyImage(byte(shardID), common.PRVCoinID.String(), prvList, client)
+	if err != nil {
+		rtacc.wlm.reportRPCError(client, err)
+		return err
+	}
+	for _, keyimageList := range tokenLists {
+		spent, err := checkKeyImage(byte(shardID), common.ConfidentialAssetID.String(), keyimageList, client)
 		if err != nil {
-			log.Fatalln(err)
-		}
-		rtacc.coinstate.PRVUTXOList = newPRVList
-
-		for tokenID, keyimageList := range rtacc.coinstate.TokenUTXOList {
-			newList, err := checkKeyImage(byte(shardID), common.ConfidentialAssetID.String(), keyimageList, rtacc.wlm.incclient)
-			if err != nil {
-				log.Fatalln(err)
-			}
-			rtacc.coinstate.TokenUTXOList[tokenID] = newList
+			rtacc.wlm.reportRPCError(client, err)
+			return err
 		}
-
-		rtacc.lock.Unlock()
-		if err = rtacc.saveAccountInfo(); err != nil {
-			log.Fatalln(err)
-		}
-		time.Sleep(scanCoinsInterval)
+		spentList = append(spentList, spent...)
 	}
+	return rtacc.deleteOwnedCoins(spentList)
 }
 
+// checkKeyImage returns the key images of keyimageList the chain reports as
+// spent.
 func checkKeyImage(shardID byte, tokenID string, keyimageList []string, incclient *incclient.IncClient) ([]string, error) {
-	var newList []string
+	if len(keyimageList) == 0 {
+		return nil, nil
+	}
 	spentList, err := incclient.CheckCoinsSpent(byte(shardID), tokenID, keyimageList)
 	if err != nil {
-		log.Fatalln(err)
+		return nil, err
 	}
-	newlist := []string{}
+	spent := []string{}
 	for idx, v := range spentList {
-		if !v {
-			newlist = append(newlist, keyimageList[idx])
+		if v {
+			spent = append(spent, keyimageList[idx])
 		}
 	}
+	return spent, nil
+}
 
-	return newList, nil
+// removeKeyimages returns keyimageList without the key images of removed.
+func removeKeyimages(keyimageList []string, removed map[string]struct{}) []string {
+	result := []string{}
+	for _, keyimage := range keyimageList {
+		if _, ok := removed[keyimage]; !ok {
+			result = append(result, keyimage)
+		}
+	}
+	return result
 }
 
-func (rtacc *RuntimeAccount) checkCoinOwner(coinList []coin.CoinV2) ([]wcommon.CoinOwnerData, error) {
+func (rtacc *RuntimeAccount) checkCoinOwner(shardID int, fromIndex uint64, coinList []coin.CoinV2) ([]wcommon.CoinOwnerData, error) {
 	var result []wcommon.CoinOwnerData
 
-	for _, coin := range coinList {
-		isOwner, rK := coin.DoesCoinBelongToKeySet(&rtacc.wlk.KeySet)
+	wlk := rtacc.keyWallet()
+	for idx, coin := range coinList {
+		isOwner, rK := coin.DoesCoinBelongToKeySet(&wlk.KeySet)
 		if isOwner {
-			_, err := coin.Decrypt(&rtacc.wlk.KeySet)
+			// without a view key the amount of a confidential coin stays
+			// hidden, the coin is still tracked so the owner knows about it
+			amountHidden := coin.IsEncrypted() && len(wlk.KeySet.ReadonlyKey.Rk) == 0 && len(wlk.KeySet.PrivateKey) == 0
+			if !amountHidden {
+				_, err := coin.Decrypt(&wlk.KeySet)
+				if err != nil {
+					return nil, err
+				}
+			}
+			tokenID, err := rtacc.wlm.getCoinTokenID(&coin, &wlk.KeySet)
 			if err != nil {
 				return nil, err
 			}
+			// key images need the private key, coins found while the account is
+			// locked are resolved once it is unlocked
+			keyimage := ""
+			if len(wlk.KeySet.PrivateKey) > 0 {
+				keyimage = base58.Base58Check{}.Encode(coin.GetKeyImage().ToBytesS(), common.ZeroByte)
+			}
+			value := coin.GetValue()
+			if amountHidden {
+				value = 0
+			}
 			coinOwnerData := wcommon.CoinOwnerData{
-				Pubkey:   coin.GetPublicKey().String(),
-				Keyimage: base58.Base58Check{}.Encode(coin.GetKeyImage().ToBytesS(), common.ZeroByte),
-				Value:    coin.GetValue(),
-				Rk:       rK.String(),
+				Pubkey:       coin.GetPublicKey().String(),
+				Keyimage:     keyimage,
+				Value:        value,
+				AmountHidden: amountHidden,
+				Rk:           rK.String(),
+				TokenID:      tokenID,
+				ShardID:      shardID,
+				Index:        fromIndex + uint64(idx),
 			}
 			result = append(result, coinOwnerData)
 		}
@@ -119,75 +179,301 @@ func (rtacc *RuntimeAccount) checkCoinOwner(coinList []coin.CoinV2) ([]wcommon.C
 	return result, nil
 }
 
-func (rtacc *RuntimeAccount) loadAccountInfo() error {
+// saveOwnedCoins persists newly found coins of a coin stream together with the
+// advanced scan cursor in a single batch, so a restart never skips or loses
+// owned coins. Key images are tracked so checkBalance can later drop them once
+// spent.
+func (rtacc *RuntimeAccount) saveOwnedCoins(streamTokenID string, nextIndex uint64, coins []wcommon.CoinOwnerData) error {
 	rtacc.lock.Lock()
 	defer rtacc.lock.Unlock()
-	pubkey, _ := rtacc.wlk.GetPublicKey()
-	infoKey := buildAccountInfoKey(rtacc.currentNetwork.Name, pubkey)
+	objs, err := rtacc.buildOwnedCoinObjects(coins)
+	if err != nil {
+		return err
+	}
+	if nextIndex > rtacc.coinstate.ScannedCoinIndex[streamTokenID] {
+		rtacc.coinstate.ScannedCoinIndex[streamTokenID] = nextIndex
+	}
 
-	value, err := rtacc.wlm.db.DB.Get([]byte{}, infoKey)
+	historyObjs, err := rtacc.buildHistoryObjects(receivedHistory(coins))
 	if err != nil {
+		return err
+	}
+	objs = append(objs, historyObjs...)
 
+	stateObj, err := rtacc.buildCoinStateObject()
+	if err != nil {
 		return err
 	}
-	var coinstate AccountCoinState
+	objs = append(objs, stateObj)
+	return rtacc.wlm.db.DB.Set([]byte{}, objs)
+}
+
+// buildOwnedCoinObjects adds coins to the coin state and returns their
+// database objects. Coins without a key image are kept in the coin state until
+// it can be derived. The caller must hold rtacc.lock.
+func (rtacc *RuntimeAccount) buildOwnedCoinObjects(coins []wcommon.CoinOwnerData) ([]database.Object, error) {
+	pubkey := rtacc.pubkey
+	var objs []database.Object
+	for _, coinData := range coins {
+		if coinData.Keyimage == "" {
+			rtacc.addUnresolvedCoin(coinData)
+			continue
+		}
+		coinBytes, err := json.Marshal(coinData)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, database.Object{
+			Key:   append([]byte(dbAccountCoinPrefix), buildAccountCoinKey(rtacc.currentNetwork.Name, pubkey, coinData.Keyimage)...),
+			Value: coinBytes,
+		})
+		if coinData.TokenID == common.PRVCoinID.String() {
+			rtacc.coinstate.PRVUTXOList = appendUnique(rtacc.coinstate.PRVUTXOList, coinData.Keyimage)
+		} else {
+			rtacc.coinstate.TokenUTXOList[coinData.TokenID] = appendUnique(rtacc.coinstate.TokenUTXOList[coinData.TokenID], coinData.Keyimage)
+		}
+	}
+	return objs, nil
+}
 
-	if err := json.Unmarshal(value, &coinstate); err != nil {
+func (rtacc *RuntimeAccount) addUnresolvedCoin(coinData wcommon.CoinOwnerData) {
+	rtacc.coinstate.Unresolved[coinData.Pubkey] = coinData
+}
+
+// resolveKeyImages derives the key images of the coins found while the
+// account was locked and moves them to the owned coin store.
+func (rtacc *RuntimeAccount) resolveKeyImages() error {
+	wlk := rtacc.keyWallet()
+	if len(wlk.KeySet.PrivateKey) == 0 {
+		return nil
+	}
+	rtacc.lock.Lock()
+	defer rtacc.lock.Unlock()
+	if len(rtacc.coinstate.Unresolved) == 0 {
+		return nil
+	}
+	var resolved []wcommon.CoinOwnerData
+	for _, coinData := range rtacc.coinstate.Unresolved {
+		coinPubkey, err := hex.DecodeString(coinData.Pubkey)
+		if err != nil {
+			return err
+		}
+		coinList, err := rtacc.wlm.getCoinSyncManager().GetCoinByPubkey([][]byte{coinPubkey})
+		if err != nil {
+			return err
+		}
+		keyImage, err := coinList[0].ParseKeyImageWithPrivateKey(wlk.KeySet.PrivateKey)
+		if err != nil {
+			return err
+		}
+		coinData.Keyimage = base58.Base58Check{}.Encode(keyImage.ToBytesS(), common.ZeroByte)
+		resolved = append(resolved, coinData)
+	}
+	unresolved := rtacc.coinstate.Unresolved
+	rtacc.coinstate.Unresolved = make(map[string]wcommon.CoinOwnerData)
+	objs, err := rtacc.buildOwnedCoinObjects(resolved)
+	if err == nil {
+		var stateObj database.Object
+		stateObj, err = rtacc.buildCoinStateObject()
+		objs = append(objs, stateObj)
+	}
+	if err == nil {
+		err = rtacc.wlm.db.DB.Set([]byte{}, objs)
+	}
+	if err != nil {
+		// kept for the next try
+		rtacc.coinstate.Unresolved = unresolved
 		return err
 	}
+	return nil
+}
 
-	if len(coinstate.scannedCoinIndex) == 0 {
-		coinstate.scannedCoinIndex = make(map[string]uint64)
-		coinstate.scannedCoinIndex[common.PRVCoinID.String()] = 0
-		coinstate.scannedCoinIndex[common.ConfidentialAssetID.String()] = 0
+// deleteOwnedCoins drops spent coins from the coin state and the owned coin
+// store, records them in the account history and expires the pending key
+// images, all in a single batch.
+func (rtacc *RuntimeAccount) deleteOwnedCoins(keyimages []string) error {
+	rtacc.lock.Lock()
+	defer rtacc.lock.Unlock()
+	pubkey := rtacc.pubkey
+	spent := make(map[string]struct{})
+	var entries []HistoryEntry
+	var deleteKeys [][]byte
+	for _, keyimage := range keyimages {
+		spent[keyimage] = struct{}{}
+		delete(rtacc.coinstate.PendingKeyimages, keyimage)
+		coinKey := append([]byte(dbAccountCoinPrefix), buildAccountCoinKey(rtacc.currentNetwork.Name, pubkey, keyimage)...)
+		value, err := rtacc.wlm.db.DB.Get([]byte{}, coinKey)
+		if err != nil {
+			if err == badger.ErrKeyNotFound {
+				continue
+			}
+			return err
+		}
+		var coinData wcommon.CoinOwnerData
+		if err := json.Unmarshal(value, &coinData); err != nil {
+			return err
+		}
+		entries = append(entries, HistoryEntry{
+			Direction: HistorySpent,
+			TokenID:   coinData.TokenID,
+			Amount:    coinData.Value,
+			Keyimage:  keyimage,
+		})
+		deleteKeys = append(deleteKeys, coinKey)
+	}
+	for keyimage, pendingSince := range rtacc.coinstate.PendingKeyimages {
+		if time.Since(time.Unix(pendingSince, 0)) > pendingCoinTimeout {
+			delete(rtacc.coinstate.PendingKeyimages, keyimage)
+		}
+	}
+	// coins found while checking are kept, only the spent ones are removed
+	rtacc.coinstate.PRVUTXOList = removeKeyimages(rtacc.coinstate.PRVUTXOList, spent)
+	for tokenID, keyimageList := range rtacc.coinstate.TokenUTXOList {
+		rtacc.coinstate.TokenUTXOList[tokenID] = removeKeyimages(keyimageList, spent)
+	}
+
+	objs, err := rtacc.buildHistoryObjects(entries)
+	if err != nil {
+		return err
+	}
+	stateObj, err := rtacc.buildCoinStateObject()
+	if err != nil {
+		return err
+	}
+	objs = append(objs, stateObj)
+	return rtacc.wlm.db.DB.Update([]byte{}, objs, deleteKeys)
+}
+
+// getOwnedCoins returns the unspent coins of the account on its current
+// network. The caller must hold rtacc.lock.
+func (rtacc *RuntimeAccount) getOwnedCoins() ([]wcommon.CoinOwnerData, error) {
+	var result []wcommon.CoinOwnerData
+	pubkey := rtacc.pubkey
+	prefix := append([]byte(dbAccountCoinPrefix), buildAccountCoinKey(rtacc.currentNetwork.Name, pubkey, "")...)
+	err := rtacc.wlm.db.DB.ReadIteratorCopy(prefix, false, func(k []byte, v []byte) (bool, error) {
+		var coinData wcommon.CoinOwnerData
+		if err := json.Unmarshal(v, &coinData); err != nil {
+			return true, err
+		}
+		result = append(result, coinData)
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (rtacc *RuntimeAccount) loadAccountInfo() error {
+	rtacc.lock.Lock()
+	defer rtacc.lock.Unlock()
+	pubkey := rtacc.pubkey
+	infoKey := buildAccountDataKey(rtacc.currentNetwork.Name, pubkey)
+
+	var coinstate AccountCoinState
+	value, err := rtacc.wlm.db.DB.Get([]byte{}, infoKey)
+	if err != nil {
+		if err != badger.ErrKeyNotFound {
+			return err
+		}
+	} else if err := json.Unmarshal(value, &coinstate); err != nil {
+		return err
+	}
+
+	if coinstate.ScannedCoinIndex == nil {
+		coinstate.ScannedCoinIndex = make(map[string]uint64)
+	}
+	for _, tokenID := range []string{common.PRVCoinID.String(), common.ConfidentialAssetID.String()} {
+		if _, ok := coinstate.ScannedCoinIndex[tokenID]; !ok {
+			coinstate.ScannedCoinIndex[tokenID] = 0
+		}
 	}
 	if len(coinstate.TokenUTXOList) == 0 {
 		coinstate.TokenUTXOList = make(map[string][]string)
 	}
+	if coinstate.PendingKeyimages == nil {
+		coinstate.PendingKeyimages = make(map[string]int64)
+	}
+	if coinstate.Unresolved == nil {
+		coinstate.Unresolved = make(map[string]wcommon.CoinOwnerData)
+	}
+	for _, coinData := range coinstate.UnresolvedCoins {
+		coinstate.Unresolved[coinData.Pubkey] = coinData
+	}
+	coinstate.UnresolvedCoins = nil
 	rtacc.coinstate = coinstate
 	return nil
 }
 
-func (rtacc *RuntimeAccount) saveAccountInfo() error {
-	rtacc.wlm.incclient.GetMiningInfo()
-	rtacc.lock.Lock()
-	defer rtacc.lock.Unlock()
-	pubkey, _ := rtacc.wlk.GetPublicKey()
-	infoKey := buildAccountInfoKey(rtacc.currentNetwork.Name, pubkey)
-
-	stateBytes, err := json.Marshal(rtacc.coinstate)
+// storeCoinState writes the coin state of the account, the caller must hold
+// rtacc.lock.
+func (rtacc *RuntimeAccount) storeCoinState() error {
+	objData, err := rtacc.buildCoinStateObject()
 	if err != nil {
 		return err
 	}
+	return rtacc.wlm.db.DB.Set([]byte{}, []database.Object{objData})
+}
 
-	objData := database.Object{
+// buildCoinStateObject returns the database object of the coin state, the
+// caller must hold rtacc.lock.
+func (rtacc *RuntimeAccount) buildCoinStateObject() (database.Object, error) {
+	infoKey := buildAccountDataKey(rtacc.currentNetwork.Name, rtacc.pubkey)
+	stateBytes, err := json.Marshal(rtacc.coinstate)
+	if err != nil {
+		return database.Object{}, err
+	}
+	return database.Object{
 		Key:   infoKey,
 		Value: stateBytes,
-	}
-	rtacc.wlm.db.DB.Set([]byte{}, []database.Object{objData})
-	return nil
+	}, nil
 }
 
+// network returns the network the account last started on.
+func (rtacc *RuntimeAccount) network() wcommon.NetworkID {
+	rtacc.lock.RLock()
+	defer rtacc.lock.RUnlock()
+	return rtacc.currentNetwork
+}
+
+func (rtacc *RuntimeAccount) keyWallet() *wallet.KeyWallet {
+	rtacc.lock.RLock()
+	defer rtacc.lock.RUnlock()
+	return rtacc.wlk
+}
+
+// stop cancels the workers of the account and returns once they exited.
 func (rtacc *RuntimeAccount) stop() {
-	close(rtacc.stopCh)
-	for {
-		if rtacc.isStopped {
-			break
-		}
-		time.Sleep(time.Second)
+	rtacc.runLock.Lock()
+	defer rtacc.runLock.Unlock()
+	if rtacc.cancel == nil {
+		return
 	}
-	return
+	rtacc.cancel()
+	rtacc.cancel = nil
+	rtacc.workers.Wait()
 }
 
 func buildAccountInfoKey(networkName string, accountPubkey string) []byte {
 	key := []byte{}
 	key = append(key, []byte(dbAccountInfoPrefix)...)
+	key = append(key, []byte(accountPubkey)...)
 	return key
 }
 
 func buildAccountDataKey(networkName string, accountPubkey string) []byte {
 	key := []byte{}
 	key = append(key, []byte(dbAccountDataPrefix)...)
+	key = append(key, []byte(networkName+"-")...)
+	key = append(key, []byte(accountPubkey)...)
+	return key
+}
+
+func buildAccountCoinKey(networkName string, accountPubkey string, keyimage string) []byte {
+	key := []byte{}
+	key = append(key, []byte(networkName+"-")...)
+	key = append(key, []byte(accountPubkey+"-")...)
+	key = append(key, []byte(keyimage)...)
 	return key
 }
 
@@ -205,6 +491,79 @@ func (rtacc *RuntimeAccount) RemoveWatchToken(tokenID string) error {
 	return nil
 }
 
-func (rtacc *RuntimeAccount) start() error {
+func (rtacc *RuntimeAccount) Pubkey() string {
+	return rtacc.pubkey
+}
+
+// GetBalances returns the balance of each token held by the account on the
+// current network. Coins whose spent status is unknown are not counted, see
+// GetUnverifiedBalances.
+func (rtacc *RuntimeAccount) GetBalances() map[string]uint64 {
+	result := make(map[string]uint64)
+	rtacc.lock.RLock()
+	coins, err := rtacc.getOwnedCoins()
+	rtacc.lock.RUnlock()
+	if err != nil {
+		log.Error().Msgf("get owned coins of %v failed: %v", rtacc.pubkey, err)
+		return result
+	}
+	for _, coinData := range coins {
+		result[coinData.TokenID] += coinData.Value
+	}
+	return result
+}
+
+// GetUnverifiedBalances returns, per token, the amount received in coins that
+// may have been spent since: without the private key their key images, and so
+// their spent status, are unknown. They are the coins of watch-only accounts,
+// and the coins found while an encrypted account was locked until it is
+// unlocked.
+func (rtacc *RuntimeAccount) GetUnverifiedBalances() map[string]uint64 {
+	result := make(map[string]uint64)
+	rtacc.lock.RLock()
+	defer rtacc.lock.RUnlock()
+	for _, coinData := range rtacc.coinstate.Unresolved {
+		result[coinData.TokenID] += coinData.Value
+	}
+	return result
+}
+
+func (rtacc *RuntimeAccount) GetAccount() Account {
+	rtacc.lock.RLock()
+	defer rtacc.lock.RUnlock()
+	account := rtacc.account
+	account.WatchTokens = make(map[string]struct{})
+	for tokenID := range rtacc.account.WatchTokens {
+		account.WatchTokens[tokenID] = struct{}{}
+	}
+	return account
+}
+
+// start runs the scan and balance workers of the account until stop is
+// called or ctx is cancelled.
+func (rtacc *RuntimeAccount) start(ctx context.Context) error {
+	rtacc.runLock.Lock()
+	defer rtacc.runLock.Unlock()
+	if rtacc.cancel != nil || ctx.Err() != nil {
+		return nil
+	}
+	network := rtacc.wlm.GetCurrentNetwork()
+	rtacc.lock.Lock()
+	rtacc.currentNetwork = network
+	rtacc.lock.Unlock()
+	if err := rtacc.loadAccountInfo(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	rtacc.cancel = cancel
+	rtacc.workers.Add(2)
+	go func() {
+		defer rtacc.workers.Done()
+		rtacc.wlm.supervisor.run(ctx, "scan-coins/"+rtacc.pubkey, scanCoinsInterval, rtacc.scanCoinsOnce)
+	}()
+	go func() {
+		defer rtacc.workers.Done()
+		rtacc.wlm.supervisor.run(ctx, "check-balance/"+rtacc.pubkey, scanCoinsInterval, rtacc.checkBalanceOnce)
+	}()
 	return nil
 }
@@ -1,42 +1,103 @@
 package walletmanager
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/incognitochain/go-incognito-sdk-v2/coin"
+	"github.com/incognitochain/go-incognito-sdk-v2/common"
+	"github.com/incognitochain/go-incognito-sdk-v2/rpchandler/jsonresult"
 	"github.com/rs/zerolog/log"
 
 	"github.com/obsidianwallet/obsidian-wallet-node/database"
 )
 
-func (csm *CoinSyncManager) StartSyncCoinsProcess() error {
-	err := csm.loadSyncStates()
+// StartSyncCoinsProcess loads the sync progress of the current network,
+// the shards are then synced on demand with SyncShard until ctx is
+// cancelled or stop is called.
+func (csm *CoinSyncManager) StartSyncCoinsProcess(ctx context.Context) error {
+	csm.lock.Lock()
+	defer csm.lock.Unlock()
+	if csm.ctx != nil {
+		return nil
+	}
+	err := csm.wlm.migrateCoinSchema(csm.currentNetwork.Name)
 	if err != nil {
 		return err
 	}
+	err = csm.loadSyncStates()
+	if err != nil {
+		return err
+	}
+	csm.ctx = ctx
 	return nil
 }
 
+// SyncShard starts downloading the coins of shardid, it does nothing when the
+// shard is already synced or the process is not running. A worker of the
+// shard still stopping is waited for first, so two workers never run under
+// the same supervisor name.
 func (csm *CoinSyncManager) SyncShard(shardid int) error {
 	csm.lock.Lock()
 	defer csm.lock.Unlock()
-	if _, ok := csm.currentSyncShard[shardid]; ok {
+	if csm.ctx == nil || csm.ctx.Err() != nil {
 		return nil
 	}
-	csm.syncShard(shardid)
+	var previous chan struct{}
+	if worker, ok := csm.syncingShards[shardid]; ok {
+		if !worker.stopping {
+			return nil
+		}
+		previous = worker.done
+	}
+	ctx, cancel := context.WithCancel(csm.ctx)
+	worker := &shardSyncWorker{cancel: cancel, done: make(chan struct{})}
+	csm.syncingShards[shardid] = worker
+	csm.workers.Add(1)
+	go func() {
+		defer csm.workers.Done()
+		defer csm.removeShardWorker(shardid, worker)
+		if previous != nil {
+			select {
+			case <-previous:
+			case <-ctx.Done():
+				return
+			}
+		}
+		csm.wlm.supervisor.run(ctx, fmt.Sprintf("sync-shard/%v", shardid), syncShardInterval, func() error {
+			return csm.syncShardOnce(ctx, shardid)
+		})
+	}()
 	return nil
 }
 
+// removeShardWorker closes the done channel of worker and forgets it unless
+// a newer worker of shardid replaced it.
+func (csm *CoinSyncManager) removeShardWorker(shardid int, worker *shardSyncWorker) {
+	csm.lock.Lock()
+	defer csm.lock.Unlock()
+	close(worker.done)
+	if csm.syncingShards[shardid] == worker {
+		delete(csm.syncingShards, shardid)
+	}
+}
+
 func (csm *CoinSyncManager) updateChainState() error {
-	if time.Since(csm.lastChainStateUpdate) < 25*time.Second {
+	csm.lock.RLock()
+	lastUpdate := csm.lastChainStateUpdate
+	csm.lock.RUnlock()
+	if time.Since(lastUpdate) < chainStateUpdateInterval {
 		return nil
 	}
-	csm.lock.Lock()
-	defer csm.lock.Unlock()
 	newState := make(map[int]map[string]uint64)
-	chainState, err := csm.wlm.incclient.GetOTACoinLength()
+	client := csm.wlm.getClient()
+	chainState, err := client.GetOTACoinLength()
 	if err != nil {
+		csm.wlm.reportRPCError(client, err)
 		return err
 	}
 	for token, shard := range chainState {
@@ -47,146 +108,381 @@ func (csm *CoinSyncManager) updateChainState() error {
 			newState[int(shardid)][token] = coinIdx
 		}
 	}
+	csm.lock.Lock()
+	defer csm.lock.Unlock()
 	csm.chainCoinState = newState
+	csm.lastChainStateUpdate = time.Now()
 	return nil
 }
 
-func (csm *CoinSyncManager) syncShard(shardid int) {
-	csm.currentSyncShard[shardid] = true
-	go func() {
-		for {
-			select {
-			case <-csm.stopCh:
-				csm.lock.Lock()
-				defer csm.lock.Unlock()
-				csm.currentSyncShard[shardid] = false
-				return
-			default:
-				err := csm.updateChainState()
-				if err != nil {
-					log.Fatal().Msg(err.Error())
-				}
-				csm.lock.RLock()
-				sync, ok := csm.currentSyncShard[shardid]
-				if !ok || !sync {
-					csm.lock.RUnlock()
-					return
-				}
-				csm.lock.RUnlock()
-
-				chainState := csm.chainCoinState[shardid]
-				currentState := csm.currentSyncState[shardid]
-				for tokenID, chainIdx := range chainState {
-					currentIdx, ok := currentState[tokenID]
-					if !ok {
-						if err := csm.retrieveAndSaveCoins(0, chainIdx, byte(shardid), tokenID); err != nil {
-							log.Fatal().Msgf("retrieveAndSaveCoins of shard %d failed, err: %v", shardid, err)
-						}
-					} else {
-						if err := csm.retrieveAndSaveCoins(currentIdx, chainIdx, byte(shardid), tokenID); err != nil {
-							log.Fatal().Msgf("retrieveAndSaveCoins of shard %d failed, err: %v", shardid, err)
-						}
-					}
-				}
-			}
-			time.Sleep(20 * time.Second)
+// syncShardOnce downloads the coins of shardid added on chain since the
+// last run, it returns nil when ctx is cancelled midway.
+func (csm *CoinSyncManager) syncShardOnce(ctx context.Context, shardid int) error {
+	err := csm.updateChainState()
+	if err != nil {
+		return err
+	}
+	csm.lock.RLock()
+	chainState := make(map[string]uint64)
+	for tokenID, chainIdx := range csm.chainCoinState[shardid] {
+		chainState[tokenID] = chainIdx
+	}
+	csm.lock.RUnlock()
+
+	for tokenID, chainIdx := range chainState {
+		currentIdx := csm.getSyncedIndex(shardid, tokenID)
+		if currentIdx >= chainIdx {
+			continue
 		}
-	}()
+		err := csm.retrieveAndSaveCoins(ctx, currentIdx, chainIdx, byte(shardid), tokenID)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("retrieveAndSaveCoins of shard %d failed: %w", shardid, err)
+		}
+	}
+	return nil
 }
 
-func (csm *CoinSyncManager) retrieveAndSaveCoins(from, to uint64, shardID byte, tokenID string) error {
-	start := from
-	end := from + maxRetrieveCoins
-	if end > to {
-		end = to
+// updateSyncShards syncs the coins of exactly the shards the accounts live
+// in, starting the new shards and stopping the ones left without account.
+func (wlm *WalletManager) updateSyncShards() {
+	accountShards := wlm.getAccountShards()
+	csm := wlm.getCoinSyncManager()
+	for shardid := range csm.syncingShardIDs() {
+		if _, ok := accountShards[shardid]; !ok {
+			csm.stopSyncShard(shardid)
+		}
 	}
-	for {
-		coinIdxs := buildCoinIdxList(start, end)
-		coinList, err := csm.wlm.incclient.GetOTACoinsByIndices(shardID, tokenID, coinIdxs)
-		if err != nil {
-			return err
+	for shardid := range accountShards {
+		if err := csm.SyncShard(shardid); err != nil {
+			log.Error().Msgf("sync shard %v failed: %v", shardid, err)
+		}
+	}
+}
+
+// getAccountShards returns the number of accounts in each shard holding
+// at least one.
+func (wlm *WalletManager) getAccountShards() map[int]int {
+	wlm.lock.RLock()
+	defer wlm.lock.RUnlock()
+	result := make(map[int]int)
+	for _, accRT := range wlm.accounts {
+		result[accRT.shardID]++
+	}
+	return result
+}
+
+// GetSyncStatus returns the coin download progress of every shard holding
+// an account or having coins stored locally.
+func (wlm *WalletManager) GetSyncStatus() []ShardSyncStatus {
+	accountShards := wlm.getAccountShards()
+	csm := wlm.getCoinSyncManager()
+	csm.lock.RLock()
+	defer csm.lock.RUnlock()
+
+	shards := make(map[int]struct{})
+	for shardid := range accountShards {
+		shards[shardid] = struct{}{}
+	}
+	for shardid := range csm.currentSyncState {
+		shards[shardid] = struct{}{}
+	}
+	result := []ShardSyncStatus{}
+	for shardid := range shards {
+		worker, syncing := csm.syncingShards[shardid]
+		syncing = syncing && !worker.stopping
+		status := ShardSyncStatus{
+			ShardID:  shardid,
+			Syncing:  syncing,
+			Accounts: accountShards[shardid],
+			Synced:   len(csm.chainCoinState[shardid]) > 0,
+			Tokens:   []TokenSyncStatus{},
 		}
-		listlen := uint64(len(coinList))
-		if uint64(listlen) != end-start {
-			panic("missing coin list")
+		if stats, ok := csm.downloadStats[shardid]; ok {
+			metrics := stats.CoinDownloadMetrics
+			status.Download = &metrics
 		}
-		for idx, coin := range coinList {
-			coinPubkey := coin.GetPublicKey().ToBytesS()
-			refKeys, err := buildCoinDBKeys(shardID, tokenID, idx, coinPubkey)
-			if err != nil {
-				return err
-			}
-			dataObj := database.Object{
-				Key:   coin.GetPublicKey().ToBytesS(),
-				Value: coin.Bytes(),
+		for _, tokenID := range []string{common.PRVIDStr, common.ConfidentialAssetID.String()} {
+			tokenStatus := TokenSyncStatus{
+				TokenID:    tokenID,
+				LocalIndex: csm.currentSyncState[shardid][tokenID],
+				ChainIndex: csm.chainCoinState[shardid][tokenID],
 			}
-			refObjs := []database.Object{}
-			for _, refKey := range refKeys {
-				refObjs = append(refObjs, database.Object{
-					Key:   refKey,
-					Value: coin.GetPublicKey().ToBytesS(),
-				},
-				)
-			}
-			refObjs = append(refObjs, dataObj)
-			err = csm.wlm.db.DB.Set([]byte(dbCoinDataPrefix), refObjs)
-			if err != nil {
-				return err
+			if tokenStatus.LocalIndex < tokenStatus.ChainIndex {
+				status.Synced = false
 			}
+			status.Tokens = append(status.Tokens, tokenStatus)
 		}
-		err = csm.updateStateSyncState(int(shardID), tokenID, end)
-		if err != nil {
+		result = append(result, status)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ShardID < result[j].ShardID
+	})
+	return result
+}
+
+// retrieveAndSaveCoins downloads the coins [from, to) of tokenID with up to
+// maxConcurrentCoinRequests requests in flight. The chunks are written in
+// order, each in one batch with the sync cursor, so the stored cursor never
+// points past a missing coin. The first error cancels the other requests,
+// and it returns once they all ended.
+func (csm *CoinSyncManager) retrieveAndSaveCoins(ctx context.Context, from, to uint64, shardID byte, tokenID string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	var fetchers sync.WaitGroup
+	defer fetchers.Wait()
+	defer cancel()
+	chunks := make(chan *coinChunk, maxConcurrentCoinRequests)
+	fetchers.Add(1)
+	go func() {
+		defer fetchers.Done()
+		csm.fetchCoinChunks(ctx, &fetchers, from, to, shardID, tokenID, chunks)
+	}()
+
+	for chunk := range chunks {
+		<-chunk.done
+		if chunk.err != nil {
+			return chunk.err
+		}
+		if err := csm.saveCoinChunk(shardID, tokenID, chunk); err != nil {
 			return err
 		}
-		err = csm.storeSyncState(int(shardID))
-		if err != nil {
+		if err := ctx.Err(); err != nil {
 			return err
 		}
+	}
+	return ctx.Err()
+}
+
+// fetchCoinChunks starts fetching the chunks of [from, to) in order and
+// queues them for writing, until every chunk is queued or ctx is cancelled.
+func (csm *CoinSyncManager) fetchCoinChunks(ctx context.Context, fetchers *sync.WaitGroup, from, to uint64, shardID byte, tokenID string, chunks chan<- *coinChunk) {
+	defer close(chunks)
+	inflight := make(chan struct{}, maxConcurrentCoinRequests)
+	for start := from; start < to; {
+		end := start + maxRetrieveCoins
+		if end > to {
+			end = to
+		}
+		select {
+		case inflight <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		chunk := &coinChunk{start: start, end: end, done: make(chan struct{})}
+		fetchers.Add(1)
+		go func() {
+			defer fetchers.Done()
+			defer close(chunk.done)
+			defer func() { <-inflight }()
+			chunk.coins, chunk.err = csm.fetchCoins(ctx, shardID, tokenID, chunk.start, chunk.end)
+		}()
+		select {
+		case chunks <- chunk:
+		case <-ctx.Done():
+			return
+		}
 		start = end
-		if end < to {
-			if end+maxRetrieveCoins > to {
-				end = to
-			} else {
-				end += maxRetrieveCoins
+	}
+}
+
+// fetchCoins gets the coins [start, end) in requests of the shard chunk
+// size, which is halved on every RPC error and grows back on success.
+func (csm *CoinSyncManager) fetchCoins(ctx context.Context, shardID byte, tokenID string, start, end uint64) (map[uint64]jsonresult.ICoinInfo, error) {
+	result := make(map[uint64]jsonresult.ICoinInfo)
+	failures := 0
+	for start < end {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		requestEnd := start + csm.getChunkSize(int(shardID))
+		if requestEnd > end {
+			requestEnd = end
+		}
+		client := csm.wlm.getClient()
+		coinList, err := client.GetOTACoinsByIndices(shardID, tokenID, buildCoinIdxList(start, requestEnd))
+		if err == nil && uint64(len(coinList)) != requestEnd-start {
+			err = fmt.Errorf("got %v coins of shard %v token %v from %v to %v", len(coinList), shardID, tokenID, start, requestEnd)
+		}
+		csm.recordCoinRequest(int(shardID), err)
+		if err != nil {
+			csm.wlm.reportRPCError(client, err)
+			failures++
+			if failures > maxCoinRequestRetries {
+				return nil, err
+			}
+			log.Warn().Msgf("get coins of shard %v failed, retrying with %v coins: %v", shardID, csm.getChunkSize(int(shardID)), err)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Duration(failures) * coinRequestRetryDelay):
 			}
-		} else {
-			break
+			continue
 		}
+		failures = 0
+		for idx, outCoin := range coinList {
+			result[idx] = outCoin
+		}
+		start = requestEnd
 	}
+	return result, nil
+}
+
+// saveCoinChunk writes the coins of chunk and the sync cursor moved to its
+// end in one batch.
+func (csm *CoinSyncManager) saveCoinChunk(shardID byte, tokenID string, chunk *coinChunk) error {
+	network := csm.currentNetwork.Name
+	// the index keys rely on the token ID size to sort in chain order
+	if len(tokenID) != coinTokenIDSize {
+		return fmt.Errorf("invalid coin token ID %q", tokenID)
+	}
+	var objs []database.Object
+	for idx := chunk.start; idx < chunk.end; idx++ {
+		outCoin, ok := chunk.coins[idx]
+		if !ok {
+			return fmt.Errorf("coin %v of shard %v token %v is missing", idx, shardID, tokenID)
+		}
+		coinPubkey := outCoin.GetPublicKey().ToBytesS()
+		objs = append(objs, database.Object{
+			Key:   buildCoinIdxKey(network, shardID, tokenID, idx),
+			Value: coinPubkey,
+		})
+		objs = append(objs, database.Object{
+			Key:   buildCoinDataKey(network, coinPubkey),
+			Value: outCoin.Bytes(),
+		})
+	}
+
+	csm.lock.RLock()
+	state := make(map[string]uint64)
+	for stateTokenID, idx := range csm.currentSyncState[int(shardID)] {
+		state[stateTokenID] = idx
+	}
+	csm.lock.RUnlock()
+	state[tokenID] = chunk.end
+	stateBytes, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	objs = append(objs, database.Object{
+		Key:   buildSyncStateKey(network, shardID),
+		Value: stateBytes,
+	})
+	if err := csm.wlm.db.DB.Set([]byte{}, objs); err != nil {
+		return err
+	}
+	if err := csm.updateStateSyncState(int(shardID), tokenID, chunk.end); err != nil {
+		return err
+	}
+	csm.recordCoinsSaved(int(shardID), chunk.end-chunk.start)
 	return nil
 }
 
-func (csm *CoinSyncManager) stopSyncShard(shardid int) error {
+func (csm *CoinSyncManager) getChunkSize(shardid int) uint64 {
 	csm.lock.Lock()
 	defer csm.lock.Unlock()
-	csm.currentSyncShard[shardid] = false
-	return nil
+	return csm.getDownloadStats(shardid).ChunkSize
 }
 
-func (csm *CoinSyncManager) updateStateSyncState(shardid int, tokenID string, idx uint64) error {
+// recordCoinRequest counts a coin request of shardid and adapts the chunk
+// size to its result.
+func (csm *CoinSyncManager) recordCoinRequest(shardid int, err error) {
 	csm.lock.Lock()
 	defer csm.lock.Unlock()
-	csm.currentSyncState[shardid][tokenID] = idx
-	return nil
+	stats := csm.getDownloadStats(shardid)
+	stats.Requests++
+	if err != nil {
+		stats.RequestErrors++
+		stats.ChunkSize /= 2
+		if stats.ChunkSize < minRetrieveCoins {
+			stats.ChunkSize = minRetrieveCoins
+		}
+		return
+	}
+	stats.ChunkSize += stats.ChunkSize / 4
+	if stats.ChunkSize > maxRetrieveCoins {
+		stats.ChunkSize = maxRetrieveCoins
+	}
+}
+
+func (csm *CoinSyncManager) recordCoinsSaved(shardid int, count uint64) {
+	csm.lock.Lock()
+	defer csm.lock.Unlock()
+	stats := csm.getDownloadStats(shardid)
+	stats.CoinsDownloaded += count
+	stats.windowCoins += count
+	now := time.Now()
+	if stats.windowStart.IsZero() {
+		stats.windowStart = now
+		return
+	}
+	if elapsed := now.Sub(stats.windowStart); elapsed >= downloadRateWindow {
+		stats.CoinsPerSecond = float64(stats.windowCoins) / elapsed.Seconds()
+		stats.windowStart = now
+		stats.windowCoins = 0
+	}
+}
+
+// getDownloadStats returns the download metrics of shardid, creating them
+// if needed. The caller holds csm.lock.
+func (csm *CoinSyncManager) getDownloadStats(shardid int) *coinDownloadStats {
+	stats, ok := csm.downloadStats[shardid]
+	if !ok {
+		stats = &coinDownloadStats{CoinDownloadMetrics: CoinDownloadMetrics{ChunkSize: maxRetrieveCoins}}
+		csm.downloadStats[shardid] = stats
+	}
+	return stats
+}
+
+// stopSyncShard stops downloading the coins of shardid and returns once the
+// worker exited, the coins already stored are kept.
+func (csm *CoinSyncManager) stopSyncShard(shardid int) {
+	csm.lock.Lock()
+	worker, ok := csm.syncingShards[shardid]
+	if ok {
+		worker.cancel()
+		worker.stopping = true
+	}
+	csm.lock.Unlock()
+	if ok {
+		<-worker.done
+	}
 }
 
-func (csm *CoinSyncManager) storeSyncState(shardid int) error {
+// syncingShardIDs returns the shards being synced.
+func (csm *CoinSyncManager) syncingShardIDs() map[int]struct{} {
 	csm.lock.RLock()
 	defer csm.lock.RUnlock()
-	var obj database.Object
-	obj.Key = []byte{byte(shardid)}
-	dataBytes, err := json.Marshal(csm.currentSyncState[shardid])
-	if err != nil {
-		return err
+	result := make(map[int]struct{})
+	for shardid, worker := range csm.syncingShards {
+		if !worker.stopping {
+			result[shardid] = struct{}{}
+		}
 	}
-	obj.Value = dataBytes
-	return csm.wlm.db.DB.Set([]byte(dbSyncStateDataPrefix), []database.Object{obj})
+	return result
 }
 
+func (csm *CoinSyncManager) updateStateSyncState(shardid int, tokenID string, idx uint64) error {
+	csm.lock.Lock()
+	defer csm.lock.Unlock()
+	if csm.currentSyncState[shardid] == nil {
+		csm.currentSyncState[shardid] = make(map[string]uint64)
+	}
+	csm.currentSyncState[shardid][tokenID] = idx
+	return nil
+}
+
+// loadSyncStates reads the stored sync progress. The caller holds csm.lock.
 func (csm *CoinSyncManager) loadSyncStates() error {
 	shardsState := make(map[int]map[string]uint64)
+	prefix := []byte(dbSyncStatePrefix + csm.currentNetwork.Name + "-")
 	loadstate := func(k []byte, v []byte) (bool, error) {
-		shardID := int(k[0])
+		if len(k) != len(prefix)+1 {
+			// the prefix of another network with a name extending this one
+			return false, nil
+		}
+		shardID := int(k[len(k)-1])
 		state := make(map[string]uint64)
 		err := json.Unmarshal(v, &state)
 		if err != nil {
@@ -195,7 +491,7 @@ func (csm *CoinSyncManager) loadSyncStates() error {
 		shardsState[shardID] = state
 		return false, nil
 	}
-	err := csm.wlm.db.DB.ReadIteratorNonCopy([]byte(dbSyncStateDataPrefix), false, loadstate)
+	err := csm.wlm.db.DB.ReadIteratorNonCopy(prefix, false, loadstate)
 	if err != nil {
 		return err
 	}
@@ -203,11 +499,19 @@ func (csm *CoinSyncManager) loadSyncStates() error {
 	return nil
 }
 
+// getSyncedIndex returns the number of coins of tokenID stored locally for the
+// shard, i.e. every index below it can be read from the database.
+func (csm *CoinSyncManager) getSyncedIndex(shardid int, tokenID string) uint64 {
+	csm.lock.RLock()
+	defer csm.lock.RUnlock()
+	return csm.currentSyncState[shardid][tokenID]
+}
+
 func (csm *CoinSyncManager) GetCoinPubkeyByIndices(shardid int, tokenID string, from uint64, to uint64) ([][]byte, error) {
 	var result [][]byte
-	for i := from; i <= to; i++ {
-		key := buildCoinIdxKey(byte(shardid), tokenID, i)
-		value, err := csm.wlm.db.DB.Get([]byte(dbCoinDataPrefix), key)
+	for i := from; i < to; i++ {
+		key := buildCoinIdxKey(csm.currentNetwork.Name, byte(shardid), tokenID, i)
+		value, err := csm.wlm.db.DB.Get([]byte{}, key)
 		if err != nil {
 			log.Printf("coin idx not found: shardid %v tokenid %v from %v to %v i %v err %v", shardid, tokenID, from, to, i, err)
 			return nil, err
@@ -220,7 +524,7 @@ func (csm *CoinSyncManager) GetCoinPubkeyByIndices(shardid int, tokenID string,
 func (csm *CoinSyncManager) GetCoinByPubkey(pubkeys [][]byte) ([]coin.CoinV2, error) {
 	var result []coin.CoinV2
 	for _, pubkey := range pubkeys {
-		value, err := csm.wlm.db.DB.Get([]byte(dbCoinDataPrefix), pubkey)
+		value, err := csm.wlm.db.DB.Get([]byte{}, buildCoinDataKey(csm.currentNetwork.Name, pubkey))
 		if err != nil {
 			log.Printf("coin not found: pubkey %v err %v", pubkey, err)
 			return nil, err
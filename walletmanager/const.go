@@ -3,16 +3,83 @@ package walletmanager
 import "time"
 
 const (
-	dbAccountInfoPrefix   = "wlmacc-info-"
-	dbAccountDataPrefix   = "wlmacc-data-"
-	dbCoinDataPrefix      = "coin-"
-	dbSyncStateDataPrefix = "sync-state-"
+	dbAccountInfoPrefix    = "wlmacc-info-"
+	dbAccountDataPrefix    = "wlmacc-data-"
+	dbAccountCoinPrefix    = "wlmacc-coin-"
+	dbAccountHistoryPrefix = "wlmacc-hist-"
+	dbCoinIndexPrefix      = "coinidx-v1-"
+	dbCoinDataPrefix       = "coindata-v1-"
+	dbSyncStatePrefix      = "syncstate-v1-"
+	dbCoinSchemaKey        = "wlm-coin-schema"
+	dbWalletCryptoKey      = "wlm-crypto"
+	dbWalletSeedKey        = "wlm-seed"
+	dbContactPrefix        = "wlm-contact-"
 )
 
+// coin database layout before the keys were namespaced by network
 const (
-	maxRetrieveCoins = 1000
+	dbLegacyCoinPrefix      = "coin-"
+	dbLegacySyncStatePrefix = "sync-state-"
 )
 
 const (
-	scanCoinsInterval = 15 * time.Second
+	coinSchemaVersion      = 1
+	coinTokenIDSize        = 64
+	coinPubkeySize         = 32
+	coinMigrationBatchSize = 1000
+)
+
+const (
+	maxRetrieveCoins   = 1000
+	minRetrieveCoins   = 50
+	scanCoinsBatchSize = 100
+)
+
+// restart delays of a failing background worker
+const (
+	workerMinBackoff = time.Second
+	workerMaxBackoff = 5 * time.Minute
+)
+
+const (
+	maxConcurrentCoinRequests = 4
+	maxCoinRequestRetries     = 5
+	coinRequestRetryDelay     = 2 * time.Second
+	downloadRateWindow        = 30 * time.Second
+)
+
+const (
+	syncShardInterval        = 20 * time.Second
+	chainStateUpdateInterval = 25 * time.Second
+)
+
+const (
+	scanCoinsInterval  = 15 * time.Second
+	pendingCoinTimeout = 10 * time.Minute
+)
+
+const (
+	maxTxMemoSize      = 512
+	maxHistoryPageSize = 100
+	maxContactNameSize = 64
+)
+
+// argon2id parameters for deriving the wallet encryption key
+const (
+	kdfTime    = 3
+	kdfMemory  = 64 * 1024
+	kdfThreads = 4
+)
+
+const (
+	defaultUnlockTimeout = 5 * time.Minute
+	maxUnlockTimeout     = 24 * time.Hour
+)
+
+const (
+	mnemonicBitSize   = 128
+	maxDeriveAccounts = 100
+	// firstDerivationIndex is the child index of the first account of a
+	// master seed, as in the Incognito apps
+	firstDerivationIndex = 1
 )
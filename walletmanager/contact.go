@@ -1 +1,213 @@
 package walletmanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/incognitochain/go-incognito-sdk-v2/common"
+	"github.com/incognitochain/go-incognito-sdk-v2/wallet"
+
+	"github.com/obsidianwallet/obsidian-wallet-node/database"
+)
+
+// AddContact validates and stores a new contact. Names are unique ignoring
+// case and an address can only be saved once.
+func (wlm *WalletManager) AddContact(contact Contact) (*Contact, error) {
+	wlm.contactLock.Lock()
+	defer wlm.contactLock.Unlock()
+	if err := validateContact(&contact); err != nil {
+		return nil, err
+	}
+	contacts, err := wlm.loadContacts()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDuplicateContact(contacts, contact, ""); err != nil {
+		return nil, err
+	}
+	if err := wlm.saveContacts(contact); err != nil {
+		return nil, err
+	}
+	return &contact, nil
+}
+
+// UpdateContact replaces the contact saved under name, which may be renamed.
+func (wlm *WalletManager) UpdateContact(name string, contact Contact) (*Contact, error) {
+	wlm.contactLock.Lock()
+	defer wlm.contactLock.Unlock()
+	if err := validateContact(&contact); err != nil {
+		return nil, err
+	}
+	contacts, err := wlm.loadContacts()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := contacts[contactKey(name)]; !ok {
+		return nil, ErrContactNotFound
+	}
+	if err := checkDuplicateContact(contacts, contact, name); err != nil {
+		return nil, err
+	}
+
+	objs, err := buildContactObjects(contact)
+	if err != nil {
+		return nil, err
+	}
+	if contactKey(name) != contactKey(contact.Name) {
+		if err := wlm.db.DB.Delete([]byte(dbContactPrefix), []byte(contactKey(name))); err != nil {
+			return nil, err
+		}
+	}
+	if err := wlm.db.DB.Set([]byte(dbContactPrefix), objs); err != nil {
+		return nil, err
+	}
+	return &contact, nil
+}
+
+func (wlm *WalletManager) DeleteContact(name string) error {
+	wlm.contactLock.Lock()
+	defer wlm.contactLock.Unlock()
+	if _, err := wlm.GetContact(name); err != nil {
+		return err
+	}
+	return wlm.db.DB.Delete([]byte(dbContactPrefix), []byte(contactKey(name)))
+}
+
+func (wlm *WalletManager) GetContact(name string) (*Contact, error) {
+	value, err := wlm.db.DB.Get([]byte(dbContactPrefix), []byte(contactKey(name)))
+	if err != nil {
+		if err == badger.ErrKeyNotFound {
+			return nil, ErrContactNotFound
+		}
+		return nil, err
+	}
+	var contact Contact
+	if err := json.Unmarshal(value, &contact); err != nil {
+		return nil, err
+	}
+	return &contact, nil
+}
+
+// ListContacts returns the contacts sorted by name.
+func (wlm *WalletManager) ListContacts() ([]Contact, error) {
+	contacts, err := wlm.loadContacts()
+	if err != nil {
+		return nil, err
+	}
+	result := []Contact{}
+	for _, contact := range contacts {
+		result = append(result, contact)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return contactKey(result[i].Name) < contactKey(result[j].Name)
+	})
+	return result, nil
+}
+
+// resolveReceivers fills the payment address of receivers given by contact
+// name.
+func (wlm *WalletManager) resolveReceivers(receivers []TxReceiver) ([]TxReceiver, error) {
+	result := make([]TxReceiver, len(receivers))
+	for idx, receiver := range receivers {
+		if receiver.Contact != "" {
+			contact, err := wlm.GetContact(receiver.Contact)
+			if err != nil {
+				return nil, fmt.Errorf("contact %v: %v", receiver.Contact, err)
+			}
+			if receiver.PaymentAddress != "" && receiver.PaymentAddress != contact.Address {
+				return nil, fmt.Errorf("payment address does not match contact %v", receiver.Contact)
+			}
+			receiver.PaymentAddress = contact.Address
+		}
+		result[idx] = receiver
+	}
+	return result, nil
+}
+
+func (wlm *WalletManager) loadContacts() (map[string]Contact, error) {
+	contacts := make(map[string]Contact)
+	err := wlm.db.DB.ReadIteratorCopy([]byte(dbContactPrefix), false, func(k []byte, v []byte) (bool, error) {
+		var contact Contact
+		if err := json.Unmarshal(v, &contact); err != nil {
+			return true, err
+		}
+		contacts[contactKey(contact.Name)] = contact
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return contacts, nil
+}
+
+func (wlm *WalletManager) saveContacts(contacts ...Contact) error {
+	objs, err := buildContactObjects(contacts...)
+	if err != nil {
+		return err
+	}
+	return wlm.db.DB.Set([]byte(dbContactPrefix), objs)
+}
+
+func buildContactObjects(contacts ...Contact) ([]database.Object, error) {
+	var objs []database.Object
+	for _, contact := range contacts {
+		contactBytes, err := json.Marshal(contact)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, database.Object{
+			Key:   []byte(contactKey(contact.Name)),
+			Value: contactBytes,
+		})
+	}
+	return objs, nil
+}
+
+// validateContact checks the name and decodes the address, filling the
+// shard it belongs to.
+func validateContact(contact *Contact) error {
+	contact.Name = strings.TrimSpace(contact.Name)
+	if contact.Name == "" {
+		return errors.New("contact name is required")
+	}
+	if len(contact.Name) > maxContactNameSize {
+		return fmt.Errorf("contact name must be at most %v bytes", maxContactNameSize)
+	}
+	contact.Address = strings.TrimSpace(contact.Address)
+	addrWallet, err := wallet.Base58CheckDeserialize(contact.Address)
+	if err != nil {
+		return fmt.Errorf("invalid payment address: %v", err)
+	}
+	if len(addrWallet.KeySet.PaymentAddress.Pk) == 0 {
+		return errors.New("invalid payment address")
+	}
+	contact.ShardID = getAddressShardID(addrWallet.KeySet.PaymentAddress.Pk, common.MaxShardNumber)
+	return nil
+}
+
+// checkDuplicateContact rejects contact if another contact than the one
+// saved under currentName has the same name or address.
+func checkDuplicateContact(contacts map[string]Contact, contact Contact, currentName string) error {
+	for key, existing := range contacts {
+		if currentName != "" && key == contactKey(currentName) {
+			continue
+		}
+		if key == contactKey(contact.Name) {
+			return ErrContactExists
+		}
+		// addresses may be encoded differently for the same keys
+		sameAddress, err := wallet.ComparePaymentAddresses(existing.Address, contact.Address)
+		if err == nil && sameAddress {
+			return fmt.Errorf("%w: address already saved as %v", ErrContactExists, existing.Name)
+		}
+	}
+	return nil
+}
+
+func contactKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
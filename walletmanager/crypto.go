@@ -0,0 +1,351 @@
+package walletmanager
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/incognitochain/go-incognito-sdk-v2/wallet"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/obsidianwallet/obsidian-wallet-node/database"
+)
+
+// walletCryptoParams holds the argon2id parameters used to derive the wallet
+// encryption key from the passphrase, and a hash of the key to check it.
+type walletCryptoParams struct {
+	Salt    []byte
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+	KeyHash []byte
+}
+
+func (params *walletCryptoParams) deriveKey(passphrase string) []byte {
+	return argon2.IDKey([]byte(passphrase), params.Salt, params.Time, params.Memory, params.Threads, chacha20poly1305.KeySize)
+}
+
+func keyHash(key []byte) []byte {
+	hash := sha256.Sum256(append([]byte("obsidian-wallet-key-check"), key...))
+	return hash[:]
+}
+
+// encryptData seals data with XChaCha20-Poly1305, binding it to
+// additionalData, and returns base64(nonce | ciphertext).
+func encryptData(key []byte, data []byte, additionalData []byte) (string, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, data, additionalData)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptData(key []byte, encoded string, additionalData []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("invalid encrypted data")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData)
+}
+
+func (wlm *WalletManager) loadCryptoParams() error {
+	value, err := wlm.db.DB.Get([]byte{}, []byte(dbWalletCryptoKey))
+	if err != nil {
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		return err
+	}
+	var params walletCryptoParams
+	if err := json.Unmarshal(value, &params); err != nil {
+		return err
+	}
+	wlm.cryptoParams = &params
+	return nil
+}
+
+// IsLocked reports whether the wallet is encrypted and its key is not
+// available, in which case accounts keep scanning but cannot sign.
+func (wlm *WalletManager) IsLocked() bool {
+	wlm.cryptoLock.RLock()
+	defer wlm.cryptoLock.RUnlock()
+	return wlm.cryptoParams != nil && wlm.encryptionKey == nil
+}
+
+func (wlm *WalletManager) IsEncrypted() bool {
+	wlm.cryptoLock.RLock()
+	defer wlm.cryptoLock.RUnlock()
+	return wlm.cryptoParams != nil
+}
+
+// EncryptWallet sets the wallet passphrase and encrypts the private keys of
+// every account at rest. The wallet is locked afterwards.
+//
+// The database is compacted afterwards so the plaintext keys it held are
+// dropped from disk. Badger only drops the values of its memtable once it is
+// flushed, on close at the latest, so the node should be restarted before the
+// data directory is considered free of plaintext keys.
+func (wlm *WalletManager) EncryptWallet(passphrase string) error {
+	if err := wlm.encryptAccounts(passphrase); err != nil {
+		return err
+	}
+	if err := wlm.db.DB.Compact(); err != nil {
+		// the keys are encrypted, the periodic GC drops the stale values later
+		log.Error().Msgf("compact database after encryption failed: %v", err)
+	}
+	return nil
+}
+
+func (wlm *WalletManager) encryptAccounts(passphrase string) error {
+	if passphrase == "" {
+		return errors.New("passphrase must not be empty")
+	}
+	wlm.cryptoLock.Lock()
+	defer wlm.cryptoLock.Unlock()
+	if wlm.cryptoParams != nil {
+		return ErrWalletEncrypted
+	}
+	params := walletCryptoParams{
+		Salt:    make([]byte, 16),
+		Time:    kdfTime,
+		Memory:  kdfMemory,
+		Threads: kdfThreads,
+	}
+	if _, err := rand.Read(params.Salt); err != nil {
+		return err
+	}
+	key := params.deriveKey(passphrase)
+	params.KeyHash = keyHash(key)
+
+	wlm.lock.RLock()
+	defer wlm.lock.RUnlock()
+	encrypted := make(map[string]Account)
+	for pubkey, accRT := range wlm.accounts {
+		account := accRT.GetAccount()
+		if account.Type != Masterless || account.IsEncrypted {
+			continue
+		}
+		encryptedKey, err := encryptData(key, []byte(account.PrivateKey), []byte(pubkey))
+		if err != nil {
+			return err
+		}
+		account.PrivateKey = encryptedKey
+		account.IsEncrypted = true
+		encrypted[pubkey] = account
+	}
+
+	paramsBytes, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	objs := []database.Object{{Key: []byte(dbWalletCryptoKey), Value: paramsBytes}}
+	for pubkey, account := range encrypted {
+		accountBytes, err := json.Marshal(account)
+		if err != nil {
+			return err
+		}
+		objs = append(objs, database.Object{
+			Key:   buildAccountInfoKey("", pubkey),
+			Value: accountBytes,
+		})
+	}
+	if err := wlm.db.DB.Set([]byte{}, objs); err != nil {
+		return err
+	}
+
+	wlm.cryptoParams = &params
+	for pubkey, account := range encrypted {
+		accRT := wlm.accounts[pubkey]
+		accRT.lock.Lock()
+		accRT.account.PrivateKey = account.PrivateKey
+		accRT.account.IsEncrypted = true
+		accRT.wlk = viewOnlyKeyWallet(accRT.wlk)
+		accRT.lock.Unlock()
+	}
+	return nil
+}
+
+// Unlock derives the wallet key from passphrase and restores the private keys
+// of the encrypted accounts until timeout elapses or Lock is called.
+func (wlm *WalletManager) Unlock(passphrase string, timeout time.Duration) (time.Time, error) {
+	wlm.cryptoLock.Lock()
+	defer wlm.cryptoLock.Unlock()
+	if wlm.cryptoParams == nil {
+		return time.Time{}, ErrNotEncrypted
+	}
+	if timeout <= 0 {
+		timeout = defaultUnlockTimeout
+	}
+	if timeout > maxUnlockTimeout {
+		timeout = maxUnlockTimeout
+	}
+	key := wlm.cryptoParams.deriveKey(passphrase)
+	if subtle.ConstantTimeCompare(keyHash(key), wlm.cryptoParams.KeyHash) != 1 {
+		return time.Time{}, ErrWrongPassphrase
+	}
+
+	masterKey, err := wlm.decryptMasterKey(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	wlm.lock.RLock()
+	for pubkey, accRT := range wlm.accounts {
+		if err := accRT.unlock(key, masterKey, pubkey); err != nil {
+			wlm.lock.RUnlock()
+			wlm.lockAccounts()
+			return time.Time{}, err
+		}
+	}
+	wlm.lock.RUnlock()
+
+	// unlocking an unlocked wallet replaces the key material
+	wipeBytes(wlm.encryptionKey)
+	if wlm.masterKey != masterKey {
+		wipeKeyWallet(wlm.masterKey)
+	}
+	wlm.encryptionKey = key
+	wlm.masterKey = masterKey
+	if wlm.relockTimer != nil {
+		wlm.relockTimer.Stop()
+	}
+	// a timer of a previous unlock that already fired may still be waiting
+	// for cryptoLock, the generation tells it not to lock this session
+	wlm.unlockGeneration++
+	generation := wlm.unlockGeneration
+	wlm.relockTimer = time.AfterFunc(timeout, func() {
+		wlm.lockIfGeneration(generation)
+	})
+	return time.Now().Add(timeout), nil
+}
+
+// Lock drops the wallet key and the private keys of the encrypted accounts.
+func (wlm *WalletManager) Lock() {
+	wlm.cryptoLock.Lock()
+	defer wlm.cryptoLock.Unlock()
+	wlm.lockWallet()
+}
+
+// lockIfGeneration locks the wallet when it is still in the session of the
+// unlock numbered generation.
+func (wlm *WalletManager) lockIfGeneration(generation uint64) {
+	wlm.cryptoLock.Lock()
+	defer wlm.cryptoLock.Unlock()
+	if wlm.unlockGeneration != generation {
+		return
+	}
+	wlm.lockWallet()
+}
+
+// lockWallet wipes the key material, the caller holds cryptoLock.
+func (wlm *WalletManager) lockWallet() {
+	if wlm.relockTimer != nil {
+		wlm.relockTimer.Stop()
+		wlm.relockTimer = nil
+	}
+	wlm.unlockGeneration++
+	wipeBytes(wlm.encryptionKey)
+	wlm.encryptionKey = nil
+	wipeKeyWallet(wlm.masterKey)
+	wlm.masterKey = nil
+	wlm.lockAccounts()
+}
+
+func wipeBytes(data []byte) {
+	for i := range data {
+		data[i] = 0
+	}
+}
+
+// wipeKeyWallet zeroes the private key material of wlk. Only keys owned by
+// the wallet manager may be wiped, view-only copies share the public parts.
+func wipeKeyWallet(wlk *wallet.KeyWallet) {
+	if wlk == nil {
+		return
+	}
+	wipeBytes(wlk.ChainCode)
+	wipeBytes(wlk.KeySet.PrivateKey)
+	if wlk.HDKey != nil {
+		wipeBytes(wlk.HDKey.Chaincode)
+		wipeBytes(wlk.HDKey.Key)
+	}
+}
+
+func (wlm *WalletManager) lockAccounts() {
+	wlm.lock.RLock()
+	defer wlm.lock.RUnlock()
+	for _, accRT := range wlm.accounts {
+		accRT.lock.Lock()
+		if accRT.account.IsEncrypted {
+			accRT.wlk = viewOnlyKeyWallet(accRT.wlk)
+		}
+		accRT.lock.Unlock()
+	}
+}
+
+func (rtacc *RuntimeAccount) unlock(key []byte, masterKey *wallet.KeyWallet, pubkey string) error {
+	rtacc.lock.Lock()
+	defer rtacc.lock.Unlock()
+	if !rtacc.account.IsEncrypted {
+		return nil
+	}
+	var wlk *wallet.KeyWallet
+	var err error
+	if rtacc.account.Type == HDDerived {
+		if masterKey == nil {
+			return ErrNoMasterSeed
+		}
+		wlk, err = masterKey.DeriveChild(rtacc.account.DerivationIndex)
+	} else {
+		wlk, err = decryptPrivateKey(key, rtacc.account.PrivateKey, pubkey)
+	}
+	if err != nil {
+		return err
+	}
+	rtacc.wlk = wlk
+	return nil
+}
+
+func decryptPrivateKey(key []byte, encryptedKey string, pubkey string) (*wallet.KeyWallet, error) {
+	privateKey, err := decryptData(key, encryptedKey, []byte(pubkey))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	wlk, err := wallet.Base58CheckDeserialize(string(privateKey))
+	if err != nil {
+		return nil, err
+	}
+	if len(wlk.KeySet.PrivateKey) == 0 {
+		return nil, ErrInvalidKey
+	}
+	return wlk, nil
+}
+
+// viewOnlyKeyWallet strips the private key of wlk, keeping what scanning
+// needs: the payment address, the OTA key and the view key.
+func viewOnlyKeyWallet(wlk *wallet.KeyWallet) *wallet.KeyWallet {
+	viewWallet := &wallet.KeyWallet{}
+	viewWallet.KeySet.PaymentAddress = wlk.KeySet.PaymentAddress
+	viewWallet.KeySet.ReadonlyKey = wlk.KeySet.ReadonlyKey
+	viewWallet.KeySet.OTAKey = wlk.KeySet.OTAKey
+	return viewWallet
+}
@@ -0,0 +1,118 @@
+package walletmanager
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func TestEncryptDecryptData(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, chacha20poly1305.KeySize)
+	otherKey := bytes.Repeat([]byte{2}, chacha20poly1305.KeySize)
+	data := []byte("private key")
+	encrypted, err := encryptData(key, data, []byte("account-1"))
+	if err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+	again, err := encryptData(key, data, []byte("account-1"))
+	if err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+	if again == encrypted {
+		t.Error("encrypting twice gave the same ciphertext, the nonce is not random")
+	}
+	sealed, _ := base64.StdEncoding.DecodeString(encrypted)
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name           string
+		key            []byte
+		encoded        string
+		additionalData string
+		wantErr        bool
+	}{
+		{name: "same key and data", key: key, encoded: encrypted, additionalData: "account-1"},
+		{name: "other key", key: otherKey, encoded: encrypted, additionalData: "account-1", wantErr: true},
+		{name: "other additional data", key: key, encoded: encrypted, additionalData: "account-2", wantErr: true},
+		{name: "tampered", key: key, encoded: base64.StdEncoding.EncodeToString(tampered), additionalData: "account-1", wantErr: true},
+		{name: "shorter than the nonce", key: key, encoded: base64.StdEncoding.EncodeToString(sealed[:4]), additionalData: "account-1", wantErr: true},
+		{name: "not base64", key: key, encoded: "not base64!", additionalData: "account-1", wantErr: true},
+		{name: "invalid key size", key: key[:16], encoded: encrypted, additionalData: "account-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := decryptData(tt.key, tt.encoded, []byte(tt.additionalData))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !bytes.Equal(got, data) {
+			t.Errorf("%v: got %q, want %q", tt.name, got, data)
+		}
+	}
+}
+
+// newTestEncryptedWallet returns a wallet without account encrypted with
+// passphrase, with cheap key derivation parameters.
+func newTestEncryptedWallet(passphrase string) *WalletManager {
+	params := &walletCryptoParams{Salt: []byte("salt"), Time: 1, Memory: 64, Threads: 1}
+	params.KeyHash = keyHash(params.deriveKey(passphrase))
+	return &WalletManager{cryptoParams: params, accounts: make(map[string]*RuntimeAccount)}
+}
+
+func TestUnlockTwice(t *testing.T) {
+	wlm := newTestEncryptedWallet("passphrase")
+	if _, err := wlm.Unlock("passphrase", 20*time.Millisecond); err != nil {
+		t.Fatalf("first unlock failed: %v", err)
+	}
+	wlm.cryptoLock.RLock()
+	firstKey := wlm.encryptionKey
+	firstGeneration := wlm.unlockGeneration
+	wlm.cryptoLock.RUnlock()
+
+	if _, err := wlm.Unlock("passphrase", time.Hour); err != nil {
+		t.Fatalf("second unlock failed: %v", err)
+	}
+	defer wlm.Lock()
+	if !bytes.Equal(firstKey, make([]byte, len(firstKey))) {
+		t.Error("key of the first unlock not wiped")
+	}
+
+	// the timer of the first unlock fired while the second one held the lock
+	wlm.lockIfGeneration(firstGeneration)
+	time.Sleep(50 * time.Millisecond)
+	if wlm.IsLocked() {
+		t.Fatal("first unlock timeout locked the second session")
+	}
+
+	wlm.cryptoLock.RLock()
+	key := wlm.encryptionKey
+	wlm.cryptoLock.RUnlock()
+	wlm.Lock()
+	if !wlm.IsLocked() {
+		t.Fatal("wallet not locked")
+	}
+	if !bytes.Equal(key, make([]byte, len(key))) {
+		t.Error("key not wiped on lock")
+	}
+}
+
+func TestUnlockTimeout(t *testing.T) {
+	wlm := newTestEncryptedWallet("passphrase")
+	if _, err := wlm.Unlock("wrong", time.Hour); err != ErrWrongPassphrase {
+		t.Fatalf("unlock with a wrong passphrase returned %v", err)
+	}
+	if _, err := wlm.Unlock("passphrase", 10*time.Millisecond); err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for !wlm.IsLocked() {
+		if time.Now().After(deadline) {
+			t.Fatal("wallet not locked after the timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
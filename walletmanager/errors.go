@@ -0,0 +1,20 @@
+package walletmanager
+
+import "errors"
+
+var (
+	ErrAccountNotFound  = errors.New("account not found")
+	ErrAccountExists    = errors.New("account already exists")
+	ErrInvalidKey       = errors.New("invalid key")
+	ErrCannotSign       = errors.New("account cannot sign transactions")
+	ErrWatchOnly        = errors.New("watch-only account cannot sign transactions")
+	ErrWalletLocked     = errors.New("wallet is locked")
+	ErrWalletEncrypted  = errors.New("wallet is already encrypted")
+	ErrNotEncrypted     = errors.New("wallet is not encrypted")
+	ErrWrongPassphrase  = errors.New("wrong passphrase")
+	ErrMasterSeedExists = errors.New("wallet already has a master seed")
+	ErrNoMasterSeed     = errors.New("wallet has no master seed")
+	ErrInvalidMnemonic  = errors.New("invalid mnemonic")
+	ErrContactNotFound  = errors.New("contact not found")
+	ErrContactExists    = errors.New("contact already exists")
+)
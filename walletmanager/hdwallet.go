@@ -0,0 +1,227 @@
+package walletmanager
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/incognitochain/go-incognito-sdk-v2/wallet"
+	"github.com/rs/zerolog/log"
+
+	"github.com/obsidianwallet/obsidian-wallet-node/database"
+)
+
+// masterSeed is the stored form of the wallet BIP39 seed. Only the encrypted
+// seed and the next derivation index are kept, derived accounts get their
+// private key from the seed when the wallet is unlocked.
+type masterSeed struct {
+	EncryptedSeed string
+	NextIndex     uint32
+}
+
+type DerivedAccount struct {
+	Pubkey string
+	Index  uint32
+}
+
+func (wlm *WalletManager) loadMasterSeed() error {
+	value, err := wlm.db.DB.Get([]byte{}, []byte(dbWalletSeedKey))
+	if err != nil {
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		return err
+	}
+	var seed masterSeed
+	if err := json.Unmarshal(value, &seed); err != nil {
+		return err
+	}
+	wlm.masterSeed = &seed
+	return nil
+}
+
+func (wlm *WalletManager) decryptMasterKey(key []byte) (*wallet.KeyWallet, error) {
+	if wlm.masterSeed == nil {
+		return nil, nil
+	}
+	seed, err := decryptData(key, wlm.masterSeed.EncryptedSeed, []byte(dbWalletSeedKey))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return wallet.NewMasterKeyFromSeed(seed)
+}
+
+func (wlm *WalletManager) HasMasterSeed() bool {
+	wlm.cryptoLock.RLock()
+	defer wlm.cryptoLock.RUnlock()
+	return wlm.masterSeed != nil
+}
+
+// CreateFromMnemonic sets the master seed of the wallet from mnemonic, or
+// from a newly generated one when mnemonic is empty, and derives the first
+// count accounts. Restoring a backup is done by passing the same mnemonic and
+// the number of accounts used before. The wallet must be encrypted and
+// unlocked so the seed never touches the disk in clear.
+//
+// Accounts are the children of the BIP39 master key at indices 1, 2, ...,
+// the derivation of the Incognito SDK and apps, so a mnemonic from the app
+// restores the same accounts. Index 0 is not used.
+func (wlm *WalletManager) CreateFromMnemonic(mnemonic string, name string, count uint32) (string, []DerivedAccount, error) {
+	if count == 0 {
+		count = 1
+	}
+	if count > maxDeriveAccounts {
+		return "", nil, fmt.Errorf("cannot derive more than %v accounts at once", maxDeriveAccounts)
+	}
+	wlm.cryptoLock.Lock()
+	defer wlm.cryptoLock.Unlock()
+	if wlm.cryptoParams == nil {
+		return "", nil, ErrNotEncrypted
+	}
+	if wlm.encryptionKey == nil {
+		return "", nil, ErrWalletLocked
+	}
+	if wlm.masterSeed != nil {
+		return "", nil, ErrMasterSeedExists
+	}
+
+	if mnemonic == "" {
+		var err error
+		mnemonic, err = wallet.NewMnemonic(mnemonicBitSize)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	seed, err := wallet.NewSeedFromMnemonic(mnemonic)
+	if err != nil {
+		return "", nil, ErrInvalidMnemonic
+	}
+	masterKey, err := wallet.NewMasterKeyFromSeed(seed)
+	if err != nil {
+		return "", nil, err
+	}
+	encryptedSeed, err := encryptData(wlm.encryptionKey, seed, []byte(dbWalletSeedKey))
+	if err != nil {
+		return "", nil, err
+	}
+
+	wlm.masterSeed = &masterSeed{EncryptedSeed: encryptedSeed, NextIndex: firstDerivationIndex}
+	wlm.masterKey = masterKey
+	var result []DerivedAccount
+	// persisted is set once the seed is stored, from then on it stays even
+	// if a later account fails
+	persisted := false
+	for i := uint32(0); i < count; i++ {
+		accountName := name
+		if count > 1 || accountName == "" {
+			accountName = derivedAccountName(name, wlm.masterSeed.NextIndex)
+		}
+		derived, err := wlm.deriveNextAccount(accountName, "")
+		if err == ErrAccountExists {
+			// already imported with its private key, the index is used anyway
+			persisted = true
+			continue
+		}
+		if err != nil {
+			if !persisted {
+				// nothing was written, leave the wallet without seed
+				wlm.masterSeed = nil
+				wipeKeyWallet(wlm.masterKey)
+				wlm.masterKey = nil
+			}
+			return "", result, err
+		}
+		persisted = true
+		result = append(result, *derived)
+	}
+	return mnemonic, result, nil
+}
+
+// DeriveNextAccount derives the account at the next index of the master seed.
+func (wlm *WalletManager) DeriveNextAccount(name string, note string) (*DerivedAccount, error) {
+	wlm.cryptoLock.Lock()
+	defer wlm.cryptoLock.Unlock()
+	if wlm.masterSeed == nil {
+		return nil, ErrNoMasterSeed
+	}
+	if wlm.masterKey == nil {
+		return nil, ErrWalletLocked
+	}
+	if name == "" {
+		name = derivedAccountName("", wlm.masterSeed.NextIndex)
+	}
+	return wlm.deriveNextAccount(name, note)
+}
+
+// deriveNextAccount adds the child account at the next index, the caller
+// holds cryptoLock. The account and the advanced index are written in a
+// single batch. The seed is also written when ErrAccountExists is returned,
+// no other error leaves anything written.
+func (wlm *WalletManager) deriveNextAccount(name string, note string) (*DerivedAccount, error) {
+	index := wlm.masterSeed.NextIndex
+	childKey, err := wlm.masterKey.DeriveChild(index)
+	if err != nil {
+		return nil, err
+	}
+	account := Account{
+		Name:            name,
+		Note:            note,
+		Type:            HDDerived,
+		PaymentAddress:  childKey.Base58CheckSerialize(wallet.PaymentAddressType),
+		OTAKey:          childKey.Base58CheckSerialize(wallet.OTAKeyType),
+		ViewKey:         childKey.Base58CheckSerialize(wallet.ReadonlyKeyType),
+		IsEncrypted:     true,
+		DerivationIndex: index,
+	}
+
+	seed := *wlm.masterSeed
+	seed.NextIndex = index + 1
+	seedBytes, err := json.Marshal(seed)
+	if err != nil {
+		return nil, err
+	}
+	objs := []database.Object{{Key: []byte(dbWalletSeedKey), Value: seedBytes}}
+
+	accPubkey, err := wlm.addAccount(account, nil)
+	if err == ErrAccountExists {
+		if err := wlm.db.DB.Set([]byte{}, objs); err != nil {
+			return nil, err
+		}
+		wlm.masterSeed = &seed
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	accRT := wlm.GetAccountInstance(accPubkey)
+	accRT.lock.Lock()
+	accRT.wlk = childKey
+	accRT.lock.Unlock()
+
+	accountBytes, err := json.Marshal(accRT.GetAccount())
+	if err != nil {
+		wlm.removeAccount(accPubkey)
+		return nil, err
+	}
+	objs = append(objs, database.Object{
+		Key:   buildAccountInfoKey("", accPubkey),
+		Value: accountBytes,
+	})
+	if err := wlm.db.DB.Set([]byte{}, objs); err != nil {
+		wlm.removeAccount(accPubkey)
+		return nil, err
+	}
+	wlm.masterSeed = &seed
+	if err := wlm.startAccount(accRT); err != nil {
+		// the account is stored with its index, it starts with the wallet
+		log.Error().Msgf("start derived account %v failed: %v", accPubkey, err)
+	}
+	return &DerivedAccount{Pubkey: accPubkey, Index: index}, nil
+}
+
+func derivedAccountName(prefix string, index uint32) string {
+	if prefix == "" {
+		prefix = "Account"
+	}
+	return fmt.Sprintf("%v %v", prefix, index)
+}
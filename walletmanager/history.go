@@ -0,0 +1,143 @@
+package walletmanager
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+
+	wcommon "github.com/obsidianwallet/obsidian-wallet-node/common"
+	"github.com/obsidianwallet/obsidian-wallet-node/database"
+)
+
+type HistoryDirection string
+
+const (
+	HistoryReceived HistoryDirection = "received"
+	HistorySpent    HistoryDirection = "spent"
+	HistorySent     HistoryDirection = "sent"
+)
+
+type HistoryEntry struct {
+	ID        string
+	Time      int64
+	Direction HistoryDirection
+	TokenID   string
+	Amount    uint64
+	// AmountHidden is set for coins received by a watch-only account
+	// without view key
+	AmountHidden bool         `json:",omitempty"`
+	Keyimage     string       `json:",omitempty"`
+	TxHash       string       `json:",omitempty"`
+	Receivers    []TxReceiver `json:",omitempty"`
+	Fee          uint64       `json:",omitempty"`
+	Memo         string       `json:",omitempty"`
+	// MetadataType is the type of the metadata of a sent transaction,
+	// e.g. a pDEX request
+	MetadataType int `json:",omitempty"`
+}
+
+type HistoryFilter struct {
+	TokenID   string
+	Direction HistoryDirection
+	Offset    int
+	Limit     int
+}
+
+// buildHistoryObjects returns the database objects of new history entries,
+// the caller must hold rtacc.lock.
+func (rtacc *RuntimeAccount) buildHistoryObjects(entries []HistoryEntry) ([]database.Object, error) {
+	var objs []database.Object
+	pubkey := rtacc.pubkey
+	for _, entry := range entries {
+		now := time.Now()
+		id, err := rtacc.wlm.db.DB.CreateULID(now)
+		if err != nil {
+			return nil, err
+		}
+		var entryID ulid.ULID
+		copy(entryID[:], id)
+		entry.ID = entryID.String()
+		entry.Time = now.Unix()
+		entryBytes, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		key := append([]byte(dbAccountHistoryPrefix), buildAccountHistoryKey(rtacc.currentNetwork.Name, pubkey)...)
+		objs = append(objs, database.Object{
+			Key:   append(key, id...),
+			Value: entryBytes,
+		})
+	}
+	return objs, nil
+}
+
+func (rtacc *RuntimeAccount) saveHistory(entries ...HistoryEntry) error {
+	rtacc.lock.RLock()
+	defer rtacc.lock.RUnlock()
+	objs, err := rtacc.buildHistoryObjects(entries)
+	if err != nil {
+		return err
+	}
+	return rtacc.wlm.db.DB.Set([]byte{}, objs)
+}
+
+func receivedHistory(coins []wcommon.CoinOwnerData) []HistoryEntry {
+	var entries []HistoryEntry
+	for _, coinData := range coins {
+		entries = append(entries, HistoryEntry{
+			Direction:    HistoryReceived,
+			TokenID:      coinData.TokenID,
+			Amount:       coinData.Value,
+			AmountHidden: coinData.AmountHidden,
+			Keyimage:     coinData.Keyimage,
+		})
+	}
+	return entries
+}
+
+// GetAccountHistory returns the history of the account on the current
+// network, newest first.
+func (wlm *WalletManager) GetAccountHistory(account string, filter HistoryFilter) ([]HistoryEntry, error) {
+	accRT := wlm.GetAccountInstance(account)
+	if accRT == nil {
+		return nil, ErrAccountNotFound
+	}
+	if filter.Limit <= 0 || filter.Limit > maxHistoryPageSize {
+		filter.Limit = maxHistoryPageSize
+	}
+	network := accRT.network().Name
+
+	result := []HistoryEntry{}
+	skipped := 0
+	prefix := append([]byte(dbAccountHistoryPrefix), buildAccountHistoryKey(network, account)...)
+	err := wlm.db.DB.ReadIteratorCopy(prefix, true, func(k []byte, v []byte) (bool, error) {
+		var entry HistoryEntry
+		if err := json.Unmarshal(v, &entry); err != nil {
+			return true, err
+		}
+		if filter.TokenID != "" && entry.TokenID != filter.TokenID {
+			return false, nil
+		}
+		if filter.Direction != "" && entry.Direction != filter.Direction {
+			return false, nil
+		}
+		if skipped < filter.Offset {
+			skipped++
+			return false, nil
+		}
+		result = append(result, entry)
+		return len(result) >= filter.Limit, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func buildAccountHistoryKey(networkName string, accountPubkey string) []byte {
+	key := []byte{}
+	key = append(key, []byte(networkName+"-")...)
+	key = append(key, []byte(accountPubkey+"-")...)
+	return key
+}
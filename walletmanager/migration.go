@@ -0,0 +1,152 @@
+package walletmanager
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/rs/zerolog/log"
+
+	"github.com/obsidianwallet/obsidian-wallet-node/database"
+)
+
+// migrateCoinSchema moves the coins and sync states stored with a previous
+// key layout to the current one when network is starting. The legacy layout
+// has no network in its keys, so the data is only migrated when network is
+// the confirmed legacyCoinNetwork. Otherwise it is left untouched and
+// network syncs its coins from scratch.
+func (wlm *WalletManager) migrateCoinSchema(network string) error {
+	version, err := wlm.getCoinSchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version >= coinSchemaVersion {
+		return nil
+	}
+	hasLegacy, err := wlm.hasLegacyCoinData()
+	if err != nil {
+		return err
+	}
+	if hasLegacy {
+		switch wlm.legacyCoinNetwork {
+		case "":
+			log.Warn().Msg("coins stored without a network are kept unmigrated, set LegacyCoinNetwork in config.json to the network they were synced on to migrate them")
+			return nil
+		case network:
+		default:
+			log.Info().Msgf("coins stored without a network are kept for network %v", wlm.legacyCoinNetwork)
+			return nil
+		}
+	}
+	log.Info().Msgf("migrating coin database from version %v to %v, legacy coins are moved to network %v", version, coinSchemaVersion, network)
+
+	var objs []database.Object
+	flush := func() error {
+		if len(objs) == 0 {
+			return nil
+		}
+		if err := wlm.db.DB.Set([]byte{}, objs); err != nil {
+			return err
+		}
+		objs = nil
+		return nil
+	}
+	var migrated int
+	err = wlm.db.DB.ReadIteratorCopy([]byte(dbLegacyCoinPrefix), false, func(k []byte, v []byte) (bool, error) {
+		key, err := migrateLegacyCoinKey(network, k[len(dbLegacyCoinPrefix):])
+		if err != nil {
+			return true, err
+		}
+		objs = append(objs, database.Object{Key: key, Value: v})
+		migrated++
+		if len(objs) >= coinMigrationBatchSize {
+			return false, flush()
+		}
+		return false, nil
+	})
+	if err != nil {
+		return err
+	}
+	err = wlm.db.DB.ReadIteratorCopy([]byte(dbLegacySyncStatePrefix), false, func(k []byte, v []byte) (bool, error) {
+		key := k[len(dbLegacySyncStatePrefix):]
+		if len(key) != 1 {
+			return true, fmt.Errorf("invalid legacy sync state key %x", k)
+		}
+		objs = append(objs, database.Object{Key: buildSyncStateKey(network, key[0]), Value: v})
+		return false, nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	if err := wlm.db.DB.DeleteNamespace([]byte(dbLegacyCoinPrefix)); err != nil {
+		return err
+	}
+	if err := wlm.db.DB.DeleteNamespace([]byte(dbLegacySyncStatePrefix)); err != nil {
+		return err
+	}
+	// written last so an interrupted migration runs again from the start
+	err = wlm.db.DB.Set([]byte{}, []database.Object{{
+		Key:   []byte(dbCoinSchemaKey),
+		Value: []byte(strconv.Itoa(coinSchemaVersion)),
+	}})
+	if err != nil {
+		return err
+	}
+	log.Info().Msgf("coin database migrated, %v keys moved", migrated)
+	return nil
+}
+
+// hasLegacyCoinData tells whether coins or sync states are stored with the
+// legacy key layout.
+func (wlm *WalletManager) hasLegacyCoinData() (bool, error) {
+	found := false
+	for _, prefix := range []string{dbLegacyCoinPrefix, dbLegacySyncStatePrefix} {
+		err := wlm.db.DB.ReadIteratorNonCopy([]byte(prefix), false, func(k []byte, v []byte) (bool, error) {
+			found = true
+			return true, nil
+		})
+		if err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
+}
+
+func (wlm *WalletManager) getCoinSchemaVersion() (int, error) {
+	value, err := wlm.db.DB.Get([]byte{}, []byte(dbCoinSchemaKey))
+	if err != nil {
+		if err == badger.ErrKeyNotFound {
+			return 0, nil
+		}
+		return 0, err
+	}
+	version, err := strconv.Atoi(string(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid coin schema version %q", value)
+	}
+	return version, nil
+}
+
+// migrateLegacyCoinKey converts a legacy coin key, without its prefix, to the
+// current layout. Legacy keys are either a coin pubkey or a shard byte, a
+// token ID and the minimal big-endian bytes of the coin index.
+func migrateLegacyCoinKey(network string, key []byte) ([]byte, error) {
+	if len(key) == coinPubkeySize {
+		return buildCoinDataKey(network, key), nil
+	}
+	if len(key) < 1+coinTokenIDSize {
+		return nil, fmt.Errorf("invalid legacy coin key %x", key)
+	}
+	idxBytes := key[1+coinTokenIDSize:]
+	if len(idxBytes) > 8 || bytes.HasPrefix(idxBytes, []byte{0}) {
+		return nil, fmt.Errorf("invalid legacy coin key %x", key)
+	}
+	idx := new(big.Int).SetBytes(idxBytes).Uint64()
+	return buildCoinIdxKey(network, key[0], string(key[1:1+coinTokenIDSize]), idx), nil
+}
@@ -0,0 +1,151 @@
+package walletmanager
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+
+	"github.com/obsidianwallet/obsidian-wallet-node/database"
+)
+
+func TestMigrateLegacyCoinKey(t *testing.T) {
+	tokenID := strings.Repeat("ab", coinTokenIDSize/2)
+	pubkey := bytes.Repeat([]byte{7}, coinPubkeySize)
+	legacyIdxKey := func(shardID byte, idx []byte) []byte {
+		return append(append([]byte{shardID}, tokenID...), idx...)
+	}
+	tests := []struct {
+		name    string
+		key     []byte
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name: "coin data",
+			key:  pubkey,
+			want: buildCoinDataKey("mainnet", pubkey),
+		},
+		{
+			name: "index 0",
+			key:  legacyIdxKey(1, nil),
+			want: buildCoinIdxKey("mainnet", 1, tokenID, 0),
+		},
+		{
+			name: "one byte index",
+			key:  legacyIdxKey(2, []byte{0xff}),
+			want: buildCoinIdxKey("mainnet", 2, tokenID, 255),
+		},
+		{
+			name: "multi byte index",
+			key:  legacyIdxKey(0, []byte{0x01, 0x00, 0x00}),
+			want: buildCoinIdxKey("mainnet", 0, tokenID, 65536),
+		},
+		{
+			name: "eight byte index",
+			key:  legacyIdxKey(0, bytes.Repeat([]byte{0xff}, 8)),
+			want: buildCoinIdxKey("mainnet", 0, tokenID, ^uint64(0)),
+		},
+		{
+			name:    "index longer than eight bytes",
+			key:     legacyIdxKey(0, bytes.Repeat([]byte{0x01}, 9)),
+			wantErr: true,
+		},
+		{
+			name:    "index with a leading zero",
+			key:     legacyIdxKey(0, []byte{0x00, 0x01}),
+			wantErr: true,
+		},
+		{
+			name:    "too short",
+			key:     []byte{1, 2, 3},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		got, err := migrateLegacyCoinKey("mainnet", tt.key)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%v: got key %x, want %x", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCoinIdxKeyOrder(t *testing.T) {
+	tokenID := strings.Repeat("ab", coinTokenIDSize/2)
+	indices := []uint64{0, 1, 255, 256, 65535, 65536, 1 << 40, ^uint64(0)}
+	for i := 1; i < len(indices); i++ {
+		prev := buildCoinIdxKey("mainnet", 0, tokenID, indices[i-1])
+		next := buildCoinIdxKey("mainnet", 0, tokenID, indices[i])
+		if bytes.Compare(prev, next) >= 0 {
+			t.Errorf("key of index %v does not sort before the key of %v", indices[i-1], indices[i])
+		}
+	}
+}
+
+func TestMigrateCoinSchema(t *testing.T) {
+	pubkey := bytes.Repeat([]byte{7}, coinPubkeySize)
+	legacy := []database.Object{
+		{Key: append([]byte(dbLegacyCoinPrefix), pubkey...), Value: []byte("coin")},
+		{Key: []byte(dbLegacySyncStatePrefix + "\x01"), Value: []byte("state")},
+	}
+	tests := []struct {
+		name         string
+		legacy       bool
+		confirmed    string
+		wantMigrated bool
+	}{
+		{name: "no legacy data", wantMigrated: true},
+		{name: "network not confirmed", legacy: true},
+		{name: "other network confirmed", legacy: true, confirmed: "testnet"},
+		{name: "network confirmed", legacy: true, confirmed: "mainnet", wantMigrated: true},
+	}
+	for _, tt := range tests {
+		db, err := database.NewBadgerDB(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		wlm := &WalletManager{db: &database.Database{DB: db}, legacyCoinNetwork: tt.confirmed}
+		if tt.legacy {
+			if err := db.Set([]byte{}, legacy); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := wlm.migrateCoinSchema("mainnet"); err != nil {
+			t.Errorf("%v: migration failed: %v", tt.name, err)
+		}
+
+		version, err := wlm.getCoinSchemaVersion()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if migrated := version == coinSchemaVersion; migrated != tt.wantMigrated {
+			t.Errorf("%v: schema version %v, want migrated %v", tt.name, version, tt.wantMigrated)
+		}
+		hasLegacy, err := wlm.hasLegacyCoinData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hasLegacy != (tt.legacy && !tt.wantMigrated) {
+			t.Errorf("%v: legacy data kept %v", tt.name, hasLegacy)
+		}
+		if tt.legacy && tt.wantMigrated {
+			value, err := db.Get([]byte{}, buildCoinDataKey("mainnet", pubkey))
+			if err != nil || string(value) != "coin" {
+				t.Errorf("%v: migrated coin %q, error %v", tt.name, value, err)
+			}
+			value, err = db.Get([]byte{}, buildSyncStateKey("mainnet", 1))
+			if err != nil || string(value) != "state" {
+				t.Errorf("%v: migrated sync state %q, error %v", tt.name, value, err)
+			}
+		}
+		if _, err := db.Get([]byte{}, buildCoinDataKey("testnet", pubkey)); err != badger.ErrKeyNotFound {
+			t.Errorf("%v: coin migrated to another network, error %v", tt.name, err)
+		}
+		db.Close()
+	}
+}
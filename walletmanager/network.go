@@ -1,68 +1,170 @@
 package walletmanager
 
 import (
-	"time"
+	"context"
+	"errors"
 
 	"github.com/incognitochain/go-incognito-sdk-v2/incclient"
 	"github.com/obsidianwallet/obsidian-wallet-node/common"
 )
 
+// Stop cancels the coin sync and the account workers and returns once they
+// all exited.
 func (wlm *WalletManager) Stop() error {
+	wlm.lifecycleLock.Lock()
+	defer wlm.lifecycleLock.Unlock()
+	wlm.stop()
 	return nil
 }
-func (wlm *WalletManager) Start() error {
+
+func (wlm *WalletManager) stop() {
+	wlm.runLock.Lock()
+	cancel := wlm.cancel
+	wlm.runCtx, wlm.cancel = nil, nil
+	wlm.runLock.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	wlm.getCoinSyncManager().stop()
+	for _, accountRT := range wlm.ListAccountInstances() {
+		accountRT.stop()
+	}
+}
+
+// Start runs the coin sync of the account shards and the account workers
+// until Stop is called or ctx is cancelled. When a part fails to start, the
+// ones already started are stopped and the wallet is left stopped.
+func (wlm *WalletManager) Start(ctx context.Context) error {
+	wlm.lifecycleLock.Lock()
+	defer wlm.lifecycleLock.Unlock()
+	wlm.runLock.Lock()
+	if wlm.cancel != nil {
+		wlm.runLock.Unlock()
+		return nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	wlm.runCtx, wlm.cancel = ctx, cancel
+	wlm.runLock.Unlock()
+
+	if err := wlm.getCoinSyncManager().StartSyncCoinsProcess(ctx); err != nil {
+		wlm.stop()
+		return err
+	}
+	for _, accountRT := range wlm.ListAccountInstances() {
+		if err := accountRT.start(ctx); err != nil {
+			wlm.stop()
+			return err
+		}
+	}
+	wlm.updateSyncShards()
 	return nil
 }
 
-func (wlm *WalletManager) SwitchNetwork(networkParam common.NetworkID, incclient *incclient.IncClient) error {
-	wlm.networkLock.Lock()
-	defer wlm.networkLock.Unlock()
-	// stop sync coins
-	wlm.coinsyncmng.stop()
+// startAccount starts the workers of a new account when the wallet is
+// running, otherwise they start with the wallet.
+func (wlm *WalletManager) startAccount(accRT *RuntimeAccount) error {
+	wlm.runLock.Lock()
+	ctx := wlm.runCtx
+	wlm.runLock.Unlock()
+	if ctx == nil {
+		return nil
+	}
+	if err := accRT.start(ctx); err != nil {
+		return err
+	}
+	wlm.updateSyncShards()
+	return nil
+}
 
-	// stop scan coins
-	for _, accountRT := range wlm.accounts {
-		accountRT.stop()
+// SetClient replaces the chain client, the syncing and scanning in progress
+// use the new one from their next request.
+func (wlm *WalletManager) SetClient(incclient *incclient.IncClient) error {
+	wlm.clientLock.Lock()
+	defer wlm.clientLock.Unlock()
+	wlm.incclient = incclient
+	return nil
+}
+
+func (wlm *WalletManager) getClient() *incclient.IncClient {
+	wlm.clientLock.RLock()
+	defer wlm.clientLock.RUnlock()
+	return wlm.incclient
+}
+
+// SetRPCErrorHandler sets the function told about the chain calls that
+// failed, with the client they were made with.
+func (wlm *WalletManager) SetRPCErrorHandler(handler func(client *incclient.IncClient, err error)) {
+	wlm.clientLock.Lock()
+	defer wlm.clientLock.Unlock()
+	wlm.rpcErrorHandler = handler
+}
+
+func (wlm *WalletManager) reportRPCError(client *incclient.IncClient, err error) {
+	wlm.clientLock.RLock()
+	handler := wlm.rpcErrorHandler
+	wlm.clientLock.RUnlock()
+	if handler != nil {
+		handler(client, err)
+	}
+}
+
+// SwitchNetwork moves the wallet to networkParam, it must be stopped.
+func (wlm *WalletManager) SwitchNetwork(networkParam common.NetworkID, incclient *incclient.IncClient) error {
+	wlm.lifecycleLock.Lock()
+	defer wlm.lifecycleLock.Unlock()
+	wlm.runLock.Lock()
+	running := wlm.cancel != nil
+	wlm.runLock.Unlock()
+	if running {
+		return errors.New("wallet must be stopped to switch network")
 	}
 
 	//re-initialized coinsyncmng
 	coinSyncMng := CoinSyncManager{
 		currentNetwork:   networkParam,
 		wlm:              wlm,
-		currentSyncShard: make(map[int]bool),
+		syncingShards:    make(map[int]*shardSyncWorker),
+		downloadStats:    make(map[int]*coinDownloadStats),
 		currentSyncState: make(map[int]map[string]uint64),
 		chainCoinState:   make(map[int]map[string]uint64),
-		stopCh:           make(chan struct{}),
 	}
+	wlm.networkLock.Lock()
 	wlm.coinsyncmng = &coinSyncMng
+	wlm.currentNetwork = networkParam
+	wlm.networkLock.Unlock()
+	wlm.clientLock.Lock()
+	wlm.incclient = incclient
+	wlm.clientLock.Unlock()
 
-	//re-initialized account
-	for _, accountRT := range wlm.accounts {
-		err := accountRT.start()
-		if err != nil {
-			return err
-		}
-	}
-
+	wlm.assetTagsLock.Lock()
+	wlm.assetTags = nil
+	wlm.assetTagsLock.Unlock()
 	return nil
 }
 
+// stop cancels the shard syncs and returns once they exited.
 func (csm *CoinSyncManager) stop() {
-	close(csm.stopCh)
-	for {
-		isStopped := true
-		for _, v := range csm.currentSyncShard {
-			if v {
-				isStopped = false
-			}
-		}
-		if isStopped {
-			break
-		}
-		time.Sleep(time.Second)
+	csm.lock.Lock()
+	for _, worker := range csm.syncingShards {
+		worker.cancel()
+		worker.stopping = true
 	}
+	csm.ctx = nil
+	csm.lock.Unlock()
+	csm.workers.Wait()
 }
 
 func (wlm *WalletManager) GetCurrentNetwork() common.NetworkID {
+	wlm.networkLock.RLock()
+	defer wlm.networkLock.RUnlock()
 	return wlm.currentNetwork
 }
+
+// getCoinSyncManager returns the coin sync of the current network, it is
+// replaced by SwitchNetwork.
+func (wlm *WalletManager) getCoinSyncManager() *CoinSyncManager {
+	wlm.networkLock.RLock()
+	defer wlm.networkLock.RUnlock()
+	return wlm.coinsyncmng
+}
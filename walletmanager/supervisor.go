@@ -0,0 +1,134 @@
+package walletmanager
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// supervisor runs the background workers of the wallet. A failing worker is
+// restarted with exponential backoff instead of taking the node down, and
+// its health is kept for the API.
+type supervisor struct {
+	lock    sync.RWMutex
+	workers map[string]*WorkerHealth
+}
+
+// WorkerHealth is the state of a background worker. Restarts counts the
+// runs retried after a failure and LastError is the error of the last
+// failed one, Healthy tells whether the latest run succeeded.
+type WorkerHealth struct {
+	Name          string
+	Healthy       bool
+	Restarts      int
+	LastError     string `json:",omitempty"`
+	LastErrorTime int64  `json:",omitempty"`
+	LastSuccess   int64  `json:",omitempty"`
+	NextRetry     int64  `json:",omitempty"`
+}
+
+func newSupervisor() *supervisor {
+	return &supervisor{workers: make(map[string]*WorkerHealth)}
+}
+
+// run calls step every interval until ctx is cancelled. After a failure
+// step is retried with a backoff doubling from workerMinBackoff up to
+// workerMaxBackoff. A panic in step is recovered as a failure.
+func (sv *supervisor) run(ctx context.Context, name string, interval time.Duration, step func() error) {
+	sv.lock.Lock()
+	sv.workers[name] = &WorkerHealth{Name: name, Healthy: true}
+	sv.lock.Unlock()
+	defer func() {
+		sv.lock.Lock()
+		delete(sv.workers, name)
+		sv.lock.Unlock()
+	}()
+
+	failures := 0
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		wait := interval
+		if err := runStep(step); err != nil {
+			failures++
+			wait = workerBackoff(failures)
+			log.Error().Msgf("worker %v failed, retrying in %v: %v", name, wait, err)
+			sv.recordFailure(name, err, wait)
+		} else {
+			failures = 0
+			sv.recordSuccess(name)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func runStep(step func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return step()
+}
+
+func workerBackoff(failures int) time.Duration {
+	backoff := workerMinBackoff
+	for i := 1; i < failures && backoff < workerMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > workerMaxBackoff {
+		backoff = workerMaxBackoff
+	}
+	return backoff
+}
+
+func (sv *supervisor) recordFailure(name string, err error, wait time.Duration) {
+	sv.lock.Lock()
+	defer sv.lock.Unlock()
+	health, ok := sv.workers[name]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	health.Healthy = false
+	health.Restarts++
+	health.LastError = err.Error()
+	health.LastErrorTime = now.Unix()
+	health.NextRetry = now.Add(wait).Unix()
+}
+
+func (sv *supervisor) recordSuccess(name string) {
+	sv.lock.Lock()
+	defer sv.lock.Unlock()
+	health, ok := sv.workers[name]
+	if !ok {
+		return
+	}
+	health.Healthy = true
+	health.NextRetry = 0
+	health.LastSuccess = time.Now().Unix()
+}
+
+// GetWorkersHealth returns the state of the running background workers by
+// name.
+func (wlm *WalletManager) GetWorkersHealth() []WorkerHealth {
+	wlm.supervisor.lock.RLock()
+	defer wlm.supervisor.lock.RUnlock()
+	result := []WorkerHealth{}
+	for _, health := range wlm.supervisor.workers {
+		result = append(result, *health)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
@@ -0,0 +1,35 @@
+package walletmanager
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWorkerBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, workerMinBackoff},
+		{1, workerMinBackoff},
+		{2, 2 * workerMinBackoff},
+		{3, 4 * workerMinBackoff},
+		{9, 256 * workerMinBackoff},
+		{10, workerMaxBackoff},
+		{1000, workerMaxBackoff},
+	}
+	for _, tt := range tests {
+		if got := workerBackoff(tt.failures); got != tt.want {
+			t.Errorf("workerBackoff(%v) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestRunStepRecoversPanic(t *testing.T) {
+	err := runStep(func() error {
+		panic("boom")
+	})
+	if err == nil || err.Error() != "panic: boom" {
+		t.Errorf("got error %v, want the panic", err)
+	}
+}
@@ -0,0 +1,387 @@
+package walletmanager
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/incognitochain/go-incognito-sdk-v2/coin"
+	"github.com/incognitochain/go-incognito-sdk-v2/common"
+	"github.com/incognitochain/go-incognito-sdk-v2/common/base58"
+	"github.com/incognitochain/go-incognito-sdk-v2/crypto"
+	"github.com/incognitochain/go-incognito-sdk-v2/incclient"
+	"github.com/incognitochain/go-incognito-sdk-v2/key"
+	"github.com/incognitochain/go-incognito-sdk-v2/metadata"
+	"github.com/incognitochain/go-incognito-sdk-v2/privacy"
+	"github.com/incognitochain/go-incognito-sdk-v2/rpchandler"
+	"github.com/incognitochain/go-incognito-sdk-v2/rpchandler/jsonresult"
+	"github.com/incognitochain/go-incognito-sdk-v2/transaction/tx_generic"
+	"github.com/incognitochain/go-incognito-sdk-v2/transaction/tx_ver2"
+	"github.com/incognitochain/go-incognito-sdk-v2/transaction/utils"
+	"github.com/incognitochain/go-incognito-sdk-v2/wallet"
+	wcommon "github.com/obsidianwallet/obsidian-wallet-node/common"
+	"github.com/rs/zerolog/log"
+)
+
+type TxReceiver struct {
+	PaymentAddress string
+	// Contact is the name of an address book contact, used when
+	// PaymentAddress is empty
+	Contact string `json:",omitempty"`
+	Amount  uint64
+}
+
+type TxParam struct {
+	TokenID   string
+	Receivers []TxReceiver
+	// PRVReceivers are the PRV outputs of a token transaction, e.g. PRV
+	// burnt along with the token for a pDEX fee
+	PRVReceivers []TxReceiver
+	Fee          uint64
+	Memo         string
+	Metadata     metadata.Metadata
+}
+
+// CreateAndSendTransaction builds a PRV or token transfer from the coins
+// indexed locally for the account, signs it and broadcasts it. The chosen
+// coins are marked pending until the chain reports them spent so concurrent
+// sends never pick the same inputs.
+func (rtacc *RuntimeAccount) CreateAndSendTransaction(param TxParam) (string, error) {
+	wlk, err := rtacc.signingKeyWallet()
+	if err != nil {
+		return "", err
+	}
+	if param.TokenID == "" {
+		param.TokenID = common.PRVIDStr
+	}
+	if _, err := new(common.Hash).NewHashFromStr(param.TokenID); err != nil {
+		return "", fmt.Errorf("invalid token id %v: %v", param.TokenID, err)
+	}
+	if param.Fee == 0 {
+		param.Fee = incclient.DefaultPRVFee
+	}
+	if param.Fee < incclient.DefaultPRVFee {
+		return "", fmt.Errorf("fee must be at least %v", incclient.DefaultPRVFee)
+	}
+	if len(param.Memo) > maxTxMemoSize {
+		return "", fmt.Errorf("memo must be at most %v bytes", maxTxMemoSize)
+	}
+	if len(param.Receivers) == 0 || len(param.Receivers) > incclient.MaxOutputSize {
+		return "", fmt.Errorf("number of receivers must be between 1 and %v", incclient.MaxOutputSize)
+	}
+
+	param.Receivers, err = rtacc.wlm.resolveReceivers(param.Receivers)
+	if err != nil {
+		return "", err
+	}
+
+	isPRV := param.TokenID == common.PRVIDStr
+	receivers, totalAmount, err := buildPaymentInfos(param.Receivers)
+	if err != nil {
+		return "", err
+	}
+	if isPRV && len(param.PRVReceivers) > 0 {
+		return "", errors.New("PRV receivers are only used by token transactions")
+	}
+	prvReceivers, prvTotal, err := buildPaymentInfos(param.PRVReceivers)
+	if err != nil {
+		return "", err
+	}
+
+	prvAmount := param.Fee + prvTotal
+	if isPRV {
+		prvAmount += totalAmount
+	}
+	prvCoins, err := rtacc.reserveCoins(common.PRVIDStr, prvAmount)
+	if err != nil {
+		return "", err
+	}
+	reserved := prvCoins
+	var tokenCoins []wcommon.CoinOwnerData
+	if !isPRV {
+		tokenCoins, err = rtacc.reserveCoins(param.TokenID, totalAmount)
+		if err != nil {
+			rtacc.releaseCoins(reserved)
+			return "", err
+		}
+		reserved = append(reserved, tokenCoins...)
+	}
+
+	txHash, err := rtacc.buildAndSendTx(wlk, param, receivers, prvReceivers, totalAmount, prvCoins, tokenCoins)
+	if err != nil {
+		rtacc.releaseCoins(reserved)
+		return "", err
+	}
+	entry := HistoryEntry{
+		Direction: HistorySent,
+		TokenID:   param.TokenID,
+		Amount:    totalAmount,
+		TxHash:    txHash,
+		Receivers: param.Receivers,
+		Fee:       param.Fee,
+		Memo:      param.Memo,
+	}
+	if param.Metadata != nil {
+		entry.MetadataType = param.Metadata.GetType()
+	}
+	err = rtacc.saveHistory(entry)
+	if err != nil {
+		log.Error().Msgf("save history of tx %v failed: %v", txHash, err)
+	}
+	return txHash, nil
+}
+
+func (rtacc *RuntimeAccount) buildAndSendTx(wlk *wallet.KeyWallet, param TxParam, receivers []*key.PaymentInfo, prvReceivers []*key.PaymentInfo, totalAmount uint64, prvCoins, tokenCoins []wcommon.CoinOwnerData) (string, error) {
+	shardID := byte(rtacc.shardID)
+	privateKey := &wlk.KeySet.PrivateKey
+
+	prvInputs, prvIndices, err := rtacc.decryptCoins(wlk, prvCoins)
+	if err != nil {
+		return "", err
+	}
+	prvKvArgs, err := rtacc.getRandomCommitments(shardID, common.PRVIDStr, len(prvInputs)*(privacy.RingSize-1))
+	if err != nil {
+		return "", err
+	}
+	prvKvArgs[utils.MyIndices] = prvIndices
+
+	if param.TokenID == common.PRVIDStr {
+		txParam := tx_generic.NewTxPrivacyInitParams(privateKey, receivers, prvInputs, param.Fee, true, &common.PRVCoinID, param.Metadata, []byte(param.Memo), prvKvArgs)
+		tx := new(tx_ver2.Tx)
+		if err := tx.Init(txParam); err != nil {
+			return "", fmt.Errorf("init txver2 error: %v", err)
+		}
+		encodedTx, err := encodeTx(tx)
+		if err != nil {
+			return "", err
+		}
+		if err := rtacc.wlm.getClient().SendRawTx(encodedTx); err != nil {
+			return "", err
+		}
+		return tx.Hash().String(), nil
+	}
+
+	tokenInputs, tokenIndices, err := rtacc.decryptCoins(wlk, tokenCoins)
+	if err != nil {
+		return "", err
+	}
+	tokenKvArgs, err := rtacc.getRandomCommitments(shardID, param.TokenID, len(tokenInputs)*(privacy.RingSize-1))
+	if err != nil {
+		return "", err
+	}
+	tokenKvArgs[utils.MyIndices] = tokenIndices
+
+	tokenParam := tx_generic.NewTokenParam(param.TokenID, "", "", totalAmount, utils.CustomTokenTransfer, receivers, tokenInputs, false, 0, tokenKvArgs)
+	if prvReceivers == nil {
+		prvReceivers = []*key.PaymentInfo{}
+	}
+	txTokenParam := tx_generic.NewTxTokenParams(privateKey, prvReceivers, prvInputs, param.Fee, tokenParam, param.Metadata, true, true, shardID, []byte(param.Memo), prvKvArgs)
+	tx := new(tx_ver2.TxToken)
+	if err := tx.Init(txTokenParam); err != nil {
+		return "", fmt.Errorf("init txtokenver2 error: %v", err)
+	}
+	encodedTx, err := encodeTx(tx)
+	if err != nil {
+		return "", err
+	}
+	if err := rtacc.wlm.getClient().SendRawTokenTx(encodedTx); err != nil {
+		return "", err
+	}
+	return tx.Hash().String(), nil
+}
+
+// signingKeyWallet returns the key wallet of the account if it holds the
+// private key.
+func (rtacc *RuntimeAccount) signingKeyWallet() (*wallet.KeyWallet, error) {
+	if rtacc.GetAccount().Type == WatchOnly {
+		return nil, ErrWatchOnly
+	}
+	wlk := rtacc.keyWallet()
+	if len(wlk.KeySet.PrivateKey) > 0 {
+		return wlk, nil
+	}
+	rtacc.lock.RLock()
+	defer rtacc.lock.RUnlock()
+	if rtacc.account.IsEncrypted {
+		return nil, ErrWalletLocked
+	}
+	return nil, ErrCannotSign
+}
+
+// reserveCoins picks unspent, non-pending coins of tokenID covering amount,
+// largest first, and marks them pending.
+func (rtacc *RuntimeAccount) reserveCoins(tokenID string, amount uint64) ([]wcommon.CoinOwnerData, error) {
+	rtacc.lock.Lock()
+	defer rtacc.lock.Unlock()
+	ownedCoins, err := rtacc.getOwnedCoins()
+	if err != nil {
+		return nil, err
+	}
+	var candidates []wcommon.CoinOwnerData
+	for _, coinData := range ownedCoins {
+		if coinData.TokenID != tokenID {
+			continue
+		}
+		if _, pending := rtacc.coinstate.PendingKeyimages[coinData.Keyimage]; pending {
+			continue
+		}
+		candidates = append(candidates, coinData)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Value > candidates[j].Value
+	})
+
+	var result []wcommon.CoinOwnerData
+	total := uint64(0)
+	for _, coinData := range candidates {
+		if total >= amount {
+			break
+		}
+		if len(result) == incclient.MaxInputSize {
+			return nil, fmt.Errorf("amount of %v requires more than %v input coins", tokenID, incclient.MaxInputSize)
+		}
+		result = append(result, coinData)
+		total += coinData.Value
+	}
+	if total < amount {
+		return nil, fmt.Errorf("insufficient balance of %v: have %v, need %v", tokenID, total, amount)
+	}
+
+	now := time.Now().Unix()
+	for _, coinData := range result {
+		rtacc.coinstate.PendingKeyimages[coinData.Keyimage] = now
+	}
+	if err := rtacc.storeCoinState(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (rtacc *RuntimeAccount) releaseCoins(coins []wcommon.CoinOwnerData) {
+	rtacc.lock.Lock()
+	defer rtacc.lock.Unlock()
+	for _, coinData := range coins {
+		delete(rtacc.coinstate.PendingKeyimages, coinData.Keyimage)
+	}
+	if err := rtacc.storeCoinState(); err != nil {
+		log.Error().Msgf("release coins of %v failed: %v", rtacc.pubkey, err)
+	}
+}
+
+// decryptCoins loads the raw coins from the local coin database and decrypts
+// them into spendable plain coins along with their on-chain indices.
+func (rtacc *RuntimeAccount) decryptCoins(wlk *wallet.KeyWallet, coins []wcommon.CoinOwnerData) ([]coin.PlainCoin, []uint64, error) {
+	var pubkeys [][]byte
+	var indices []uint64
+	for _, coinData := range coins {
+		pubkey, err := hex.DecodeString(coinData.Pubkey)
+		if err != nil {
+			return nil, nil, err
+		}
+		pubkeys = append(pubkeys, pubkey)
+		indices = append(indices, coinData.Index)
+	}
+	coinList, err := rtacc.wlm.getCoinSyncManager().GetCoinByPubkey(pubkeys)
+	if err != nil {
+		return nil, nil, err
+	}
+	var result []coin.PlainCoin
+	for idx := range coinList {
+		plainCoin, err := coinList[idx].Decrypt(&wlk.KeySet)
+		if err != nil {
+			return nil, nil, err
+		}
+		result = append(result, plainCoin)
+	}
+	return result, indices, nil
+}
+
+func (rtacc *RuntimeAccount) getRandomCommitments(shardID byte, tokenID string, lenDecoy int) (map[string]interface{}, error) {
+	if lenDecoy == 0 {
+		return nil, errors.New("no input coin to retrieve random commitments")
+	}
+	client := rtacc.wlm.getClient()
+	responseInBytes, err := client.NewRPCCall("1.0", "randomcommitmentsandpublickeys", []interface{}{shardID, lenDecoy, tokenID}, 1)
+	if err != nil {
+		rtacc.wlm.reportRPCError(client, err)
+		return nil, err
+	}
+	var randomCmtAndPk jsonresult.RandomCommitmentAndPublicKeyResult
+	if err := rpchandler.ParseResponse(responseInBytes, &randomCmtAndPk); err != nil {
+		return nil, err
+	}
+
+	commitments, err := decodePointList(randomCmtAndPk.Commitments)
+	if err != nil {
+		return nil, err
+	}
+	publicKeys, err := decodePointList(randomCmtAndPk.PublicKeys)
+	if err != nil {
+		return nil, err
+	}
+	assetTags, err := decodePointList(randomCmtAndPk.AssetTags)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]interface{})
+	result[utils.CommitmentIndices] = randomCmtAndPk.CommitmentIndices
+	result[utils.Commitments] = commitments
+	result[utils.PublicKeys] = publicKeys
+	result[utils.AssetTags] = assetTags
+	return result, nil
+}
+
+func buildPaymentInfos(receivers []TxReceiver) ([]*key.PaymentInfo, uint64, error) {
+	var result []*key.PaymentInfo
+	total := uint64(0)
+	for _, receiver := range receivers {
+		if receiver.Amount == 0 {
+			return nil, 0, fmt.Errorf("amount for %v must be greater than 0", receiver.PaymentAddress)
+		}
+		receiverWallet, err := wallet.Base58CheckDeserialize(receiver.PaymentAddress)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid payment address %v: %v", receiver.PaymentAddress, err)
+		}
+		if len(receiverWallet.KeySet.PaymentAddress.Pk) == 0 {
+			return nil, 0, fmt.Errorf("invalid payment address %v", receiver.PaymentAddress)
+		}
+		if total+receiver.Amount < total {
+			return nil, 0, errors.New("total amount overflows")
+		}
+		total += receiver.Amount
+		result = append(result, &key.PaymentInfo{
+			PaymentAddress: receiverWallet.KeySet.PaymentAddress,
+			Amount:         receiver.Amount,
+			Message:        []byte{},
+		})
+	}
+	return result, total, nil
+}
+
+func decodePointList(list []string) ([]*crypto.Point, error) {
+	result := make([]*crypto.Point, 0)
+	for _, pointStr := range list {
+		pointBytes, _, err := base58.Base58Check{}.Decode(pointStr)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode %v: %v", pointStr, err)
+		}
+		point, err := new(crypto.Point).FromBytesS(pointBytes)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %v: %v", pointStr, err)
+		}
+		result = append(result, point)
+	}
+	return result, nil
+}
+
+func encodeTx(tx interface{}) ([]byte, error) {
+	txBytes, err := json.Marshal(tx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal tx: %v", err)
+	}
+	return []byte(base58.Base58Check{}.Encode(txBytes, common.ZeroByte)), nil
+}
@@ -1,25 +1,61 @@
 package walletmanager
 
 import (
+	"context"
 	"sync"
 	"time"
 
+	incCommon "github.com/incognitochain/go-incognito-sdk-v2/common"
 	"github.com/incognitochain/go-incognito-sdk-v2/incclient"
+	"github.com/incognitochain/go-incognito-sdk-v2/rpchandler/jsonresult"
 	"github.com/incognitochain/go-incognito-sdk-v2/wallet"
 	"github.com/obsidianwallet/obsidian-wallet-node/common"
 	"github.com/obsidianwallet/obsidian-wallet-node/database"
 )
 
 type WalletManager struct {
+	// lifecycleLock serializes Start, Stop and SwitchNetwork
+	lifecycleLock sync.Mutex
+	// networkLock guards currentNetwork and coinsyncmng, read them with
+	// GetCurrentNetwork and getCoinSyncManager
 	networkLock    sync.RWMutex
 	currentNetwork common.NetworkID
-	incclient      *incclient.IncClient
 	db             *database.Database
 
+	clientLock sync.RWMutex
+	incclient  *incclient.IncClient
+	// rpcErrorHandler is told about the failed chain calls
+	rpcErrorHandler func(client *incclient.IncClient, err error)
+
 	lock     sync.RWMutex
 	accounts map[string]*RuntimeAccount
 
 	coinsyncmng *CoinSyncManager
+
+	assetTagsLock sync.RWMutex
+	assetTags     map[string]*incCommon.Hash
+	extraTokenIDs map[string]*incCommon.Hash
+
+	cryptoLock    sync.RWMutex
+	cryptoParams  *walletCryptoParams
+	encryptionKey []byte
+	relockTimer   *time.Timer
+	// unlockGeneration numbers the unlock sessions, see lockIfGeneration
+	unlockGeneration uint64
+	masterSeed       *masterSeed
+	masterKey        *wallet.KeyWallet
+
+	contactLock sync.Mutex
+
+	supervisor *supervisor
+	// legacyCoinNetwork is the network the coins stored before the current
+	// coin schema are migrated to, empty when not confirmed
+	legacyCoinNetwork string
+
+	// runLock guards runCtx and cancel, set while the wallet is started
+	runLock sync.Mutex
+	runCtx  context.Context
+	cancel  context.CancelFunc
 }
 
 type AccountType int
@@ -27,6 +63,7 @@ type AccountType int
 const (
 	Masterless AccountType = iota
 	WatchOnly
+	HDDerived
 )
 
 type Account struct {
@@ -39,43 +76,121 @@ type Account struct {
 	ViewKey        string
 	IsEncrypted    bool
 	WatchTokens    map[string]struct{}
+	// DerivationIndex is the child index of HDDerived accounts
+	DerivationIndex uint32
 }
 
 type RuntimeAccount struct {
 	account Account
+	pubkey  string
+	shardID int
 	wlk     *wallet.KeyWallet
 
-	lock      sync.RWMutex
-	coinstate AccountCoinState
-
+	// lock guards coinstate and currentNetwork, read currentNetwork with
+	// network() when not holding it
+	lock           sync.RWMutex
+	coinstate      AccountCoinState
 	currentNetwork common.NetworkID
 
-	wlm       *WalletManager
-	stopCh    chan struct{}
-	isStopped bool
+	wlm *WalletManager
+	// runLock guards cancel, set while the workers run
+	runLock sync.Mutex
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
 }
 
+// AccountCoinState is the per-network scan progress and UTXO key images of an
+// account. ScannedCoinIndex maps a coin stream (PRV or confidential asset) to
+// the next coin index to scan. PendingKeyimages holds the key images used by
+// locally sent transactions that the chain has not reported spent yet, with
+// the unix time they were picked. Unresolved are the owned coins, by coin
+// pubkey, found while the private key was unavailable, so their key images are
+// not known yet and whether they are spent cannot be checked.
 type AccountCoinState struct {
-	scannedCoinIndex map[string]uint64
+	ScannedCoinIndex map[string]uint64
 	PRVUTXOList      []string
 	TokenUTXOList    map[string][]string
+	PendingKeyimages map[string]int64
+	Unresolved       map[string]common.CoinOwnerData
+	// UnresolvedCoins is the list Unresolved was stored as before, it is
+	// moved to Unresolved when the state is loaded
+	UnresolvedCoins []common.CoinOwnerData `json:",omitempty"`
+}
+
+// shardSyncWorker is the coin download of a shard. done is closed once the
+// worker exited.
+type shardSyncWorker struct {
+	cancel   context.CancelFunc
+	done     chan struct{}
+	stopping bool
 }
 
 type CoinSyncManager struct {
 	currentNetwork common.NetworkID
 	wlm            *WalletManager
 
-	currentSyncShard     map[int]bool
+	// ctx is the context of the running process, nil when stopped
+	ctx context.Context
+	// syncingShards holds the worker of every shard being synced or
+	// stopping, a worker removes itself once it exited
+	syncingShards        map[int]*shardSyncWorker
 	currentSyncState     map[int]map[string]uint64
 	chainCoinState       map[int]map[string]uint64
 	lastChainStateUpdate time.Time
+	downloadStats        map[int]*coinDownloadStats
 	lock                 sync.RWMutex
 
-	stopCh chan struct{}
+	workers sync.WaitGroup
+}
+
+// ShardSyncStatus is the coin download progress of a shard, per coin stream
+// the local index is the number of coins stored and the chain index the
+// number of coins on chain.
+type ShardSyncStatus struct {
+	ShardID  int
+	Syncing  bool
+	Accounts int
+	Synced   bool
+	Tokens   []TokenSyncStatus
+	Download *CoinDownloadMetrics `json:",omitempty"`
+}
+
+// CoinDownloadMetrics are the coin download counters of a shard since the
+// node started. ChunkSize is the number of coins asked per request, it
+// shrinks when the RPC fails.
+type CoinDownloadMetrics struct {
+	ChunkSize       uint64
+	CoinsDownloaded uint64
+	CoinsPerSecond  float64
+	Requests        uint64
+	RequestErrors   uint64
+}
+
+type coinDownloadStats struct {
+	CoinDownloadMetrics
+	windowStart time.Time
+	windowCoins uint64
+}
+
+// coinChunk is a range of coins being fetched, done is closed once coins or
+// err is set.
+type coinChunk struct {
+	start uint64
+	end   uint64
+	coins map[uint64]jsonresult.ICoinInfo
+	err   error
+	done  chan struct{}
+}
+
+type TokenSyncStatus struct {
+	TokenID    string
+	LocalIndex uint64
+	ChainIndex uint64
 }
 
 type Contact struct {
 	Name    string
 	Address string
 	Note    string
+	ShardID int
 }
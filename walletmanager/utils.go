@@ -1,7 +1,11 @@
 package walletmanager
 
 import (
-	"math/big"
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/incognitochain/go-incognito-sdk-v2/wallet"
 )
 
 func getAddressShardID(pubkey []byte, totalShard int) int {
@@ -12,33 +16,93 @@ func getAddressShardID(pubkey []byte, totalShard int) int {
 
 func buildCoinIdxList(from uint64, to uint64) []uint64 {
 	var idxList []uint64
-	for i := from; i <= to; i++ {
+	for i := from; i < to; i++ {
 		idxList = append(idxList, i)
 	}
 	return idxList
 }
 
-func buildCoinDBKeys(shardID byte, tokenID string, idx uint64, pubkey []byte) (refKeys [][]byte, err error) {
+// buildCoinIdxKey returns the key of the pubkey of a coin by index. Token IDs
+// have a fixed size and the index is fixed-width big-endian, so the coins of
+// a token sort in chain order.
+func buildCoinIdxKey(network string, shardID byte, tokenID string, idx uint64) []byte {
+	idxBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(idxBytes, idx)
+	return append(buildCoinIdxPrefix(network, shardID, tokenID), idxBytes...)
+}
 
-	idxKey := buildCoinIdxKey(shardID, tokenID, idx)
+func buildCoinIdxPrefix(network string, shardID byte, tokenID string) []byte {
+	key := []byte{}
+	key = append(key, []byte(dbCoinIndexPrefix)...)
+	key = append(key, []byte(network+"-")...)
+	key = append(key, shardID)
+	key = append(key, []byte(tokenID)...)
+	return key
+}
 
-	refKeys = append(refKeys, idxKey)
-	return
+func buildCoinDataKey(network string, coinPubkey []byte) []byte {
+	key := []byte{}
+	key = append(key, []byte(dbCoinDataPrefix)...)
+	key = append(key, []byte(network+"-")...)
+	key = append(key, coinPubkey...)
+	return key
 }
 
-func buildCoinIdxKey(shardID byte, tokenID string, idx uint64) (key []byte) {
-	idxBig := big.Int{}
-	idxBig.SetUint64(idx)
+func buildSyncStateKey(network string, shardID byte) []byte {
+	key := []byte{}
+	key = append(key, []byte(dbSyncStatePrefix)...)
+	key = append(key, []byte(network+"-")...)
 	key = append(key, shardID)
-	key = append(key, []byte(tokenID)...)
-	key = append(key, idxBig.Bytes()...)
-	return
+	return key
 }
 
-func buildCoinOwnerKeys(shardID byte, tokenID string, idx uint64, pubkey []byte) (refKeys [][]byte, err error) {
+func appendUnique(list []string, item string) []string {
+	for _, v := range list {
+		if v == item {
+			return list
+		}
+	}
+	return append(list, item)
+}
 
-	idxKey := buildCoinIdxKey(shardID, tokenID, idx)
+// newViewKeyWallet builds a key wallet without private key from the
+// serialized payment address, OTA key and optional view key of an account.
+func newViewKeyWallet(paymentAddress string, otaKey string, viewKey string) (*wallet.KeyWallet, error) {
+	addrWallet, err := wallet.Base58CheckDeserialize(paymentAddress)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrWallet.KeySet.PaymentAddress.Pk) == 0 {
+		return nil, errors.New("invalid payment address")
+	}
+	otaWallet, err := wallet.Base58CheckDeserialize(otaKey)
+	if err != nil {
+		return nil, err
+	}
+	if otaWallet.KeySet.OTAKey.GetOTASecretKey() == nil {
+		return nil, errors.New("invalid OTA key")
+	}
+	// coins are found with the OTA key, it must be the one of the address
+	otaPubkey := otaWallet.KeySet.OTAKey.GetPublicSpend()
+	if otaPubkey == nil || !bytes.Equal(otaPubkey.ToBytesS(), addrWallet.KeySet.PaymentAddress.Pk) {
+		return nil, errors.New("OTA key does not match the payment address")
+	}
 
-	refKeys = append(refKeys, idxKey)
-	return
+	wlk := &wallet.KeyWallet{}
+	wlk.KeySet.PaymentAddress = addrWallet.KeySet.PaymentAddress
+	wlk.KeySet.OTAKey = otaWallet.KeySet.OTAKey
+	if viewKey != "" {
+		viewWallet, err := wallet.Base58CheckDeserialize(viewKey)
+		if err != nil {
+			return nil, err
+		}
+		if len(viewWallet.KeySet.ReadonlyKey.Rk) == 0 {
+			return nil, errors.New("invalid view key")
+		}
+		if !bytes.Equal(viewWallet.KeySet.ReadonlyKey.Pk, addrWallet.KeySet.PaymentAddress.Pk) {
+			return nil, errors.New("view key does not match the payment address")
+		}
+		wlk.KeySet.ReadonlyKey = viewWallet.KeySet.ReadonlyKey
+	}
+	return wlk, nil
 }
@@ -3,70 +3,220 @@ package walletmanager
 import (
 	"encoding/json"
 	"errors"
+	"strings"
 
+	"github.com/incognitochain/go-incognito-sdk-v2/coin"
 	"github.com/incognitochain/go-incognito-sdk-v2/common"
+	"github.com/incognitochain/go-incognito-sdk-v2/crypto"
+	"github.com/incognitochain/go-incognito-sdk-v2/key"
 	"github.com/incognitochain/go-incognito-sdk-v2/wallet"
+	"github.com/rs/zerolog/log"
+
 	"github.com/obsidianwallet/obsidian-wallet-node/database"
 )
 
-func InitWallet(db *database.Database) (*WalletManager, error) {
+// InitWallet loads the wallet from db. legacyCoinNetwork confirms the
+// network the coins stored without one belong to, see migrateCoinSchema.
+func InitWallet(db *database.Database, legacyCoinNetwork string) (*WalletManager, error) {
 	coinSyncMng := CoinSyncManager{
-		currentSyncShard: make(map[int]bool),
+		syncingShards:    make(map[int]*shardSyncWorker),
+		downloadStats:    make(map[int]*coinDownloadStats),
 		currentSyncState: make(map[int]map[string]uint64),
 		chainCoinState:   make(map[int]map[string]uint64),
-		stopCh:           make(chan struct{}),
 	}
-	wallet := &WalletManager{db: db, accounts: make(map[string]*RuntimeAccount), coinsyncmng: &coinSyncMng}
+	wallet := &WalletManager{
+		db:          db,
+		accounts:    make(map[string]*RuntimeAccount),
+		coinsyncmng: &coinSyncMng,
+		supervisor:  newSupervisor(),
+
+		legacyCoinNetwork: legacyCoinNetwork,
+	}
 	coinSyncMng.wlm = wallet
-	err := wallet.loadAccounts()
+	err := wallet.loadCryptoParams()
+	if err != nil {
+		return nil, err
+	}
+	err = wallet.loadMasterSeed()
+	if err != nil {
+		return nil, err
+	}
+	err = wallet.loadAccounts()
 	if err != nil {
 		return nil, err
 	}
 	return wallet, nil
 }
 
-func (wlm *WalletManager) addAccount(account Account) (string, error) {
+// addAccount registers the runtime instance of account. Encrypted accounts
+// only get their private key when encryptionKey is given, otherwise they are
+// loaded locked with their view keys.
+func (wlm *WalletManager) addAccount(account Account, encryptionKey []byte) (string, error) {
 	wlm.lock.Lock()
 	defer wlm.lock.Unlock()
+	if account.WatchTokens == nil {
+		account.WatchTokens = make(map[string]struct{})
+	}
 	accRT := RuntimeAccount{
-		account: account,
+		account:        account,
+		wlm:            wlm,
+		currentNetwork: wlm.GetCurrentNetwork(),
 	}
 	accPubkey := ""
 	switch account.Type {
 	case Masterless:
+		if account.IsEncrypted {
+			wlk, err := newViewKeyWallet(account.PaymentAddress, account.OTAKey, account.ViewKey)
+			if err != nil {
+				return accPubkey, err
+			}
+			accPubkey, err = wlk.GetPublicKey()
+			if err != nil {
+				return accPubkey, ErrInvalidKey
+			}
+			if encryptionKey != nil {
+				wlk, err = decryptPrivateKey(encryptionKey, account.PrivateKey, accPubkey)
+				if err != nil {
+					return accPubkey, err
+				}
+			}
+			accRT.wlk = wlk
+			break
+		}
 		wlk, err := wallet.Base58CheckDeserialize(account.PrivateKey)
 		if err != nil {
 			return accPubkey, err
 		}
 		if len(wlk.KeySet.PrivateKey) == 0 {
-			return accPubkey, errors.New("invalid key")
+			return accPubkey, ErrInvalidKey
 		}
-		accRT.wlm = wlm
 		accRT.wlk = wlk
 		accPubkey, err = wlk.GetPublicKey()
 		if err != nil {
-			return accPubkey, errors.New("invalid key")
+			return accPubkey, ErrInvalidKey
 		}
+		accRT.account.PaymentAddress = wlk.Base58CheckSerialize(wallet.PaymentAddressType)
+		accRT.account.OTAKey = wlk.Base58CheckSerialize(wallet.OTAKeyType)
+		accRT.account.ViewKey = wlk.Base58CheckSerialize(wallet.ReadonlyKeyType)
 	case WatchOnly:
-
+		wlk, err := newViewKeyWallet(account.PaymentAddress, account.OTAKey, account.ViewKey)
+		if err != nil {
+			return accPubkey, err
+		}
+		accPubkey, err = wlk.GetPublicKey()
+		if err != nil {
+			return accPubkey, ErrInvalidKey
+		}
+		accRT.wlk = wlk
+		accRT.account.PrivateKey = ""
+		accRT.account.IsEncrypted = false
+	case HDDerived:
+		// the private key is derived from the master seed on unlock
+		wlk, err := newViewKeyWallet(account.PaymentAddress, account.OTAKey, account.ViewKey)
+		if err != nil {
+			return accPubkey, err
+		}
+		accPubkey, err = wlk.GetPublicKey()
+		if err != nil {
+			return accPubkey, ErrInvalidKey
+		}
+		accRT.wlk = wlk
+		accRT.account.PrivateKey = ""
+		accRT.account.IsEncrypted = true
 	default:
 		return accPubkey, errors.New("invalid wallet type")
 	}
 
 	if _, exist := wlm.accounts[accPubkey]; exist {
-		return accPubkey, errors.New("account already exists")
+		return accPubkey, ErrAccountExists
 	}
 
+	accRT.pubkey = accPubkey
+	accRT.shardID = getAddressShardID(accRT.wlk.KeySet.PaymentAddress.Pk[:], common.MaxShardNumber)
 	wlm.accounts[accPubkey] = &accRT
 	return accPubkey, nil
 }
 
-func (wlm *WalletManager) AddNewAccount(account Account) error {
-	accPubkey, err := wlm.addAccount(account)
+// AddNewAccount registers and stores a new account. When the wallet is
+// encrypted it must be unlocked so the private key can be encrypted at rest.
+func (wlm *WalletManager) AddNewAccount(account Account) (string, error) {
+	wlm.cryptoLock.RLock()
+	defer wlm.cryptoLock.RUnlock()
+	if account.Type == HDDerived {
+		return "", errors.New("derived accounts are created from the master seed")
+	}
+	account.IsEncrypted = false
+	encrypt := account.Type == Masterless && wlm.cryptoParams != nil
+	if encrypt && wlm.encryptionKey == nil {
+		return "", ErrWalletLocked
+	}
+
+	accPubkey, err := wlm.addAccount(account, nil)
 	if err != nil {
-		return err
+		return "", err
+	}
+	accRT := wlm.GetAccountInstance(accPubkey)
+	if encrypt {
+		encryptedKey, err := encryptData(wlm.encryptionKey, []byte(account.PrivateKey), []byte(accPubkey))
+		if err != nil {
+			wlm.removeAccount(accPubkey)
+			return "", err
+		}
+		accRT.lock.Lock()
+		accRT.account.PrivateKey = encryptedKey
+		accRT.account.IsEncrypted = true
+		accRT.lock.Unlock()
+	}
+	if err := wlm.saveAccountToDB(accRT.GetAccount(), accPubkey); err != nil {
+		wlm.removeAccount(accPubkey)
+		return "", err
 	}
-	return wlm.saveAccountToDB(account, accPubkey)
+	if err := wlm.startAccount(accRT); err != nil {
+		wlm.removeAccount(accPubkey)
+		if delErr := wlm.deleteAccountFromDB(accPubkey); delErr != nil {
+			log.Error().Msgf("remove account %v after failed start failed: %v", accPubkey, delErr)
+		}
+		return "", err
+	}
+	return accPubkey, nil
+}
+
+func (wlm *WalletManager) removeAccount(pubkey string) {
+	wlm.lock.Lock()
+	defer wlm.lock.Unlock()
+	delete(wlm.accounts, pubkey)
+}
+
+// UpdateAccount sets the name and note of the account and returns it.
+func (wlm *WalletManager) UpdateAccount(pubkey string, name string, note string) (Account, error) {
+	accRT := wlm.GetAccountInstance(pubkey)
+	if accRT == nil {
+		return Account{}, ErrAccountNotFound
+	}
+	accRT.lock.Lock()
+	accRT.account.Name = name
+	accRT.account.Note = note
+	accRT.lock.Unlock()
+	account := accRT.GetAccount()
+	if err := wlm.saveAccountToDB(account, pubkey); err != nil {
+		return Account{}, err
+	}
+	return account, nil
+}
+
+func (wlm *WalletManager) DeleteAccount(pubkey string) error {
+	wlm.lock.Lock()
+	accRT, exist := wlm.accounts[pubkey]
+	if !exist {
+		wlm.lock.Unlock()
+		return ErrAccountNotFound
+	}
+	delete(wlm.accounts, pubkey)
+	wlm.lock.Unlock()
+
+	accRT.stop()
+	wlm.updateSyncShards()
+	return wlm.deleteAccountFromDB(pubkey)
 }
 
 func (wlm *WalletManager) GetAccountInstance(account string) *RuntimeAccount {
@@ -80,8 +230,68 @@ func (wlm *WalletManager) GetAccountInstance(account string) *RuntimeAccount {
 }
 
 func (wlm *WalletManager) GetAccountBalance(account string) map[string]uint64 {
-	result := make(map[string]uint64)
-	return result
+	accRT := wlm.GetAccountInstance(account)
+	if accRT == nil {
+		return make(map[string]uint64)
+	}
+	return accRT.GetBalances()
+}
+
+// getCoinTokenID resolves the real token of a coin. Token coins share the
+// confidential asset stream, so their asset tag is matched against the raw
+// asset tags of every token, refreshing the list once if no match is found.
+func (wlm *WalletManager) getCoinTokenID(outCoin *coin.CoinV2, keySet *key.KeySet) (string, error) {
+	wlm.assetTagsLock.RLock()
+	assetTags := wlm.assetTags
+	wlm.assetTagsLock.RUnlock()
+	if assetTags != nil {
+		if tokenID, err := outCoin.GetTokenId(keySet, assetTags); err == nil {
+			return tokenID.String(), nil
+		}
+	}
+
+	client := wlm.getClient()
+	assetTags, err := client.GetAllAssetTags()
+	if err != nil {
+		wlm.reportRPCError(client, err)
+		return "", err
+	}
+	wlm.assetTagsLock.Lock()
+	for _, tokenHash := range wlm.extraTokenIDs {
+		assetTags[crypto.HashToPoint(tokenHash[:]).String()] = tokenHash
+	}
+	wlm.assetTags = assetTags
+	wlm.assetTagsLock.Unlock()
+
+	tokenID, err := outCoin.GetTokenId(keySet, assetTags)
+	if err != nil {
+		return "", err
+	}
+	return tokenID.String(), nil
+}
+
+// RegisterTokenIDs makes coins of tokens missing from the chain token list,
+// like pDEX access NFTs, recognized when scanning.
+func (wlm *WalletManager) RegisterTokenIDs(tokenIDs []string) error {
+	wlm.assetTagsLock.Lock()
+	defer wlm.assetTagsLock.Unlock()
+	if wlm.extraTokenIDs == nil {
+		wlm.extraTokenIDs = make(map[string]*common.Hash)
+	}
+	for _, tokenID := range tokenIDs {
+		if _, ok := wlm.extraTokenIDs[tokenID]; ok {
+			continue
+		}
+		tokenHash, err := new(common.Hash).NewHashFromStr(tokenID)
+		if err != nil {
+			return err
+		}
+		wlm.extraTokenIDs[tokenID] = tokenHash
+		if wlm.assetTags != nil {
+			wlm.assetTags[crypto.HashToPoint(tokenHash[:]).String()] = tokenHash
+		}
+	}
+	return nil
 }
 
 func (wlm *WalletManager) loadAccounts() error {
@@ -91,7 +301,7 @@ func (wlm *WalletManager) loadAccounts() error {
 		if err != nil {
 			return true, err
 		}
-		_, err = wlm.addAccount(acc)
+		_, err = wlm.addAccount(acc, nil)
 		if err != nil {
 			return true, err
 		}
@@ -112,35 +322,91 @@ func (wlm *WalletManager) saveAccountToDB(account Account, pubkey string) error
 	return wlm.db.DB.Set([]byte(dbAccountInfoPrefix), []database.Object{dbObj})
 }
 
+// deleteAccountFromDB removes the account with its coin state, owned coins
+// and history on every network. The account info goes last so an interrupted
+// delete can be retried after a restart.
 func (wlm *WalletManager) deleteAccountFromDB(pubkey string) error {
-	err := wlm.db.DB.Delete([]byte(dbAccountInfoPrefix), []byte(pubkey))
+	networks, err := wlm.getAccountNetworks(pubkey)
+	if err != nil {
+		return err
+	}
+	for _, network := range networks {
+		prefixes := [][]byte{
+			append([]byte(dbAccountCoinPrefix), buildAccountCoinKey(network, pubkey, "")...),
+			append([]byte(dbAccountHistoryPrefix), buildAccountHistoryKey(network, pubkey)...),
+		}
+		for _, prefix := range prefixes {
+			if err := wlm.db.DB.DeleteNamespace(prefix); err != nil {
+				return err
+			}
+		}
+		if err := wlm.db.DB.Delete([]byte{}, buildAccountDataKey(network, pubkey)); err != nil {
+			return err
+		}
+	}
+	err = wlm.db.DB.Delete([]byte(dbAccountInfoPrefix), []byte(pubkey))
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (wlm *WalletManager) ListAccounts() ([]Account, error) {
+// getAccountNetworks returns the networks the account has a coin state on,
+// and the current one.
+func (wlm *WalletManager) getAccountNetworks(pubkey string) ([]string, error) {
+	current := wlm.GetCurrentNetwork().Name
+	networks := []string{current}
+	err := wlm.db.DB.ReadIteratorNonCopy([]byte(dbAccountDataPrefix), false, func(k []byte, v []byte) (bool, error) {
+		// network names have no dash, see buildAccountDataKey
+		key := string(k[len(dbAccountDataPrefix):])
+		idx := strings.IndexByte(key, '-')
+		if idx < 0 || key[idx+1:] != pubkey || key[:idx] == current {
+			return false, nil
+		}
+		networks = append(networks, key[:idx])
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return networks, nil
+}
+
+func (wlm *WalletManager) ListAccounts() (map[string]Account, error) {
 	wlm.lock.RLock()
 	defer wlm.lock.RUnlock()
-	var accounts []Account
-	for _, accountRT := range wlm.accounts {
-		accounts = append(accounts, accountRT.account)
+	accounts := make(map[string]Account)
+	for pubkey, accountRT := range wlm.accounts {
+		accounts[pubkey] = accountRT.GetAccount()
 	}
 	return accounts, nil
 }
 
+// ListAccountInstances returns the runtime accounts by pubkey.
+func (wlm *WalletManager) ListAccountInstances() map[string]*RuntimeAccount {
+	wlm.lock.RLock()
+	defer wlm.lock.RUnlock()
+	accounts := make(map[string]*RuntimeAccount, len(wlm.accounts))
+	for pubkey, accountRT := range wlm.accounts {
+		accounts[pubkey] = accountRT
+	}
+	return accounts
+}
+
 func (wlm *WalletManager) getLastestShardCoinIndex(shardid int) (map[string]uint64, error) {
 	result := make(map[string]uint64)
 	prvID := common.PRVCoinID.String()
 	pTokenID := common.ConfidentialAssetID.String()
 
-	prvIDIdx, err := wlm.incclient.GetOTACoinLengthByShard(byte(shardid), prvID)
+	client := wlm.getClient()
+	prvIDIdx, err := client.GetOTACoinLengthByShard(byte(shardid), prvID)
 	if err != nil {
+		wlm.reportRPCError(client, err)
 		return nil, err
 	}
-	tkIDIdx, err := wlm.incclient.GetOTACoinLengthByShard(byte(shardid), pTokenID)
+	tkIDIdx, err := client.GetOTACoinLengthByShard(byte(shardid), pTokenID)
 	if err != nil {
+		wlm.reportRPCError(client, err)
 		return nil, err
 	}
 	result[prvID] = prvIDIdx